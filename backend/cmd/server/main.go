@@ -2,9 +2,12 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"quicacademy-backend/config"
+	"quicacademy-backend/controllers"
 	"quicacademy-backend/routes"
+	"quicacademy-backend/services"
 	"quicacademy-backend/utils"
 )
 
@@ -24,8 +27,76 @@ func main() {
 		log.Fatal("Failed to create tables:", err)
 	}
 
+	// Prompt templates stored in the database override the embedded ones
+	if err := services.DefaultPrompts.LoadFromDB(db); err != nil {
+		log.Fatal("Failed to load prompt templates:", err)
+	}
+
+	// Expired cache rows are never served, drop them to reclaim space
+	if _, err := services.NewAICache(db).PurgeExpired(); err != nil {
+		log.Println("Failed to purge expired AI cache entries:", err)
+	}
+
+	// Jobs of a stopped process will never finish, release their dedup keys
+	if _, err := controllers.ResetInterruptedJobs(db); err != nil {
+		log.Fatal("Failed to reset interrupted jobs:", err)
+	}
+
+	// Shared so every controller uses the same response cache
+	aiService := services.NewOpenRouterService(db)
+	quizWorker := controllers.NewQuizController(db, aiService)
+
+	// Essays whose grading was interrupted above are graded again
+	if err := quizWorker.ResumeEssayGrading(); err != nil {
+		log.Println("Failed to resume essay grading:", err)
+	}
+
+	// Submit quiz sessions whose time ran out while the student or guest was
+	// away
+	go func() {
+		for range time.Tick(time.Minute) {
+			if _, err := quizWorker.ExpireQuizAttempts(); err != nil {
+				log.Println("Failed to expire quiz attempts:", err)
+			}
+			if _, err := controllers.ExpireGuestAttempts(db); err != nil {
+				log.Println("Failed to expire guest attempts:", err)
+			}
+		}
+	}()
+
+	// Other instances may stop while this one runs; their jobs go stale and
+	// their essays are picked up here
+	go func() {
+		for range time.Tick(time.Minute) {
+			reset, err := controllers.ResetInterruptedJobs(db)
+			if err != nil {
+				log.Println("Failed to reset interrupted jobs:", err)
+				continue
+			}
+			if reset == 0 {
+				continue
+			}
+			if err := quizWorker.ResumeEssayGrading(); err != nil {
+				log.Println("Failed to resume essay grading:", err)
+			}
+		}
+	}()
+
+	// Re-estimate question difficulty from the answers collected so far, and
+	// keep the cache table from growing with entries nobody will be served
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := quizWorker.CalibrateItemBanks(); err != nil {
+				log.Println("Failed to calibrate question banks:", err)
+			}
+			if _, err := aiService.Cache.PurgeExpired(); err != nil {
+				log.Println("Failed to purge expired AI cache entries:", err)
+			}
+		}
+	}()
+
 	// Setup routes
-	r := routes.SetupRoutes(db, cfg.JWTSecret)
+	r := routes.SetupRoutes(db, cfg.JWTSecret, aiService)
 
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
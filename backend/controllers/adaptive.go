@@ -0,0 +1,490 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultTargetStandardError ends adaptive attempts of quizzes created
+// without a target
+const defaultTargetStandardError = 0.5
+
+// AnswerQuestion answers the current question of an adaptive attempt. The
+// student's ability is estimated again from every answer so far; the attempt
+// ends when the estimate is precise enough, the question limit is reached or
+// the bank runs out, and otherwise the most informative next question is
+// returned.
+func (qc *QuizController) AnswerQuestion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	attemptID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	var req models.AdaptiveAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attempt, err := getAttempt(qc.DB, attemptID)
+	if err == sql.ErrNoRows || (err == nil && attempt.UserID != userID.(uuid.UUID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	quiz, ok := qc.loadQuizForUser(c, attempt.QuizID, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	if !quiz.Adaptive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only adaptive quizzes are answered one question at a time"})
+		return
+	}
+
+	if attempt.Status != models.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	now := time.Now()
+	if attemptExpired(attempt, quiz.TimeLimit, now) {
+		if !qc.expireAttempt(c, attempt.ID) {
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Time limit exceeded, the saved answers were submitted"})
+		return
+	}
+
+	pool, params, err := adaptiveItems(qc.DB, quiz.MaterialID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	attempt, next, finished, err := qc.recordAdaptiveAnswer(attempt.ID, quiz, req, pool, params)
+	switch err {
+	case nil:
+	case errAttemptClosed:
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	case errQuestionAnswered:
+		c.JSON(http.StatusConflict, gin.H{"error": "Question has already been answered"})
+		return
+	case errNotCurrentQuestion:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Answer the current question of the attempt"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answer"})
+		return
+	}
+
+	if !finished {
+		response := gin.H{
+			"attempt_id":        attempt.ID,
+			"status":            attempt.Status,
+			"version":           attempt.Version,
+			"ability":           attempt.Ability,
+			"standard_error":    attempt.StandardError,
+			"answered":          len(decodeAnswers(attempt.Answers)),
+			"question":          studentQuestions([]models.Question{next})[0],
+			"remaining_seconds": nil,
+		}
+		if deadline, limited := attemptDeadline(attempt, quiz.TimeLimit); limited {
+			response["remaining_seconds"] = remainingSeconds(deadline, now)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	attempt, grade, err := finishAttempt(qc.DB, attempt.ID, nil, nil, models.AttemptSubmitted)
+	if err == errAttemptClosed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz attempt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, qc.submissionResult(quiz, attempt, grade))
+}
+
+var (
+	errQuestionAnswered   = errors.New("question has already been answered")
+	errNotCurrentQuestion = errors.New("question is not the current question")
+)
+
+// recordAdaptiveAnswer saves the answer to the current question of an
+// adaptive attempt under a row lock, updates the ability estimate and either
+// appends the next question or reports that the attempt is finished
+func (qc *QuizController) recordAdaptiveAnswer(attemptID uuid.UUID, quiz models.Quiz, req models.AdaptiveAnswerRequest, pool []models.Question, params []services.ItemParams) (models.QuizAttempt, models.Question, bool, error) {
+	var next models.Question
+
+	tx, err := qc.DB.Begin()
+	if err != nil {
+		return models.QuizAttempt{}, next, false, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + attemptColumns + ` FROM quiz_attempts WHERE id = $1 FOR UPDATE`
+	attempt, err := scanAttempt(tx.QueryRow(query, attemptID))
+	if err != nil {
+		return attempt, next, false, err
+	}
+
+	if attempt.Status != models.AttemptInProgress {
+		return attempt, next, false, errAttemptClosed
+	}
+
+	presented := parseQuestions(attempt.Questions)
+	answers := decodeAnswers(attempt.Answers)
+	if _, answered := answers[strconv.Itoa(req.QuestionID)]; answered {
+		return attempt, next, false, errQuestionAnswered
+	}
+	if len(presented) == 0 || presented[len(presented)-1].ID != req.QuestionID {
+		return attempt, next, false, errNotCurrentQuestion
+	}
+
+	current := presented[len(presented)-1]
+	answers[strconv.Itoa(current.ID)] = services.NormalizeAnswer(current, req.Answer)
+
+	// Questions are shown one after another, so the current one has been
+	// shown for the time not spent on the previous ones
+	times := decodeQuestionTimes(attempt.QuestionTimes)
+	elapsed := int(time.Since(attempt.StartedAt).Seconds())
+	for _, seconds := range times {
+		elapsed -= seconds
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	times[strconv.Itoa(current.ID)] = elapsed
+
+	theta, standardError := services.EstimateAbility(adaptiveResponses(presented, answers, pool, params))
+	attempt.Ability, attempt.StandardError = &theta, &standardError
+
+	target := quiz.TargetStandardError
+	if target <= 0 {
+		target = defaultTargetStandardError
+	}
+	finished := standardError <= target || (quiz.QuestionsPerAttempt > 0 && len(presented) >= quiz.QuestionsPerAttempt)
+
+	if !finished {
+		random := rand.New(rand.NewSource(attempt.Seed + int64(len(presented))))
+		var found bool
+		next, found = nextAdaptiveQuestion(presented, pool, params, theta, random)
+		if found {
+			presented = append(presented, next)
+		} else {
+			finished = true
+		}
+	}
+
+	order := make([]int, len(presented))
+	for i, question := range presented {
+		order[i] = question.ID
+	}
+	orderJSON, _ := json.Marshal(order)
+	questionsJSON, _ := json.Marshal(presented)
+	answersJSON, _ := json.Marshal(answers)
+	timesJSON, _ := json.Marshal(times)
+
+	updateQuery := `UPDATE quiz_attempts
+					SET questions = $1, question_order = $2, answers = $3, question_times = $4, ability = $5, ability_se = $6,
+						version = version + 1
+					WHERE id = $7
+					RETURNING version`
+
+	err = tx.QueryRow(updateQuery,
+		string(questionsJSON), string(orderJSON), string(answersJSON), string(timesJSON), theta, standardError, attempt.ID,
+	).Scan(&attempt.Version)
+	if err != nil {
+		return attempt, next, false, err
+	}
+
+	attempt.Questions = string(questionsJSON)
+	attempt.QuestionOrder = string(orderJSON)
+	attempt.Answers = string(answersJSON)
+	attempt.QuestionTimes = string(timesJSON)
+
+	return attempt, next, finished, tx.Commit()
+}
+
+// adaptiveItems returns the bank questions adaptive attempts draw from, with
+// their calibrated parameters, or priors from their difficulty labels for
+// questions not calibrated yet. Essays are left out since they can't be
+// scored on the spot.
+func adaptiveItems(db *sql.DB, materialID uuid.UUID) ([]models.Question, []services.ItemParams, error) {
+	bank, err := bankQuestions(db, materialID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	calibrated := map[uuid.UUID]services.ItemParams{}
+	rows, err := db.Query(`SELECT bank_id, difficulty, discrimination FROM item_parameters WHERE material_id = $1`, materialID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bankID uuid.UUID
+		var item services.ItemParams
+		if err := rows.Scan(&bankID, &item.Difficulty, &item.Discrimination); err != nil {
+			return nil, nil, err
+		}
+		calibrated[bankID] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var pool []models.Question
+	var params []services.ItemParams
+	for _, question := range bank {
+		if question.Type == models.QuestionEssay {
+			continue
+		}
+
+		item, ok := calibrated[*question.BankID]
+		if !ok {
+			item = services.PriorItemParams(question)
+		}
+		pool = append(pool, question)
+		params = append(params, item)
+	}
+
+	return pool, params, nil
+}
+
+// adaptiveResponses pairs the answered questions of an attempt with their
+// item parameters and the credit earned
+func adaptiveResponses(presented []models.Question, answers map[string]models.Answer, pool []models.Question, params []services.ItemParams) []services.ItemResponse {
+	byBankID := map[uuid.UUID]services.ItemParams{}
+	for i, question := range pool {
+		byBankID[*question.BankID] = params[i]
+	}
+
+	var responses []services.ItemResponse
+	for _, question := range presented {
+		answer, answered := answers[strconv.Itoa(question.ID)]
+		if !answered {
+			continue
+		}
+
+		item := services.PriorItemParams(question)
+		if question.BankID != nil {
+			if calibrated, ok := byBankID[*question.BankID]; ok {
+				item = calibrated
+			}
+		}
+		responses = append(responses, services.ItemResponse{Item: item, Credit: services.GradeQuestion(question, answer)})
+	}
+
+	return responses
+}
+
+// nextAdaptiveQuestion picks the next question for an ability of theta from
+// the pool questions not presented yet, with its options shuffled and
+// numbered after the presented ones
+func nextAdaptiveQuestion(presented, pool []models.Question, params []services.ItemParams, theta float64, random *rand.Rand) (models.Question, bool) {
+	asked := map[uuid.UUID]bool{}
+	for _, question := range presented {
+		if question.BankID != nil {
+			asked[*question.BankID] = true
+		}
+	}
+
+	var candidates []models.Question
+	var candidateParams []services.ItemParams
+	for i, question := range pool {
+		if !asked[*question.BankID] {
+			candidates = append(candidates, question)
+			candidateParams = append(candidateParams, params[i])
+		}
+	}
+
+	index := services.NextItem(theta, candidateParams, random)
+	if index < 0 {
+		return models.Question{}, false
+	}
+
+	next := services.ShuffleOptions(candidates[index], random)
+	next.ID = len(presented) + 1
+	return next, true
+}
+
+// adaptiveScore is the score of an adaptive attempt: the percentage of the
+// question bank a student of the estimated ability is expected to answer
+// correctly, since students answer different questions
+func adaptiveScore(db *sql.DB, materialID uuid.UUID, ability float64) (int, error) {
+	_, params, err := adaptiveItems(db, materialID)
+	if err != nil {
+		return 0, err
+	}
+	return services.ExpectedScore(ability, params), nil
+}
+
+// CalibrateItemBanks re-estimates the IRT parameters of every question bank
+// with attempts submitted since it was last calibrated
+func (qc *QuizController) CalibrateItemBanks() (int, error) {
+	query := `SELECT q.material_id
+			  FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  WHERE a.status <> $1
+			  GROUP BY q.material_id
+			  HAVING MAX(a.submitted_at) > COALESCE(
+				  (SELECT MAX(p.calibrated_at) FROM item_parameters p WHERE p.material_id = q.material_id),
+				  'epoch')`
+
+	rows, err := qc.DB.Query(query, models.AttemptInProgress)
+	if err != nil {
+		return 0, err
+	}
+
+	var materialIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		materialIDs = append(materialIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	calibrated := 0
+	for _, id := range materialIDs {
+		if err := calibrateMaterial(qc.DB, id); err != nil {
+			log.Printf("Failed to calibrate question bank of material %s: %v", id, err)
+			continue
+		}
+		calibrated++
+	}
+
+	return calibrated, nil
+}
+
+// calibrateMaterial fits the bank questions of a material to every finished
+// attempt that included them, each attempt counting as one person
+func calibrateMaterial(db *sql.DB, materialID uuid.UUID) error {
+	bank, err := bankQuestions(db, materialID)
+	if err != nil || len(bank) == 0 {
+		return err
+	}
+
+	index := make(map[uuid.UUID]int, len(bank))
+	priors := make([]services.ItemParams, len(bank))
+	for i, question := range bank {
+		index[*question.BankID] = i
+		priors[i] = services.PriorItemParams(question)
+	}
+
+	query := `SELECT a.question_order, a.questions, a.results, q.questions
+			  FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  WHERE q.material_id = $1 AND a.status <> $2`
+
+	rows, err := db.Query(query, materialID, models.AttemptInProgress)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var responses []services.CalibrationResponse
+	counts := make([]int, len(bank))
+	persons := 0
+	for rows.Next() {
+		var attempt models.QuizAttempt
+		var quizQuestions string
+		if err := rows.Scan(&attempt.QuestionOrder, &attempt.Questions, &attempt.Results, &quizQuestions); err != nil {
+			return err
+		}
+
+		var results []services.QuestionResult
+		if err := json.Unmarshal([]byte(attempt.Results), &results); err != nil {
+			continue
+		}
+
+		byID := map[int]models.Question{}
+		for _, question := range attemptQuestions(attempt, parseQuestions(quizQuestions)) {
+			byID[question.ID] = question
+		}
+
+		answered := false
+		for _, result := range results {
+			question, ok := byID[result.QuestionID]
+			if !ok || result.Pending || question.BankID == nil {
+				continue
+			}
+			item, ok := index[*question.BankID]
+			if !ok {
+				continue
+			}
+			responses = append(responses, services.CalibrationResponse{Person: persons, Item: item, Credit: result.Credit})
+			counts[item]++
+			answered = true
+		}
+		if answered {
+			persons++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	items := services.Calibrate(priors, responses, persons)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertQuery := `INSERT INTO item_parameters (bank_id, material_id, difficulty, discrimination, responses, calibrated_at)
+					VALUES ($1, $2, $3, $4, $5, $6)
+					ON CONFLICT (bank_id) DO UPDATE
+					SET difficulty = EXCLUDED.difficulty, discrimination = EXCLUDED.discrimination,
+						responses = EXCLUDED.responses, calibrated_at = EXCLUDED.calibrated_at`
+
+	now := time.Now()
+	for i, question := range bank {
+		if _, err := tx.Exec(upsertQuery,
+			*question.BankID, materialID, items[i].Difficulty, items[i].Discrimination, counts[i], now,
+		); err != nil {
+			return fmt.Errorf("failed to save item parameters: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
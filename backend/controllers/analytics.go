@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Analytics defaults
+const (
+	defaultAnalyticsWeeks = 12
+	defaultStaleDays      = 14
+	maxAnalyticsDays      = 366
+)
+
+type AnalyticsController struct {
+	DB        *sql.DB
+	Analytics *services.AnalyticsService
+}
+
+func NewAnalyticsController(db *sql.DB) *AnalyticsController {
+	return &AnalyticsController{
+		DB:        db,
+		Analytics: services.NewAnalyticsService(db),
+	}
+}
+
+// GetOverview returns the caller's learning analytics between from and to,
+// grouped by week in the requested timezone, defaulting to the last 12 weeks
+func (ac *AnalyticsController) GetOverview(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.AnalyticsOverviewRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc, err := requestLocation(req.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	from := to.AddDate(0, 0, 1-7*defaultAnalyticsWeeks)
+
+	// Dates were validated when binding the request
+	if req.From != "" {
+		from, _ = time.ParseInLocation("2006-01-02", req.From, loc)
+	}
+	if req.To != "" {
+		to, _ = time.ParseInLocation("2006-01-02", req.To, loc)
+	}
+
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The date range must not exceed 366 days"})
+		return
+	}
+
+	staleDays := req.StaleDays
+	if staleDays == 0 {
+		staleDays = defaultStaleDays
+	}
+
+	overview, err := ac.Analytics.Overview(userID.(uuid.UUID), from, to, loc, staleDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
+
+// LogStudySession records time the caller spent studying outside quizzes,
+// optionally on one of their materials
+func (ac *AnalyticsController) LogStudySession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.StudySessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var materialID uuid.NullUUID
+	if req.MaterialID != "" {
+		materialID = uuid.NullUUID{UUID: uuid.MustParse(req.MaterialID), Valid: true} // validated when binding
+
+		var ownerID uuid.UUID
+		err := ac.DB.QueryRow(`SELECT user_id FROM materials WHERE id = $1`, materialID.UUID).Scan(&ownerID)
+		if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	err := services.LogActivity(ac.DB, userID.(uuid.UUID), materialID, models.ActivityStudy, req.DurationSeconds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record study session"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":          "Study session recorded",
+		"material_id":      materialID,
+		"duration_seconds": req.DurationSeconds,
+	})
+}
+
+// requestLocation loads the IANA timezone a request asks for, the server's
+// when none is given
+func requestLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
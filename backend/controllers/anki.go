@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Export formats for Anki
+const (
+	ExportApkg = "apkg"
+	ExportCSV  = "csv"
+	ExportTSV  = "tsv"
+)
+
+// Limits of flashcard imports
+const (
+	maxImportSize     = 5 << 20 // 5 MB
+	maxImportedCards  = 1000
+	maxFlashcardFront = 1000
+	maxFlashcardBack  = 2000
+)
+
+// Exported decks are subdecks of one Quicacademy deck
+const ankiDeckNamePrefix = "Quicacademy::"
+
+// ExportDeck exports a flashcard deck for Anki as an .apkg package, with
+// each card's review schedule, or as a CSV/TSV text file
+func (fc *FlashcardController) ExportDeck(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.AnkiExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deck, ok := fc.loadDeck(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	rows, err := fc.DB.Query(`SELECT `+flashcardColumns+` FROM flashcards WHERE deck_id = $1 ORDER BY position, created_at`, deck.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	cards := []models.Flashcard{}
+	for rows.Next() {
+		card, err := scanFlashcard(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		cards = append(cards, card)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	sendAnkiExport(c, req.Format, deck.Title, services.FlashcardNotes(cards))
+}
+
+// ImportDeck adds the cards of an Anki text export (CSV or TSV, uploaded as
+// file) to the end of a deck. Cards too long for a flashcard are skipped.
+func (fc *FlashcardController) ImportDeck(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	deck, ok := fc.loadDeck(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	if ext != ".csv" && ext != ".tsv" && ext != ".txt" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File type not supported, upload a .csv, .tsv or .txt file"})
+		return
+	}
+
+	if fileHeader.Size > maxImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File size too large"})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	parsed, err := services.ParseAnkiText(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(parsed) > maxImportedCards {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most 1000 cards can be imported at once"})
+		return
+	}
+
+	tx, err := fc.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import flashcards"})
+		return
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM flashcards WHERE deck_id = $1`, deck.ID).Scan(&position)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import flashcards"})
+		return
+	}
+
+	now := time.Now()
+	imported, skipped := 0, 0
+	for _, card := range parsed {
+		if len(card.Front) > maxFlashcardFront || len(card.Back) > maxFlashcardBack {
+			skipped++
+			continue
+		}
+
+		if err := insertFlashcard(tx, deck.ID, card.Front, card.Back, card.Concept, position+imported, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import flashcards"})
+			return
+		}
+		imported++
+	}
+
+	if _, err := tx.Exec(`UPDATE flashcard_decks SET updated_at = $1 WHERE id = $2`, now, deck.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import flashcards"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import flashcards"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Flashcards imported",
+		"deck_id":  deck.ID,
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
+
+// ExportConcepts exports the concepts of a material's active summary for
+// Anki, a card per concept with its explanation on the back
+func (sc *SummaryController) ExportConcepts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var req models.AnkiExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT s.concepts, m.title, m.user_id
+			  FROM materials m
+			  LEFT JOIN summaries s ON s.material_id = m.id AND s.is_active
+			  WHERE m.id = $1`
+
+	var concepts sql.NullString
+	var title string
+	var ownerID uuid.UUID
+	err = sc.DB.QueryRow(query, materialID).Scan(&concepts, &title, &ownerID)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !concepts.Valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+		return
+	}
+
+	notes := services.ConceptNotes(materialID.String(), concepts.String)
+	if len(notes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The summary has no concepts with explanations to export"})
+		return
+	}
+
+	sendAnkiExport(c, req.Format, title+"::Concepts", notes)
+}
+
+// sendAnkiExport responds with notes as a download in format, apkg unless
+// given, in a deck named after title
+func sendAnkiExport(c *gin.Context, format, title string, notes []services.AnkiNote) {
+	deckName := ankiDeckNamePrefix + title
+
+	switch format {
+	case ExportCSV, ExportTSV:
+		separator, contentType := ',', "text/csv; charset=utf-8"
+		if format == ExportTSV {
+			separator, contentType = '\t', "text/tab-separated-values; charset=utf-8"
+		}
+
+		var buf bytes.Buffer
+		if err := services.WriteAnkiText(&buf, deckName, notes, separator); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export"})
+			return
+		}
+		sendDownload(c, exportFileName(title, format), contentType, buf.Bytes())
+
+	default:
+		data, err := services.AnkiPackage(deckName, notes, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export"})
+			return
+		}
+		sendDownload(c, exportFileName(title, ExportApkg), "application/octet-stream", data)
+	}
+}
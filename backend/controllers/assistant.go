@@ -3,10 +3,13 @@ package controllers
 import (
 	"database/sql"
 	"net/http"
+	"time"
 
+	"quicacademy-backend/models"
 	"quicacademy-backend/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type AssistantController struct {
@@ -17,16 +20,18 @@ type AssistantController struct {
 type ChatRequest struct {
 	Message    string `json:"message" validate:"required"`
 	MaterialID string `json:"material_id,omitempty"`
+	Language   string `json:"language,omitempty" binding:"omitempty,oneof=id en id-en"`
 }
 
 type ChatResponse struct {
-	Response string `json:"response"`
+	MessageID uuid.UUID `json:"message_id"`
+	Response  string    `json:"response"`
 }
 
-func NewAssistantController(db *sql.DB) *AssistantController {
+func NewAssistantController(db *sql.DB, aiService *services.OpenRouterService) *AssistantController {
 	return &AssistantController{
 		DB:        db,
-		AIService: services.NewOpenRouterService(),
+		AIService: aiService,
 	}
 }
 
@@ -43,30 +48,68 @@ func (ac *AssistantController) Chat(c *gin.Context) {
 		return
 	}
 
+	language, err := userLanguage(ac.DB, userID, req.Language)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	// Get material context if provided
-	context := ""
+	context, sourceLanguage := "", ""
+	var materialID uuid.NullUUID
 	if req.MaterialID != "" {
-		var extractedText string
-		query := `SELECT extracted_text FROM materials WHERE id = $1 AND user_id = $2`
-		err := ac.DB.QueryRow(query, req.MaterialID, userID).Scan(&extractedText)
+		var extractedText, materialLanguage string
+		query := `SELECT id, extracted_text, language FROM materials WHERE id = $1 AND user_id = $2`
+		err := ac.DB.QueryRow(query, req.MaterialID, userID).Scan(&materialID, &extractedText, &materialLanguage)
 		if err == nil {
-			context = extractedText
+			context, sourceLanguage = extractedText, materialLanguage
 		}
 	}
 
 	// Generate AI response
-	response, err := ac.AIService.ChatAssistant(req.Message, context)
+	call := services.CallContext{
+		UserID:     userID.(uuid.UUID),
+		MaterialID: materialID,
+		Feature:    services.FeatureChat,
+	}
+
+	response, prompt, err := ac.AIService.ChatAssistant(call, req.Message, context, sourceLanguage, language)
 	if err != nil {
 		// Fallback response if AI fails
-		response = ac.generateFallbackResponse(req.Message)
+		response = ac.generateFallbackResponse(req.Message, language)
+	}
+
+	chatMessage := models.ChatMessage{
+		ID:             uuid.New(),
+		UserID:         userID.(uuid.UUID),
+		MaterialID:     materialID,
+		Message:        req.Message,
+		Response:       response,
+		Language:       language,
+		PromptTemplate: prompt.Name,
+		PromptVersion:  prompt.Version,
+		CreatedAt:      time.Now(),
+	}
+
+	insertQuery := `INSERT INTO chat_messages (id, user_id, material_id, message, response, language, prompt_template, prompt_version, created_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = ac.DB.Exec(insertQuery,
+		chatMessage.ID, chatMessage.UserID, chatMessage.MaterialID, chatMessage.Message, chatMessage.Response,
+		chatMessage.Language, chatMessage.PromptTemplate, chatMessage.PromptVersion, chatMessage.CreatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chat message"})
+		return
 	}
 
 	c.JSON(http.StatusOK, ChatResponse{
-		Response: response,
+		MessageID: chatMessage.ID,
+		Response:  response,
 	})
 }
 
-func (ac *AssistantController) generateFallbackResponse(message string) string {
+func (ac *AssistantController) generateFallbackResponse(message, language string) string {
 	fallbackResponses := map[string]string{
 		"halo":    "Halo! Saya AI Assistant Quicacademy. Ada yang bisa saya bantu?",
 		"bantuan": "Saya bisa membantu Anda memahami materi pembelajaran. Tanyakan konsep yang ingin dipahami!",
@@ -74,6 +117,15 @@ func (ac *AssistantController) generateFallbackResponse(message string) string {
 		"default": "Maaf, saya sedang mengalami gangguan. Silakan coba lagi nanti atau tanyakan pertanyaan yang lebih spesifik.",
 	}
 
+	if language == services.LanguageEnglish {
+		fallbackResponses = map[string]string{
+			"hello":   "Hello! I'm the Quicacademy AI Assistant. How can I help?",
+			"help":    "I can help you understand your study material. Ask me about any concept you want to understand!",
+			"thanks":  "You're welcome! Happy to help with your studies.",
+			"default": "Sorry, I'm having some trouble right now. Please try again later or ask a more specific question.",
+		}
+	}
+
 	// Simple keyword matching
 	for keyword, response := range fallbackResponses {
 		if keyword != "default" && len(message) > 0 {
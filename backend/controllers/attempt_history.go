@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListQuizAttempts lists the user's attempts at a quiz, newest first, with
+// their scores but without the per-question review
+func (qc *QuizController) ListQuizAttempts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	quizID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	quiz, ok := qc.loadQuizForUser(c, quizID, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	query := `SELECT ` + attemptColumns + `
+			  FROM quiz_attempts
+			  WHERE user_id = $1 AND quiz_id = $2
+			  ORDER BY started_at DESC`
+
+	rows, err := qc.DB.Query(query, userID, quiz.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []gin.H{}
+	var bestScore *int
+	for rows.Next() {
+		attempt, err := scanAttempt(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		attempts = append(attempts, attemptSummary(attempt, quiz))
+		if attempt.Status != models.AttemptInProgress && (bestScore == nil || attempt.Score > *bestScore) {
+			score := attempt.Score
+			bestScore = &score
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quiz_id":      quiz.ID,
+		"attempts":     attempts,
+		"total":        len(attempts),
+		"best_score":   bestScore,
+		"max_attempts": quiz.MaxAttempts,
+	})
+}
+
+// GetAttempt returns one of the user's attempts. A finished attempt comes
+// with its per-question review: the answer given, the correct answer, the
+// explanation and the time spent on each question. An open attempt is
+// returned as its session, without the answer key.
+func (qc *QuizController) GetAttempt(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	attemptID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	attempt, err := getAttempt(qc.DB, attemptID)
+	if err == sql.ErrNoRows || (err == nil && attempt.UserID != userID.(uuid.UUID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	quiz, ok := qc.loadQuizForUser(c, attempt.QuizID, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+	questions := parseQuestions(quiz.Questions)
+
+	now := time.Now()
+	if attempt.Status == models.AttemptInProgress {
+		if !attemptExpired(attempt, quiz.TimeLimit, now) {
+			c.JSON(http.StatusOK, sessionResponse(attempt, quiz, questions, now))
+			return
+		}
+
+		// Its time ran out, review it as it was submitted
+		if !qc.expireAttempt(c, attempt.ID) {
+			return
+		}
+		if attempt, err = getAttempt(qc.DB, attempt.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	response := attemptSummary(attempt, quiz)
+	response["quiz"] = gin.H{
+		"id":            quiz.ID,
+		"title":         quiz.Title,
+		"passing_score": quiz.PassingScore,
+		"adaptive":      quiz.Adaptive,
+	}
+	response["review"] = attemptReview(attempt, questions, attemptResults(attempt))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// attemptSummary describes an attempt and its outcome, counting correct
+// answers from its stored results
+func attemptSummary(attempt models.QuizAttempt, quiz models.Quiz) gin.H {
+	grade := services.SummarizeGrade(attemptResults(attempt), quiz.PassingScore)
+
+	summary := gin.H{
+		"id":             attempt.ID,
+		"quiz_id":        attempt.QuizID,
+		"status":         attempt.Status,
+		"score":          attempt.Score,
+		"passed":         attempt.Passed,
+		"correct":        grade.Correct,
+		"total":          grade.Total,
+		"pending":        grade.Pending,
+		"grading_status": attempt.GradingStatus,
+		"time_spent":     attempt.TimeSpent,
+		"started_at":     attempt.StartedAt,
+		"submitted_at":   attempt.SubmittedAt,
+	}
+
+	if attempt.Ability != nil {
+		summary["ability"] = attempt.Ability
+		summary["standard_error"] = attempt.StandardError
+	}
+
+	return summary
+}
+
+// attemptResults decodes the per-question results stored on an attempt,
+// empty while it is open
+func attemptResults(attempt models.QuizAttempt) []services.QuestionResult {
+	var results []services.QuestionResult
+	json.Unmarshal([]byte(attempt.Results), &results)
+	return results
+}
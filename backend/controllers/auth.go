@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"quicacademy-backend/models"
+	"quicacademy-backend/services"
 	"quicacademy-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -48,17 +49,19 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 	// Create user
 	user := models.User{
-		ID:        uuid.New(),
-		Name:      req.Name,
-		Email:     req.Email,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:                uuid.New(),
+		Name:              req.Name,
+		Email:             req.Email,
+		PreferredLanguage: services.LanguageIndonesian,
+		Role:              models.RoleStudent,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
 	}
 
-	query := `INSERT INTO users (id, name, email, password_hash, created_at, updated_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6)`
-	
-	_, err = ac.DB.Exec(query, user.ID, user.Name, user.Email, hashedPassword, user.CreatedAt, user.UpdatedAt)
+	query := `INSERT INTO users (id, name, email, password_hash, preferred_language, role, created_at, updated_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = ac.DB.Exec(query, user.ID, user.Name, user.Email, hashedPassword, user.PreferredLanguage, user.Role, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
@@ -89,20 +92,20 @@ func (ac *AuthController) Login(c *gin.Context) {
 	// Get user from database
 	var user models.User
 	var hashedPassword string
-	
-	query := `SELECT id, name, email, password_hash, created_at, updated_at 
+
+	query := `SELECT id, name, email, password_hash, preferred_language, role, created_at, updated_at 
 			  FROM users WHERE email = $1`
-	
+
 	err := ac.DB.QueryRow(query, req.Email).Scan(
-		&user.ID, &user.Name, &user.Email, &hashedPassword, 
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Name, &user.Email, &hashedPassword,
+		&user.PreferredLanguage, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
-	
+
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
-	
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -137,17 +140,17 @@ func (ac *AuthController) GetProfile(c *gin.Context) {
 	}
 
 	var user models.User
-	query := `SELECT id, name, email, created_at, updated_at FROM users WHERE id = $1`
-	
+	query := `SELECT id, name, email, preferred_language, role, created_at, updated_at FROM users WHERE id = $1`
+
 	err := ac.DB.QueryRow(query, userID).Scan(
-		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Name, &user.Email, &user.PreferredLanguage, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
-	
+
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -155,3 +158,53 @@ func (ac *AuthController) GetProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+func (ac *AuthController) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	query := `UPDATE users
+			  SET name = COALESCE(NULLIF($1, ''), name),
+				  preferred_language = COALESCE(NULLIF($2, ''), preferred_language),
+				  updated_at = $3
+			  WHERE id = $4
+			  RETURNING id, name, email, preferred_language, role, created_at, updated_at`
+
+	err := ac.DB.QueryRow(query, req.Name, req.PreferredLanguage, time.Now(), userID).Scan(
+		&user.ID, &user.Name, &user.Email, &user.PreferredLanguage, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// userLanguage resolves the output language for a request: an explicit
+// override wins, otherwise the user's preferred language is used
+func userLanguage(db *sql.DB, userID interface{}, override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+
+	var language string
+	err := db.QueryRow(`SELECT preferred_language FROM users WHERE id = $1`, userID).Scan(&language)
+	return language, err
+}
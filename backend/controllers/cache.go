@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"net/http"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CacheController struct {
+	Cache *services.AICache
+}
+
+func NewCacheController(cache *services.AICache) *CacheController {
+	return &CacheController{Cache: cache}
+}
+
+// Invalidate drops cached AI responses by key, material or prompt template,
+// or everything with all=true. Admin only.
+func (cc *CacheController) Invalidate(c *gin.Context) {
+	var req models.CacheInvalidateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var removed int64
+	var err error
+
+	switch {
+	case req.Key != "":
+		removed, err = cc.Cache.Invalidate(req.Key)
+	case req.MaterialID != "":
+		removed, err = cc.Cache.InvalidateMaterial(uuid.MustParse(req.MaterialID))
+	case req.Template != "":
+		removed, err = cc.Cache.InvalidateTemplate(req.Template)
+	case req.All:
+		removed, err = cc.Cache.InvalidateAll()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "One of key, material_id, template or all=true required"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate cache"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OverrideScore lets a teacher replace the score of one question of a
+// finished attempt, typically an essay. Teachers may only score attempts at
+// quizzes on their own materials, admins any attempt.
+func (qc *QuizController) OverrideScore(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	attemptID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	questionID, err := strconv.Atoi(c.Param("questionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question ID"})
+		return
+	}
+
+	var req models.ScoreOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var status string
+	var ownerID uuid.UUID
+	var ability *float64
+	query := `SELECT a.status, a.ability, m.user_id
+			  FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  JOIN materials m ON q.material_id = m.id
+			  WHERE a.id = $1`
+
+	err = qc.DB.QueryRow(query, attemptID).Scan(&status, &ability, &ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Only the material's owner takes its quizzes, so teachers score their own
+	// attempts; guest attempts have no essays to score
+	if c.GetString("role") != models.RoleAdmin && !canAccessMaterial(ownerID, userID.(uuid.UUID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only score attempts at your own quizzes"})
+		return
+	}
+
+	if status == models.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has not been submitted yet"})
+		return
+	}
+
+	// Adaptive attempts are scored by ability, not by points per question
+	if ability != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Adaptive attempts cannot be rescored"})
+		return
+	}
+
+	var updated services.QuestionResult
+	attempt, grade, err := updateAttemptResults(qc.DB, attemptID, func(results []services.QuestionResult, questions map[int]models.Question) error {
+		question, ok := questions[questionID]
+		if !ok {
+			return errQuestionNotFound
+		}
+
+		if max := services.QuestionMaxPoints(question); *req.Points > max {
+			return fmt.Errorf("%w: points must not exceed %g", errInvalidScore, max)
+		}
+
+		for i := range results {
+			if results[i].QuestionID == questionID {
+				services.OverrideScore(&results[i], question, *req.Points, req.Feedback)
+				updated = results[i]
+				return nil
+			}
+		}
+		return errQuestionNotFound
+	})
+
+	switch {
+	case errors.Is(err, errQuestionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	case errors.Is(err, errInvalidScore):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update score"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempt_id":     attempt.ID,
+		"score":          grade.Score,
+		"passed":         grade.Passed,
+		"pending":        grade.Pending,
+		"grading_status": attempt.GradingStatus,
+		"result":         updated,
+	})
+}
+
+var (
+	errQuestionNotFound = errors.New("question not found")
+	errInvalidScore     = errors.New("invalid score")
+)
+
+// scheduleEssayGrading starts a background job grading the pending essays of
+// a finished attempt. It returns nil when there is nothing to grade.
+func (qc *QuizController) scheduleEssayGrading(attempt models.QuizAttempt) *models.Job {
+	if attempt.GradingStatus != models.GradingPending {
+		return nil
+	}
+
+	var materialID uuid.UUID
+	if err := qc.DB.QueryRow(`SELECT material_id FROM quizzes WHERE id = $1`, attempt.QuizID).Scan(&materialID); err != nil {
+		log.Printf("Failed to schedule essay grading for attempt %s: %v", attempt.ID, err)
+		return nil
+	}
+
+	dedupKey := fmt.Sprintf("%s:%s", JobTypeEssayGrading, attempt.ID)
+	job, created, err := enqueueJobWithKey(qc.DB, attempt.UserID, materialID, JobTypeEssayGrading, dedupKey)
+	if err != nil {
+		log.Printf("Failed to schedule essay grading for attempt %s: %v", attempt.ID, err)
+		return nil
+	}
+
+	if created {
+		go runJob(qc.DB, job.ID, func() (uuid.UUID, error) {
+			return attempt.ID, qc.gradeEssays(attempt.ID)
+		})
+	}
+
+	return &job
+}
+
+// ResumeEssayGrading schedules grading for every attempt still pending, e.g.
+// because the server restarted while grading
+func (qc *QuizController) ResumeEssayGrading() error {
+	rows, err := qc.DB.Query(`SELECT `+attemptColumns+` FROM quiz_attempts WHERE grading_status = $1`, models.GradingPending)
+	if err != nil {
+		return err
+	}
+
+	var attempts []models.QuizAttempt
+	for rows.Next() {
+		attempt, err := scanAttempt(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		attempts = append(attempts, attempt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, attempt := range attempts {
+		qc.scheduleEssayGrading(attempt)
+	}
+	return nil
+}
+
+// gradeEssays asks the AI to grade every pending essay of an attempt. Each
+// essay is saved as soon as it is graded; essays that fail stay pending and
+// the last error is returned.
+func (qc *QuizController) gradeEssays(attemptID uuid.UUID) error {
+	var attempt models.QuizAttempt
+	var quiz models.Quiz
+	var material models.Material
+
+	query := `SELECT a.user_id, a.results, a.question_order, a.questions, q.questions, q.language, m.id, m.extracted_text
+			  FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  JOIN materials m ON q.material_id = m.id
+			  WHERE a.id = $1`
+
+	err := qc.DB.QueryRow(query, attemptID).Scan(
+		&attempt.UserID, &attempt.Results, &attempt.QuestionOrder, &attempt.Questions,
+		&quiz.Questions, &quiz.Language, &material.ID, &material.ExtractedText,
+	)
+	if err != nil {
+		return err
+	}
+
+	var results []services.QuestionResult
+	if err := json.Unmarshal([]byte(attempt.Results), &results); err != nil {
+		return err
+	}
+
+	questions := map[int]models.Question{}
+	for _, question := range attemptQuestions(attempt, parseQuestions(quiz.Questions)) {
+		questions[question.ID] = question
+	}
+
+	call := services.CallContext{
+		UserID:     attempt.UserID,
+		MaterialID: uuid.NullUUID{UUID: material.ID, Valid: true},
+		Feature:    services.FeatureEssayGrading,
+	}
+
+	var lastErr error
+	for _, result := range results {
+		question, ok := questions[result.QuestionID]
+		if !result.Pending || !ok {
+			continue
+		}
+
+		essay, _, err := qc.AIService.GradeEssay(call, question, strings.Join(result.Answer, "\n"), material.ExtractedText, quiz.Language)
+		if err != nil {
+			lastErr = fmt.Errorf("question %d: %w", question.ID, err)
+			continue
+		}
+
+		_, _, err = updateAttemptResults(qc.DB, attemptID, func(results []services.QuestionResult, _ map[int]models.Question) error {
+			for i := range results {
+				// A teacher may have scored it in the meantime
+				if results[i].QuestionID == question.ID && results[i].Pending {
+					services.ApplyEssayScores(&results[i], question, essay.Criteria, essay.Feedback)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			lastErr = fmt.Errorf("question %d: %w", question.ID, err)
+		}
+	}
+
+	return lastErr
+}
+
+// updateAttemptResults changes the per-question results of a finished attempt
+// under a row lock and recomputes its score, passed flag and grading status
+func updateAttemptResults(db *sql.DB, attemptID uuid.UUID, update func(results []services.QuestionResult, questions map[int]models.Question) error) (models.QuizAttempt, services.GradeResult, error) {
+	var grade services.GradeResult
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.QuizAttempt{}, grade, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + prefixedAttemptColumns + `, q.material_id, q.questions, q.passing_score
+			  FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  WHERE a.id = $1
+			  FOR UPDATE OF a`
+
+	var quiz models.Quiz
+	attempt, err := scanAttempt(tx.QueryRow(query, attemptID), &quiz.MaterialID, &quiz.Questions, &quiz.PassingScore)
+	if err != nil {
+		return attempt, grade, err
+	}
+
+	var results []services.QuestionResult
+	if err := json.Unmarshal([]byte(attempt.Results), &results); err != nil {
+		return attempt, grade, err
+	}
+
+	presented := attemptQuestions(attempt, parseQuestions(quiz.Questions))
+	questions := map[int]models.Question{}
+	for _, question := range presented {
+		questions[question.ID] = question
+	}
+
+	if err := update(results, questions); err != nil {
+		return attempt, grade, err
+	}
+
+	grade = services.SummarizeGrade(results, quiz.PassingScore)
+	resultsJSON, _ := json.Marshal(grade.Results)
+
+	attempt.Results = string(resultsJSON)
+	attempt.Score = grade.Score
+	attempt.Passed = grade.Passed
+	attempt.GradingStatus = gradingStatus(grade)
+
+	updateQuery := `UPDATE quiz_attempts SET results = $1, score = $2, passed = $3, grading_status = $4 WHERE id = $5`
+	_, err = tx.Exec(updateQuery, attempt.Results, attempt.Score, attempt.Passed, attempt.GradingStatus, attempt.ID)
+	if err != nil {
+		return attempt, grade, err
+	}
+
+	if err := refreshBestScore(tx, attempt.UserID, quiz.MaterialID); err != nil {
+		return attempt, grade, err
+	}
+
+	if err := recordOutcomes(tx, attempt, quiz.MaterialID, presented, grade.Results); err != nil {
+		return attempt, grade, err
+	}
+
+	return attempt, grade, tx.Commit()
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export formats for summaries
+const (
+	ExportPDF      = "pdf"
+	ExportMarkdown = "md"
+	ExportDOCX     = "docx"
+)
+
+// ExportSummary exports a material's active summary, or the version given,
+// as a PDF, Markdown or Word document rendered from the same template
+func (sc *SummaryController) ExportSummary(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID := c.Param("id")
+	if materialID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Material ID required"})
+		return
+	}
+
+	var req models.SummaryExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT ` + prefixedSummaryColumns + `, m.title, m.subject
+			  FROM summaries s
+			  JOIN materials m ON s.material_id = m.id
+			  WHERE m.id = $1 AND m.user_id = $2 AND s.is_active`
+	args := []interface{}{materialID, userID}
+	if req.Version > 0 {
+		query = `SELECT ` + prefixedSummaryColumns + `, m.title, m.subject
+				 FROM summaries s
+				 JOIN materials m ON s.material_id = m.id
+				 WHERE m.id = $1 AND m.user_id = $2 AND s.version = $3`
+		args = append(args, req.Version)
+	}
+
+	var materialTitle, materialSubject string
+	summary, err := scanSummary(sc.DB.QueryRow(query, args...), &materialTitle, &materialSubject)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	doc := services.NewSummaryDocument(materialTitle, materialSubject, summary)
+	fileName := materialTitle + "-summary"
+
+	switch req.Format {
+	case ExportMarkdown:
+		sendDownload(c, exportFileName(fileName, ExportMarkdown), "text/markdown; charset=utf-8", services.RenderSummaryMarkdown(doc))
+
+	case ExportDOCX:
+		data, err := services.RenderSummaryDOCX(doc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export"})
+			return
+		}
+		sendDownload(c, exportFileName(fileName, ExportDOCX), "application/vnd.openxmlformats-officedocument.wordprocessingml.document", data)
+
+	default:
+		sendDownload(c, exportFileName(fileName, ExportPDF), "application/pdf", services.RenderSummaryPDF(doc, time.Now()))
+	}
+}
+
+// sendDownload responds with data as a file attachment
+func sendDownload(c *gin.Context, fileName, contentType string, data []byte) {
+	c.Header("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// exportFileName turns a title into a safe file name with extension ext
+func exportFileName(title, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return r
+		}
+		return '-'
+	}, title)
+
+	name = strings.Trim(name, "-")
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	if name == "" {
+		name = "export"
+	}
+	return name + "." + ext
+}
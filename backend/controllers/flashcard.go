@@ -0,0 +1,651 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultDueReviewsLimit caps the due cards returned when no limit is given
+const defaultDueReviewsLimit = 100
+
+type FlashcardController struct {
+	DB        *sql.DB
+	AIService *services.OpenRouterService
+}
+
+func NewFlashcardController(db *sql.DB, aiService *services.OpenRouterService) *FlashcardController {
+	return &FlashcardController{
+		DB:        db,
+		AIService: aiService,
+	}
+}
+
+const flashcardColumns = `id, deck_id, front, back, concept, position, ease_factor, interval_days, repetitions, lapses, due_at, last_reviewed_at, created_at, updated_at`
+
+const prefixedFlashcardColumns = `c.id, c.deck_id, c.front, c.back, c.concept, c.position, c.ease_factor, c.interval_days, c.repetitions, c.lapses, c.due_at, c.last_reviewed_at, c.created_at, c.updated_at`
+
+// scanFlashcard scans a row selected with flashcardColumns, followed by any
+// extra destinations the query selects after them
+func scanFlashcard(row rowScanner, extra ...interface{}) (models.Flashcard, error) {
+	var card models.Flashcard
+	dest := []interface{}{
+		&card.ID, &card.DeckID, &card.Front, &card.Back, &card.Concept, &card.Position, &card.EaseFactor, &card.IntervalDays,
+		&card.Repetitions, &card.Lapses, &card.DueAt, &card.LastReviewedAt, &card.CreatedAt, &card.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return card, err
+}
+
+// GenerateDeck generates a flashcard deck from the material's active summary
+// as a background job. The job's result is the new deck.
+func (fc *FlashcardController) GenerateDeck(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var req models.FlashcardGenerateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The body is optional, an empty one keeps the defaults
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var material models.Material
+	err = fc.DB.QueryRow(`SELECT id, user_id, title, subject FROM materials WHERE id = $1`, materialID).Scan(
+		&material.ID, &material.UserID, &material.Title, &material.Subject,
+	)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(material.UserID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var summary models.Summary
+	err = fc.DB.QueryRow(`SELECT bullet_points, concepts, language FROM summaries WHERE material_id = $1 AND is_active`, material.ID).Scan(
+		&summary.BulletPoints, &summary.Concepts, &summary.Language,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Generate a summary of the material first"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	req.Language, err = userLanguage(fc.DB, userID, req.Language)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	dedupKey := fmt.Sprintf("%s:%s:%s", JobTypeFlashcards, material.ID, requestKey(req))
+	job, created, err := enqueueJobWithKey(fc.DB, userID.(uuid.UUID), material.ID, JobTypeFlashcards, dedupKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue flashcard generation"})
+		return
+	}
+
+	if created {
+		go runJob(fc.DB, job.ID, func() (uuid.UUID, error) {
+			return fc.createDeck(userID.(uuid.UUID), material, summary, req)
+		})
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job": job,
+		"material": gin.H{
+			"id":      material.ID,
+			"title":   material.Title,
+			"subject": material.Subject,
+		},
+	})
+}
+
+// createDeck writes the cards of a new deck from the summary, in the
+// request's already resolved language, and saves the deck with every card
+// due right away
+func (fc *FlashcardController) createDeck(userID uuid.UUID, material models.Material, summary models.Summary, req models.FlashcardGenerateRequest) (uuid.UUID, error) {
+	call := services.CallContext{
+		UserID:     userID,
+		MaterialID: uuid.NullUUID{UUID: material.ID, Valid: true},
+		Feature:    services.FeatureFlashcards,
+	}
+
+	count := req.CardCount
+	if count == 0 {
+		count = services.DefaultFlashcardCount
+	}
+
+	cards, prompt, err := fc.AIService.GenerateFlashcards(call, material.Subject, summary.BulletPoints, summary.Concepts, summary.Language, req.Language, count)
+	if err != nil || len(cards) == 0 {
+		// Fall back to a card per concept of the summary
+		cards, prompt = services.ConceptFlashcards(summary.Concepts), services.PromptRef{}
+	}
+	if len(cards) == 0 {
+		return uuid.Nil, fmt.Errorf("no flashcards could be made from the summary")
+	}
+	if len(cards) > count {
+		cards = cards[:count]
+	}
+
+	title := req.Title
+	if title == "" {
+		title = "Flashcards: " + material.Title
+	}
+
+	tx, err := fc.DB.Begin()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save deck: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	deckID := uuid.New()
+	deckQuery := `INSERT INTO flashcard_decks (id, material_id, user_id, title, language, prompt_template, prompt_version, created_at, updated_at)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)`
+
+	_, err = tx.Exec(deckQuery, deckID, material.ID, userID, title, req.Language, prompt.Name, prompt.Version, now)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save deck: %w", err)
+	}
+
+	for i, card := range cards {
+		if err := insertFlashcard(tx, deckID, card.Front, card.Back, card.Concept, i, now); err != nil {
+			return uuid.Nil, fmt.Errorf("failed to save flashcards: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save deck: %w", err)
+	}
+
+	return deckID, nil
+}
+
+// insertFlashcard adds a new card, due at now, to a deck
+func insertFlashcard(db services.Execer, deckID uuid.UUID, front, back, concept string, position int, now time.Time) error {
+	query := `INSERT INTO flashcards (id, deck_id, front, back, concept, position, ease_factor, due_at, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $8)`
+
+	_, err := db.Exec(query, uuid.New(), deckID, front, back, concept, position, services.InitialEaseFactor, now)
+	return err
+}
+
+// ListMaterialDecks lists the user's flashcard decks of a material, newest
+// first, with how many of their cards are due
+func (fc *FlashcardController) ListMaterialDecks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = fc.DB.QueryRow(`SELECT user_id FROM materials WHERE id = $1`, materialID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := `SELECT d.id, d.material_id, d.user_id, d.title, d.language, d.prompt_template, d.prompt_version, d.created_at, d.updated_at,
+					 COUNT(c.id), COUNT(c.id) FILTER (WHERE c.due_at <= $3)
+			  FROM flashcard_decks d
+			  LEFT JOIN flashcards c ON c.deck_id = d.id
+			  WHERE d.material_id = $1 AND d.user_id = $2
+			  GROUP BY d.id
+			  ORDER BY d.created_at DESC`
+
+	rows, err := fc.DB.Query(query, materialID, userID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	decks := []models.FlashcardDeck{}
+	for rows.Next() {
+		deck, err := scanDeck(rows, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		decks = append(decks, deck)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"decks": decks, "total": len(decks)})
+}
+
+// scanDeck scans a deck row, followed by its card and due counts when
+// counted is set
+func scanDeck(row rowScanner, counted bool) (models.FlashcardDeck, error) {
+	var deck models.FlashcardDeck
+	dest := []interface{}{
+		&deck.ID, &deck.MaterialID, &deck.UserID, &deck.Title, &deck.Language, &deck.PromptTemplate, &deck.PromptVersion,
+		&deck.CreatedAt, &deck.UpdatedAt,
+	}
+	if counted {
+		dest = append(dest, &deck.CardCount, &deck.DueCount)
+	}
+	err := row.Scan(dest...)
+	return deck, err
+}
+
+// loadDeck fetches a deck of the user, responding with an error and
+// returning false when it can't
+func (fc *FlashcardController) loadDeck(c *gin.Context, userID uuid.UUID) (models.FlashcardDeck, bool) {
+	deckID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deck ID"})
+		return models.FlashcardDeck{}, false
+	}
+
+	query := `SELECT id, material_id, user_id, title, language, prompt_template, prompt_version, created_at, updated_at
+			  FROM flashcard_decks WHERE id = $1`
+
+	deck, err := scanDeck(fc.DB.QueryRow(query, deckID), false)
+	if err == sql.ErrNoRows || (err == nil && deck.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deck not found"})
+		return models.FlashcardDeck{}, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return models.FlashcardDeck{}, false
+	}
+
+	return deck, true
+}
+
+// GetDeck returns a deck with all its cards in order
+func (fc *FlashcardController) GetDeck(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	deck, ok := fc.loadDeck(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	rows, err := fc.DB.Query(`SELECT `+flashcardColumns+` FROM flashcards WHERE deck_id = $1 ORDER BY position, created_at`, deck.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	cards := []models.Flashcard{}
+	for rows.Next() {
+		card, err := scanFlashcard(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		cards = append(cards, card)
+		if !card.DueAt.After(now) {
+			deck.DueCount++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	deck.CardCount = len(cards)
+
+	c.JSON(http.StatusOK, gin.H{"deck": deck, "cards": cards})
+}
+
+// UpdateDeck renames a deck
+func (fc *FlashcardController) UpdateDeck(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.FlashcardDeckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deck, ok := fc.loadDeck(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	deck.Title, deck.UpdatedAt = req.Title, time.Now()
+	_, err := fc.DB.Exec(`UPDATE flashcard_decks SET title = $1, updated_at = $2 WHERE id = $3`, deck.Title, deck.UpdatedAt, deck.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update deck"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deck": deck})
+}
+
+// DeleteDeck deletes a deck with its cards and their review history
+func (fc *FlashcardController) DeleteDeck(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	deck, ok := fc.loadDeck(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	if _, err := fc.DB.Exec(`DELETE FROM flashcard_decks WHERE id = $1`, deck.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete deck"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deck deleted"})
+}
+
+// AddCard adds a card to the end of a deck, due right away
+func (fc *FlashcardController) AddCard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.FlashcardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deck, ok := fc.loadDeck(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	query := `INSERT INTO flashcards (id, deck_id, front, back, concept, position, ease_factor, due_at, created_at, updated_at)
+			  SELECT $1, $2, $3, $4, $5, COALESCE(MAX(position) + 1, 0), $6, $7, $7, $7
+			  FROM flashcards WHERE deck_id = $2
+			  RETURNING ` + flashcardColumns
+
+	card, err := scanFlashcard(fc.DB.QueryRow(query,
+		uuid.New(), deck.ID, req.Front, req.Back, req.Concept, services.InitialEaseFactor, time.Now(),
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add flashcard"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"card": card})
+}
+
+// loadCard fetches a card of one of the user's decks with the material of
+// its deck, responding with an error and returning false when it can't
+func (fc *FlashcardController) loadCard(c *gin.Context, userID uuid.UUID) (models.Flashcard, uuid.UUID, bool) {
+	cardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid flashcard ID"})
+		return models.Flashcard{}, uuid.Nil, false
+	}
+
+	query := `SELECT ` + prefixedFlashcardColumns + `, d.user_id, d.material_id
+			  FROM flashcards c
+			  JOIN flashcard_decks d ON c.deck_id = d.id
+			  WHERE c.id = $1`
+
+	var ownerID, materialID uuid.UUID
+	card, err := scanFlashcard(fc.DB.QueryRow(query, cardID), &ownerID, &materialID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flashcard not found"})
+		return models.Flashcard{}, uuid.Nil, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return models.Flashcard{}, uuid.Nil, false
+	}
+
+	return card, materialID, true
+}
+
+// UpdateCard edits the sides and concept of a card, keeping its schedule
+func (fc *FlashcardController) UpdateCard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.FlashcardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, _, ok := fc.loadCard(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	card.Front, card.Back, card.Concept, card.UpdatedAt = req.Front, req.Back, req.Concept, time.Now()
+	_, err := fc.DB.Exec(`UPDATE flashcards SET front = $1, back = $2, concept = $3, updated_at = $4 WHERE id = $5`,
+		card.Front, card.Back, card.Concept, card.UpdatedAt, card.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update flashcard"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"card": card})
+}
+
+// DeleteCard removes a card from its deck
+func (fc *FlashcardController) DeleteCard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	card, _, ok := fc.loadCard(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	if _, err := fc.DB.Exec(`DELETE FROM flashcards WHERE id = $1`, card.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete flashcard"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Flashcard deleted"})
+}
+
+// ReviewCard records how well the user recalled a card and schedules its
+// next review with SM-2
+func (fc *FlashcardController) ReviewCard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.FlashcardReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, materialID, ok := fc.loadCard(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	schedule := services.ScheduleReview(services.ReviewSchedule{
+		EaseFactor:   card.EaseFactor,
+		IntervalDays: card.IntervalDays,
+		Repetitions:  card.Repetitions,
+		Lapses:       card.Lapses,
+	}, *req.Grade)
+
+	now := time.Now()
+	card.EaseFactor, card.IntervalDays = schedule.EaseFactor, schedule.IntervalDays
+	card.Repetitions, card.Lapses = schedule.Repetitions, schedule.Lapses
+	card.DueAt, card.LastReviewedAt = schedule.DueAt(now), &now
+
+	tx, err := fc.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record review"})
+		return
+	}
+	defer tx.Rollback()
+
+	updateQuery := `UPDATE flashcards
+					SET ease_factor = $1, interval_days = $2, repetitions = $3, lapses = $4, due_at = $5, last_reviewed_at = $6
+					WHERE id = $7`
+
+	_, err = tx.Exec(updateQuery, card.EaseFactor, card.IntervalDays, card.Repetitions, card.Lapses, card.DueAt, now, card.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record review"})
+		return
+	}
+
+	reviewQuery := `INSERT INTO flashcard_reviews (id, flashcard_id, user_id, grade, ease_factor, interval_days, reviewed_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.Exec(reviewQuery, uuid.New(), card.ID, userID, *req.Grade, card.EaseFactor, card.IntervalDays, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record review"})
+		return
+	}
+
+	err = services.LogActivity(tx, userID.(uuid.UUID), uuid.NullUUID{UUID: materialID, Valid: true}, models.ActivityFlashcardReview, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record review"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"card": card})
+}
+
+// GetDueReviews lists the user's cards due by the end of today in the
+// requested timezone across all their materials, most overdue first
+func (fc *FlashcardController) GetDueReviews(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.DueReviewsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc, err := requestLocation(req.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultDueReviewsLimit
+	}
+
+	// Due times are stored in server time
+	now := time.Now().In(loc)
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc).In(time.Local)
+
+	query := `SELECT ` + prefixedFlashcardColumns + `, d.title, m.id, m.title, COUNT(*) OVER ()
+			  FROM flashcards c
+			  JOIN flashcard_decks d ON c.deck_id = d.id
+			  JOIN materials m ON d.material_id = m.id
+			  WHERE d.user_id = $1 AND c.due_at < $2
+			  ORDER BY c.due_at, c.position
+			  LIMIT $3`
+
+	rows, err := fc.DB.Query(query, userID, endOfDay, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	cards := []models.DueFlashcard{}
+	total := 0
+	for rows.Next() {
+		var due models.DueFlashcard
+		due.Flashcard, err = scanFlashcard(rows, &due.DeckTitle, &due.MaterialID, &due.MaterialTitle, &total)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		cards = append(cards, due)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cards":    cards,
+		"total":    total,
+		"timezone": loc.String(),
+	})
+}
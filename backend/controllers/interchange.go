@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxImportedQuestions limits the questions of an imported quiz
+const maxImportedQuestions = 500
+
+// SkippedQuestionsHeader lists the IDs of the questions an export left out
+// because its format cannot represent them
+const SkippedQuestionsHeader = "X-Skipped-Questions"
+
+// interchangeFiles are the extension and content type of each question
+// interchange format
+var interchangeFiles = map[string]struct {
+	ext         string
+	contentType string
+}{
+	services.InterchangeMoodle: {"xml", "application/xml; charset=utf-8"},
+	services.InterchangeGIFT:   {"txt", "text/plain; charset=utf-8"},
+	services.InterchangeQTI:    {"zip", "application/zip"},
+}
+
+// ExportQuiz exports a quiz's questions with their answers, for Anki or as
+// Moodle XML, GIFT or a QTI 2.1 package. As it reveals the answer key, only
+// the owner of the quiz's material may export it, as a teacher or admin not
+// taking the quiz.
+func (qc *QuizController) ExportQuiz(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	quizID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	var req models.QuizExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT q.id, q.material_id, q.title, q.questions, q.language, m.user_id
+			  FROM quizzes q
+			  JOIN materials m ON q.material_id = m.id
+			  WHERE q.id = $1`
+
+	var quiz models.Quiz
+	var ownerID uuid.UUID
+	err = qc.DB.QueryRow(query, quizID).Scan(&quiz.ID, &quiz.MaterialID, &quiz.Title, &quiz.Questions, &quiz.Language, &ownerID)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !qc.requireAnswerKeyAccess(c, userID.(uuid.UUID), quiz.MaterialID) {
+		return
+	}
+
+	questions := parseQuestions(quiz.Questions)
+	if _, ok := interchangeFiles[req.Format]; ok {
+		sendInterchangeExport(c, req.Format, quiz.Title, questions)
+		return
+	}
+
+	notes := services.QuestionNotes(quiz.ID.String(), questions, quiz.Language)
+	sendAnkiExport(c, req.Format, quiz.Title, notes)
+}
+
+// ExportQuestionBank exports every question in a material's bank as Moodle
+// XML, GIFT or a QTI 2.1 package, with the same access as GetQuestionBank
+func (qc *QuizController) ExportQuestionBank(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var req models.QuestionBankExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var title string
+	var ownerID uuid.UUID
+	err = qc.DB.QueryRow(`SELECT title, user_id FROM materials WHERE id = $1`, materialID).Scan(&title, &ownerID)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !qc.requireAnswerKeyAccess(c, userID.(uuid.UUID), materialID) {
+		return
+	}
+
+	questions, err := bankQuestions(qc.DB, materialID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if len(questions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The question bank is empty"})
+		return
+	}
+
+	// Banked questions keep the IDs they had in their quizzes, which repeat
+	for i := range questions {
+		questions[i].ID = i + 1
+	}
+
+	sendInterchangeExport(c, req.Format, title, questions)
+}
+
+// ImportQuiz creates a quiz for a material from a Moodle XML, GIFT or QTI
+// 2.1 file uploaded as file, and adds its questions to the material's
+// question bank. Items that can't be imported are reported with why.
+func (qc *QuizController) ImportQuiz(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var req models.QuizImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var material models.Material
+	query := `SELECT id, title FROM materials WHERE id = $1 AND user_id = $2`
+	err = qc.DB.QueryRow(query, materialID, userID).Scan(&material.ID, &material.Title)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	format := req.Format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+		case ".xml":
+			format = services.InterchangeMoodle
+		case ".gift", ".txt":
+			format = services.InterchangeGIFT
+		case ".zip":
+			format = services.InterchangeQTI
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File type not supported, upload a .xml, .gift, .txt or .zip file or give the format"})
+			return
+		}
+	}
+
+	if fileHeader.Size > maxImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File size too large"})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	questions, importErrors, err := services.ImportQuestions(format, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(questions) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "The file has no question that can be imported",
+			"errors": importErrors,
+		})
+		return
+	}
+
+	if len(questions) > maxImportedQuestions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d questions can be imported at once", maxImportedQuestions)})
+		return
+	}
+
+	language, err := userLanguage(qc.DB, userID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for i := range questions {
+		bankID := uuid.New()
+		questions[i].BankID = &bankID
+	}
+
+	questionsJSON, err := json.Marshal(questions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import quiz"})
+		return
+	}
+
+	title := req.Title
+	if title == "" {
+		title = "Quiz: " + material.Title
+	}
+
+	newQuiz := models.Quiz{
+		ID:                  uuid.New(),
+		MaterialID:          material.ID,
+		Title:               title,
+		Questions:           string(questionsJSON),
+		TimeLimit:           defaultQuizTimeLimit,
+		PassingScore:        defaultQuizPassingScore,
+		Language:            language,
+		TargetStandardError: defaultTargetStandardError,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+
+	tx, err := qc.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import quiz"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := insertQuiz(tx, newQuiz); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import quiz"})
+		return
+	}
+
+	if err := addToQuestionBank(tx, material.ID, newQuiz.ID, questions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import quiz"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import quiz"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Quiz imported",
+		"quiz_id":  newQuiz.ID,
+		"imported": len(questions),
+		"errors":   importErrors,
+	})
+}
+
+// sendInterchangeExport responds with questions as a download in an
+// interchange format, listing the questions it leaves out in the
+// X-Skipped-Questions header
+func sendInterchangeExport(c *gin.Context, format, title string, questions []models.Question) {
+	data, skipped, err := services.ExportQuestions(format, title, questions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export"})
+		return
+	}
+
+	if len(skipped) > 0 {
+		ids := make([]string, len(skipped))
+		for i, id := range skipped {
+			ids[i] = strconv.Itoa(id)
+		}
+		c.Header(SkippedQuestionsHeader, strings.Join(ids, ","))
+	}
+
+	file := interchangeFiles[format]
+	sendDownload(c, exportFileName(title, file.ext), file.contentType, data)
+}
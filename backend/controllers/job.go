@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"quicacademy-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	JobTypeSummary = "summary"
+	JobTypeQuiz    = "quiz"
+
+	JobTypeEssayGrading = "essay_grading"
+	JobTypeFlashcards   = "flashcards"
+
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+// Running jobs touch updated_at every jobHeartbeatInterval. A job that has
+// not been touched for jobStaleAfter lost the process running it.
+const (
+	jobHeartbeatInterval = 30 * time.Second
+	jobStaleAfter        = 5 * time.Minute
+)
+
+type JobController struct {
+	DB *sql.DB
+}
+
+func NewJobController(db *sql.DB) *JobController {
+	return &JobController{DB: db}
+}
+
+func (jc *JobController) GetJob(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := getJob(jc.DB, jobID)
+	if err == sql.ErrNoRows || (err == nil && job.UserID != userID.(uuid.UUID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+func getJob(db *sql.DB, jobID uuid.UUID) (models.Job, error) {
+	var job models.Job
+	var jobError sql.NullString
+
+	query := `SELECT id, user_id, material_id, type, status, result_id, error, created_at, updated_at
+			  FROM jobs WHERE id = $1`
+	err := db.QueryRow(query, jobID).Scan(
+		&job.ID, &job.UserID, &job.MaterialID, &job.Type, &job.Status,
+		&job.ResultID, &jobError, &job.CreatedAt, &job.UpdatedAt,
+	)
+	job.Error = jobError.String
+
+	return job, err
+}
+
+// enqueueJob creates a pending job for the material unless one with the same
+// type is already pending or running, in which case that job is returned and
+// created is false. The partial unique index on jobs.dedup_key makes this safe
+// against concurrent requests.
+func enqueueJob(db *sql.DB, userID, materialID uuid.UUID, jobType string) (job models.Job, created bool, err error) {
+	return enqueueJobWithKey(db, userID, materialID, jobType, fmt.Sprintf("%s:%s", jobType, materialID))
+}
+
+// enqueueJobWithKey is enqueueJob for jobs that are deduplicated by something
+// other than their material, such as a quiz attempt
+func enqueueJobWithKey(db *sql.DB, userID, materialID uuid.UUID, jobType, dedupKey string) (job models.Job, created bool, err error) {
+	job = models.Job{
+		ID:         uuid.New(),
+		UserID:     userID,
+		MaterialID: materialID,
+		Type:       jobType,
+		Status:     JobStatusPending,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	insertQuery := `INSERT INTO jobs (id, user_id, material_id, type, status, dedup_key, created_at, updated_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+					ON CONFLICT (dedup_key) WHERE status IN ('pending', 'running') DO NOTHING`
+
+	result, err := db.Exec(insertQuery,
+		job.ID, job.UserID, job.MaterialID, job.Type, job.Status, dedupKey, job.CreatedAt, job.UpdatedAt,
+	)
+	if err != nil {
+		return models.Job{}, false, err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 1 {
+		return job, true, nil
+	}
+
+	// Another request won the race, hand back the job that is already active
+	var existingID uuid.UUID
+	activeQuery := `SELECT id FROM jobs WHERE dedup_key = $1 AND status IN ('pending', 'running')`
+	if err := db.QueryRow(activeQuery, dedupKey).Scan(&existingID); err != nil {
+		return models.Job{}, false, err
+	}
+
+	job, err = getJob(db, existingID)
+	return job, false, err
+}
+
+// runJob executes work in the background and records its outcome on the job
+// row. work returns the ID of the row it produced (summary, quiz, ...).
+func runJob(db *sql.DB, jobID uuid.UUID, work func() (uuid.UUID, error)) {
+	updateQuery := `UPDATE jobs SET status = $1, updated_at = $2 WHERE id = $3`
+	if _, err := db.Exec(updateQuery, JobStatusRunning, time.Now(), jobID); err != nil {
+		log.Printf("Failed to mark job %s as running: %v", jobID, err)
+	}
+
+	// Other instances tell live jobs from interrupted ones by their heartbeat
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				heartbeatQuery := `UPDATE jobs SET updated_at = $1 WHERE id = $2 AND status = $3`
+				if _, err := db.Exec(heartbeatQuery, time.Now(), jobID, JobStatusRunning); err != nil {
+					log.Printf("Failed to record heartbeat of job %s: %v", jobID, err)
+				}
+			}
+		}
+	}()
+
+	resultID, err := func() (resultID uuid.UUID, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return work()
+	}()
+
+	if err != nil {
+		log.Printf("Job %s failed: %v", jobID, err)
+		failQuery := `UPDATE jobs SET status = $1, error = $2, updated_at = $3 WHERE id = $4`
+		if _, dbErr := db.Exec(failQuery, JobStatusFailed, err.Error(), time.Now(), jobID); dbErr != nil {
+			log.Printf("Failed to mark job %s as failed: %v", jobID, dbErr)
+		}
+		return
+	}
+
+	completeQuery := `UPDATE jobs SET status = $1, result_id = $2, updated_at = $3 WHERE id = $4`
+	if _, err := db.Exec(completeQuery, JobStatusCompleted, resultID, time.Now(), jobID); err != nil {
+		log.Printf("Failed to mark job %s as completed: %v", jobID, err)
+	}
+}
+
+// ResetInterruptedJobs fails jobs left pending or running by a process that
+// stopped, otherwise they would block new jobs for the same material forever.
+// Jobs of other live instances keep their heartbeat fresh and are left alone.
+// It returns the number of jobs failed.
+func ResetInterruptedJobs(db *sql.DB) (int64, error) {
+	query := `UPDATE jobs SET status = $1, error = $2, updated_at = $3
+			  WHERE status IN ('pending', 'running') AND updated_at < $4`
+	now := time.Now()
+	result, err := db.Exec(query, JobStatusFailed, "interrupted by server restart", now, now.Add(-jobStaleAfter))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
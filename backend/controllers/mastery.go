@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetMasteryMap returns the user's mastery of every concept of a material:
+// the concepts of its summary and any other concept its quizzes tested,
+// weakest first, and the practiced concepts worth reviewing
+func (pc *ProgressController) GetMasteryMap(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var material models.Material
+	err = pc.DB.QueryRow(`SELECT id, user_id, title, subject FROM materials WHERE id = $1`, materialID).Scan(
+		&material.ID, &material.UserID, &material.Title, &material.Subject,
+	)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(material.UserID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	summaryConcepts, err := materialConcepts(pc.DB, material.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := `SELECT concept, mastery, responses, last_practiced_at
+			  FROM concept_mastery
+			  WHERE user_id = $1 AND material_id = $2`
+
+	rows, err := pc.DB.Query(query, userID, material.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	// Concepts are matched ignoring case, the summary's spelling wins
+	concepts := []models.ConceptMastery{}
+	index := map[string]int{}
+	for _, name := range summaryConcepts {
+		index[strings.ToLower(name)] = len(concepts)
+		concepts = append(concepts, models.ConceptMastery{Concept: name, Mastery: services.DefaultBKT.Init})
+	}
+
+	for rows.Next() {
+		var mastery models.ConceptMastery
+		if err := rows.Scan(&mastery.Concept, &mastery.Mastery, &mastery.Responses, &mastery.LastPracticedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if i, ok := index[strings.ToLower(mastery.Concept)]; ok {
+			mastery.Concept = concepts[i].Concept
+			concepts[i] = mastery
+			continue
+		}
+		index[strings.ToLower(mastery.Concept)] = len(concepts)
+		concepts = append(concepts, mastery)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	toReview := []string{}
+	for i := range concepts {
+		concepts[i].Level = services.MasteryLevel(concepts[i].Mastery, concepts[i].Responses)
+	}
+
+	// Practiced concepts weakest first, then the ones not practiced yet
+	sort.SliceStable(concepts, func(i, j int) bool {
+		if (concepts[i].Responses == 0) != (concepts[j].Responses == 0) {
+			return concepts[j].Responses == 0
+		}
+		return concepts[i].Mastery < concepts[j].Mastery
+	})
+
+	for _, concept := range concepts {
+		if concept.Level == services.MasteryNeedsReview || concept.Level == services.MasteryLearning {
+			toReview = append(toReview, concept.Concept)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"material": gin.H{
+			"id":      material.ID,
+			"title":   material.Title,
+			"subject": material.Subject,
+		},
+		"concepts":  concepts,
+		"to_review": toReview,
+	})
+}
+
+// materialConcepts returns the concept names of the material's active
+// summary, none when it has no summary yet
+func materialConcepts(db *sql.DB, materialID uuid.UUID) ([]string, error) {
+	var concepts string
+	err := db.QueryRow(`SELECT concepts FROM summaries WHERE material_id = $1 AND is_active`, materialID).Scan(&concepts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return services.ParseConcepts(concepts), nil
+}
+
+// recordOutcomes saves the graded results of a finished attempt per concept
+// their question tests and traces the mastery of those concepts again, in
+// the transaction that graded it. Essays still being graded are recorded
+// once they are; a changed score replaces the recorded one.
+func recordOutcomes(tx *sql.Tx, attempt models.QuizAttempt, materialID uuid.UUID, questions []models.Question, results []services.QuestionResult) error {
+	byID := make(map[int]models.Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+
+	answeredAt := attempt.CreatedAt
+	if attempt.SubmittedAt != nil {
+		answeredAt = *attempt.SubmittedAt
+	}
+
+	upsertQuery := `INSERT INTO question_outcomes (attempt_id, question_id, concept, user_id, material_id, credit, answered_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7)
+					ON CONFLICT (attempt_id, question_id, concept) DO UPDATE SET credit = EXCLUDED.credit`
+
+	var concepts []string
+	seen := map[string]bool{}
+	for _, result := range results {
+		question, ok := byID[result.QuestionID]
+		if !ok || result.Pending {
+			continue
+		}
+
+		for _, concept := range services.QuestionConcepts(question) {
+			_, err := tx.Exec(upsertQuery, attempt.ID, question.ID, concept, attempt.UserID, materialID, result.Credit, answeredAt)
+			if err != nil {
+				return err
+			}
+			if !seen[concept] {
+				seen[concept] = true
+				concepts = append(concepts, concept)
+			}
+		}
+	}
+
+	return traceMastery(tx, attempt.UserID, materialID, concepts)
+}
+
+// traceMastery recomputes the user's mastery of each concept from all their
+// outcomes on it, oldest first
+func traceMastery(tx *sql.Tx, userID, materialID uuid.UUID, concepts []string) error {
+	outcomesQuery := `SELECT credit, answered_at
+					  FROM question_outcomes
+					  WHERE user_id = $1 AND material_id = $2 AND concept = $3
+					  ORDER BY answered_at, attempt_id, question_id`
+
+	upsertQuery := `INSERT INTO concept_mastery (user_id, material_id, concept, mastery, responses, last_practiced_at, updated_at)
+					VALUES ($1, $2, $3, $4, $5, $6, NOW())
+					ON CONFLICT (user_id, material_id, concept) DO UPDATE
+					SET mastery = EXCLUDED.mastery, responses = EXCLUDED.responses,
+						last_practiced_at = EXCLUDED.last_practiced_at, updated_at = NOW()`
+
+	for _, concept := range concepts {
+		rows, err := tx.Query(outcomesQuery, userID, materialID, concept)
+		if err != nil {
+			return err
+		}
+
+		var credits []float64
+		var lastPracticedAt sql.NullTime
+		for rows.Next() {
+			var credit float64
+			if err := rows.Scan(&credit, &lastPracticedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			credits = append(credits, credit)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		mastery := services.DefaultBKT.Trace(credits)
+		if _, err := tx.Exec(upsertQuery, userID, materialID, concept, mastery, len(credits), lastPracticedAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
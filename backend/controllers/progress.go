@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ProgressController struct {
+	DB *sql.DB
+}
+
+func NewProgressController(db *sql.DB) *ProgressController {
+	return &ProgressController{DB: db}
+}
+
+// MaterialProgress is a user's progress on one material. Materials the user
+// hasn't studied yet have no progress row and report zero values.
+type MaterialProgress struct {
+	MaterialID       uuid.UUID  `json:"material_id"`
+	Title            string     `json:"title"`
+	Subject          string     `json:"subject"`
+	HasViewedSummary bool       `json:"has_viewed_summary"`
+	HasTakenQuiz     bool       `json:"has_taken_quiz"`
+	BestScore        int        `json:"best_score"`
+	TotalAttempts    int        `json:"total_attempts"`
+	LastAccessedAt   *time.Time `json:"last_accessed_at"`
+}
+
+const materialProgressQuery = `SELECT m.id, m.title, m.subject, COALESCE(p.has_viewed_summary, FALSE), COALESCE(p.has_taken_quiz, FALSE),
+									  COALESCE(p.best_score, 0), COALESCE(p.total_attempts, 0), p.last_accessed_at
+							   FROM materials m
+							   LEFT JOIN progress p ON p.material_id = m.id AND p.user_id = m.user_id
+							   WHERE m.user_id = $1`
+
+// ListProgress returns the user's progress on every material, most recently
+// studied first, with totals for the dashboard
+func (pc *ProgressController) ListProgress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	rows, err := pc.DB.Query(materialProgressQuery+` ORDER BY p.last_accessed_at DESC NULLS LAST, m.created_at DESC`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	materials := []MaterialProgress{}
+	summariesViewed, quizzesTaken, scoreTotal := 0, 0, 0
+	for rows.Next() {
+		progress, err := scanMaterialProgress(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		materials = append(materials, progress)
+
+		if progress.HasViewedSummary {
+			summariesViewed++
+		}
+		if progress.HasTakenQuiz {
+			quizzesTaken++
+			scoreTotal += progress.BestScore
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Averaged over the materials whose quiz was taken
+	var averageBestScore *int
+	if quizzesTaken > 0 {
+		average := scoreTotal / quizzesTaken
+		averageBestScore = &average
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"progress":           materials,
+		"total_materials":    len(materials),
+		"summaries_viewed":   summariesViewed,
+		"quizzes_taken":      quizzesTaken,
+		"average_best_score": averageBestScore,
+	})
+}
+
+// GetMaterialProgress returns the user's progress on one material
+func (pc *ProgressController) GetMaterialProgress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("materialId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	progress, err := scanMaterialProgress(pc.DB.QueryRow(materialProgressQuery+` AND m.id = $2`, userID, materialID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"progress": progress})
+}
+
+func scanMaterialProgress(row rowScanner) (MaterialProgress, error) {
+	var progress MaterialProgress
+	err := row.Scan(
+		&progress.MaterialID, &progress.Title, &progress.Subject, &progress.HasViewedSummary, &progress.HasTakenQuiz,
+		&progress.BestScore, &progress.TotalAttempts, &progress.LastAccessedAt,
+	)
+	return progress, err
+}
+
+// recordSummaryView marks the material's summary as viewed by the user and
+// logs the view as an activity
+func recordSummaryView(db *sql.DB, userID, materialID uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO progress (user_id, material_id, has_viewed_summary, last_accessed_at, updated_at)
+			  VALUES ($1, $2, TRUE, NOW(), NOW())
+			  ON CONFLICT (user_id, material_id) DO UPDATE
+			  SET has_viewed_summary = TRUE, last_accessed_at = NOW(), updated_at = NOW()`
+
+	if _, err := tx.Exec(query, userID, materialID); err != nil {
+		return err
+	}
+
+	err = services.LogActivity(tx, userID, uuid.NullUUID{UUID: materialID, Valid: true}, models.ActivitySummaryView, 0)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordQuizAttempt counts a finished quiz attempt towards the user's
+// progress on the material, in the transaction that finished it
+func recordQuizAttempt(tx *sql.Tx, userID, materialID uuid.UUID, score int) error {
+	query := `INSERT INTO progress (user_id, material_id, has_taken_quiz, best_score, total_attempts, last_accessed_at, updated_at)
+			  VALUES ($1, $2, TRUE, $3, 1, NOW(), NOW())
+			  ON CONFLICT (user_id, material_id) DO UPDATE
+			  SET has_taken_quiz = TRUE,
+				  best_score = GREATEST(progress.best_score, EXCLUDED.best_score),
+				  total_attempts = progress.total_attempts + 1,
+				  last_accessed_at = NOW(),
+				  updated_at = NOW()`
+
+	_, err := tx.Exec(query, userID, materialID, score)
+	return err
+}
+
+// refreshBestScore recomputes the user's best score on the material from
+// their finished attempts, after a score of one of them changed
+func refreshBestScore(tx *sql.Tx, userID, materialID uuid.UUID) error {
+	query := `UPDATE progress
+			  SET best_score = COALESCE((
+					SELECT MAX(a.score)
+					FROM quiz_attempts a
+					JOIN quizzes q ON a.quiz_id = q.id
+					WHERE a.user_id = $1 AND q.material_id = $2 AND a.status <> $3
+				  ), 0),
+				  updated_at = NOW()
+			  WHERE user_id = $1 AND material_id = $2`
+
+	_, err := tx.Exec(query, userID, materialID, models.AttemptInProgress)
+	return err
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"quicacademy-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetQuestionBank lists the question bank of a material with answer keys,
+// optionally filtered by concept, difficulty and type. Like the teacher mode
+// of GetQuiz it is limited to teachers and admins not taking the quiz.
+func (qc *QuizController) GetQuestionBank(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = qc.DB.QueryRow(`SELECT user_id FROM materials WHERE id = $1`, materialID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !qc.requireAnswerKeyAccess(c, userID.(uuid.UUID), materialID) {
+		return
+	}
+
+	// Empty filters match everything
+	query := `SELECT id, material_id, quiz_id, type, concept, difficulty, question, created_at
+			  FROM question_bank
+			  WHERE material_id = $1
+				AND ($2::text = '' OR LOWER(concept) = LOWER($2::text))
+				AND ($3::text = '' OR difficulty = $3::text)
+				AND ($4::text = '' OR type = $4::text)
+			  ORDER BY created_at, id`
+
+	rows, err := qc.DB.Query(query, materialID, c.Query("concept"), c.Query("difficulty"), c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.QuestionBankEntry{}
+	concepts := map[string]int{}
+	for rows.Next() {
+		entry, err := scanBankEntry(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		entries = append(entries, entry)
+		concepts[entry.Concept]++
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"questions": entries,
+		"total":     len(entries),
+		"concepts":  concepts,
+	})
+}
+
+// addToQuestionBank saves the questions of a new quiz into the material's
+// question bank under their BankID. Questions without one are skipped.
+func addToQuestionBank(tx *sql.Tx, materialID, quizID uuid.UUID, questions []models.Question) error {
+	insertQuery := `INSERT INTO question_bank (id, material_id, quiz_id, type, concept, difficulty, question)
+					VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	for _, question := range questions {
+		if question.BankID == nil {
+			continue
+		}
+
+		questionJSON, err := json.Marshal(question)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(insertQuery,
+			*question.BankID, materialID, quizID, question.Type, question.Concept, question.Difficulty, string(questionJSON),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bankQuestions returns every question in the material's bank in a stable
+// order, so a seed assembles the same attempt from the same bank
+func bankQuestions(db *sql.DB, materialID uuid.UUID) ([]models.Question, error) {
+	query := `SELECT id, material_id, quiz_id, type, concept, difficulty, question, created_at
+			  FROM question_bank
+			  WHERE material_id = $1
+			  ORDER BY created_at, id`
+
+	rows, err := db.Query(query, materialID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []models.Question
+	for rows.Next() {
+		entry, err := scanBankEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, entry.Question)
+	}
+
+	return questions, rows.Err()
+}
+
+func scanBankEntry(row rowScanner) (models.QuestionBankEntry, error) {
+	var entry models.QuestionBankEntry
+	var question string
+	err := row.Scan(
+		&entry.ID, &entry.MaterialID, &entry.QuizID, &entry.Type, &entry.Concept,
+		&entry.Difficulty, &question, &entry.CreatedAt,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	if err := json.Unmarshal([]byte(question), &entry.Question); err != nil {
+		return entry, err
+	}
+	entry.Question.BankID = &entry.ID
+	return entry, nil
+}
@@ -1,9 +1,16 @@
 package controllers
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"quicacademy-backend/models"
@@ -18,25 +25,55 @@ type QuizController struct {
 	AIService *services.OpenRouterService
 }
 
-type Question struct {
-	ID            int      `json:"id"`
-	Type          string   `json:"type"`
-	Question      string   `json:"question"`
-	Options       []string `json:"options,omitempty"`
-	CorrectAnswer string   `json:"correct_answer"`
-	Explanation   string   `json:"explanation"`
-	Difficulty    string   `json:"difficulty"`
+// QuestionView is the student-facing form of a question. It leaves out the
+// correct answer and explanation so they can't be read before submitting.
+type QuestionView struct {
+	ID         int                      `json:"id"`
+	Type       string                   `json:"type"`
+	Question   string                   `json:"question"`
+	Prompts    []string                 `json:"prompts,omitempty"`
+	Options    []string                 `json:"options,omitempty"`
+	Rubric     []models.RubricCriterion `json:"rubric,omitempty"`
+	Difficulty string                   `json:"difficulty"`
 }
 
+// QuestionReview is returned after submission, next to the student's answer
+type QuestionReview struct {
+	ID            int                      `json:"id"`
+	Type          string                   `json:"type"`
+	Question      string                   `json:"question"`
+	Prompts       []string                 `json:"prompts,omitempty"`
+	Options       []string                 `json:"options,omitempty"`
+	Answer        models.Answer            `json:"answer"`
+	CorrectAnswer models.Answer            `json:"correct_answer"`
+	Credit        float64                  `json:"credit"`
+	Correct       bool                     `json:"correct"`
+	Pending       bool                     `json:"pending,omitempty"`
+	Rubric        []models.RubricCriterion `json:"rubric,omitempty"`
+	Criteria      []models.CriterionScore  `json:"criteria,omitempty"`
+	Feedback      string                   `json:"feedback,omitempty"`
+	Explanation   string                   `json:"explanation"`
+	TimeSpent     int                      `json:"time_spent"` // in seconds
+}
+
+// Quiz payload modes for GetQuiz
+const (
+	QuizModeStudent = "student"
+	QuizModeTeacher = "teacher" // includes the answer key
+)
+
+// QuizSubmission finishes an attempt started with StartQuiz. Time spent is
+// measured on the server.
 type QuizSubmission struct {
-	Answers   map[string]string `json:"answers"`
-	TimeSpent int               `json:"time_spent"`
+	AttemptID string                   `json:"attempt_id" binding:"required,uuid"`
+	Answers   map[string]models.Answer `json:"answers"`
+	TimeSpent map[string]int           `json:"time_spent" binding:"omitempty,dive,min=0"` // seconds spent on each question
 }
 
-func NewQuizController(db *sql.DB) *QuizController {
+func NewQuizController(db *sql.DB, aiService *services.OpenRouterService) *QuizController {
 	return &QuizController{
 		DB:        db,
-		AIService: services.NewOpenRouterService(),
+		AIService: aiService,
 	}
 }
 
@@ -53,11 +90,28 @@ func (qc *QuizController) GenerateQuiz(c *gin.Context) {
 		return
 	}
 
+	var req models.QuizGenerateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The body is optional, an empty one keeps the defaults
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if mix := req.Difficulty; mix != nil && mix.Easy+mix.Medium+mix.Hard != 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "difficulty must add up to 100"})
+		return
+	}
+
 	// Check if material exists and belongs to user
 	var material models.Material
-	query := `SELECT id, title, subject, extracted_text FROM materials WHERE id = $1 AND user_id = $2`
+	query := `SELECT id, title, subject, extracted_text, language FROM materials WHERE id = $1 AND user_id = $2`
 	err := qc.DB.QueryRow(query, materialID, userID).Scan(
-		&material.ID, &material.Title, &material.Subject, &material.ExtractedText,
+		&material.ID, &material.Title, &material.Subject, &material.ExtractedText, &material.Language,
 	)
 
 	if err == sql.ErrNoRows {
@@ -75,81 +129,35 @@ func (qc *QuizController) GenerateQuiz(c *gin.Context) {
 		return
 	}
 
-	// Check if quiz already exists
-	var existingQuiz models.Quiz
-	quizQuery := `SELECT id, title, questions, time_limit, passing_score FROM quizzes WHERE material_id = $1`
-	err = qc.DB.QueryRow(quizQuery, materialID).Scan(
-		&existingQuiz.ID, &existingQuiz.Title, &existingQuiz.Questions,
-		&existingQuiz.TimeLimit, &existingQuiz.PassingScore,
-	)
-
-	if err == nil {
-		// Quiz exists, return it
-		var questions []Question
-		json.Unmarshal([]byte(existingQuiz.Questions), &questions)
-
-		c.JSON(http.StatusOK, gin.H{
-			"quiz": gin.H{
-				"id":            existingQuiz.ID,
-				"title":         existingQuiz.Title,
-				"time_limit":    existingQuiz.TimeLimit,
-				"passing_score": existingQuiz.PassingScore,
-				"questions":     questions,
-			},
-			"material": gin.H{
-				"id":      material.ID,
-				"title":   material.Title,
-				"subject": material.Subject,
-			},
-		})
+	if strings.TrimSpace(services.SelectPages(material.ExtractedText, req.FocusPages)) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "focus_pages do not match any page of the material"})
 		return
 	}
 
-	// Generate new quiz using AI
-	questionsJSON, err := qc.AIService.GenerateQuiz(material.ExtractedText, material.Subject)
+	req.Language, err = userLanguage(qc.DB, userID, req.Language)
 	if err != nil {
-		// Fallback to mock if AI fails
-		questions := qc.generateAIQuestions(material.ExtractedText, material.Subject)
-		questionsJSON, _ = json.Marshal(questions)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	// Save quiz to database
-	newQuiz := models.Quiz{
-		ID:           uuid.New(),
-		MaterialID:   material.ID,
-		Title:        "Quiz: " + material.Title,
-		Questions:    string(questionsJSON),
-		TimeLimit:    1800, // 30 minutes
-		PassingScore: 70,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-
-	insertQuery := `INSERT INTO quizzes (id, material_id, title, questions, time_limit, passing_score, created_at, updated_at)
-					VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-
-	_, err = qc.DB.Exec(insertQuery,
-		newQuiz.ID, newQuiz.MaterialID, newQuiz.Title, newQuiz.Questions,
-		newQuiz.TimeLimit, newQuiz.PassingScore, newQuiz.CreatedAt, newQuiz.UpdatedAt,
-	)
-
+	// Generation can take a while, so it runs as a background job the client
+	// polls. A material can have many quizzes; only a repeat of the same
+	// request is folded into the job already running.
+	dedupKey := fmt.Sprintf("%s:%s:%s", JobTypeQuiz, material.ID, requestKey(req))
+	job, created, err := enqueueJobWithKey(qc.DB, userID.(uuid.UUID), material.ID, JobTypeQuiz, dedupKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue quiz generation"})
 		return
 	}
 
-	// Parse questions for response
-	var parsedQuestions []Question
-	json.Unmarshal(questionsJSON, &parsedQuestions)
+	if created {
+		go runJob(qc.DB, job.ID, func() (uuid.UUID, error) {
+			return qc.createQuiz(userID.(uuid.UUID), material, req)
+		})
+	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"quiz": gin.H{
-			"id":            newQuiz.ID,
-			"title":         newQuiz.Title,
-			"time_limit":    newQuiz.TimeLimit,
-			"passing_score": newQuiz.PassingScore,
-			"questions":     parsedQuestions,
-		},
+	c.JSON(http.StatusAccepted, gin.H{
+		"job": job,
 		"material": gin.H{
 			"id":      material.ID,
 			"title":   material.Title,
@@ -158,6 +166,150 @@ func (qc *QuizController) GenerateQuiz(c *gin.Context) {
 	})
 }
 
+// Settings of quizzes generated without them
+const (
+	defaultQuizTimeLimit    = 1800 // 30 minutes
+	defaultQuizPassingScore = 70
+)
+
+// createQuiz generates quiz questions for the material as configured by req,
+// whose language must already be resolved, and saves the quiz
+func (qc *QuizController) createQuiz(userID uuid.UUID, material models.Material, req models.QuizGenerateRequest) (uuid.UUID, error) {
+	call := services.CallContext{
+		UserID:     userID,
+		MaterialID: uuid.NullUUID{UUID: material.ID, Valid: true},
+		Feature:    services.FeatureQuiz,
+	}
+
+	opts := services.QuizOptions{
+		Count:    req.QuestionCount,
+		Types:    req.Types,
+		Focus:    req.FocusConcepts,
+		Language: req.Language,
+	}
+	if req.Difficulty != nil {
+		opts.Difficulty = *req.Difficulty
+	}
+	opts = opts.WithDefaults()
+
+	// Questions are tagged with the summary's concepts to track mastery
+	concepts, err := materialConcepts(qc.DB, material.ID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	opts.Concepts = concepts
+
+	var questions []models.Question
+	text := services.SelectPages(material.ExtractedText, req.FocusPages)
+	questionsJSON, prompt, err := qc.AIService.GenerateQuiz(call, text, material.Subject, material.Language, opts)
+	if err == nil {
+		err = json.Unmarshal(questionsJSON, &questions)
+	}
+	if err == nil && len(questions) == 0 {
+		err = errors.New("no questions generated")
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to generate quiz: %w", err)
+	}
+	if len(questions) > opts.Count {
+		questions = questions[:opts.Count]
+	}
+
+	// Store the answer key in canonical form so grading doesn't depend on
+	// how the model happened to write it
+	questions = services.NormalizeQuestions(questions)
+
+	// Generated questions also go into the material's question bank
+	for i := range questions {
+		bankID := uuid.New()
+		questions[i].BankID = &bankID
+	}
+
+	questionsJSON, err = json.Marshal(questions)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to encode questions: %w", err)
+	}
+
+	title := req.Title
+	if title == "" {
+		title = "Quiz: " + material.Title
+	}
+	timeLimit := req.TimeLimit
+	if timeLimit == 0 {
+		timeLimit = defaultQuizTimeLimit
+	}
+	passingScore := defaultQuizPassingScore
+	if req.PassingScore != nil {
+		passingScore = *req.PassingScore
+	}
+	targetStandardError := req.TargetStandardError
+	if targetStandardError == 0 {
+		targetStandardError = defaultTargetStandardError
+	}
+
+	// Save quiz to database
+	newQuiz := models.Quiz{
+		ID:                  uuid.New(),
+		MaterialID:          material.ID,
+		Title:               title,
+		Questions:           string(questionsJSON),
+		TimeLimit:           timeLimit,
+		PassingScore:        passingScore,
+		Language:            opts.Language,
+		PromptTemplate:      prompt.Name,
+		PromptVersion:       prompt.Version,
+		MaxAttempts:         req.MaxAttempts,
+		QuestionsPerAttempt: req.QuestionsPerAttempt,
+		Adaptive:            req.Adaptive,
+		TargetStandardError: targetStandardError,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+
+	tx, err := qc.DB.Begin()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save quiz: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertQuiz(tx, newQuiz); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save quiz: %w", err)
+	}
+
+	if err := addToQuestionBank(tx, material.ID, newQuiz.ID, questions); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save question bank: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save quiz: %w", err)
+	}
+
+	return newQuiz.ID, nil
+}
+
+// insertQuiz saves a new quiz
+func insertQuiz(tx *sql.Tx, quiz models.Quiz) error {
+	insertQuery := `INSERT INTO quizzes (id, material_id, title, questions, time_limit, passing_score, language, prompt_template, prompt_version,
+										 max_attempts, questions_per_attempt, adaptive, target_standard_error, created_at, updated_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+
+	_, err := tx.Exec(insertQuery,
+		quiz.ID, quiz.MaterialID, quiz.Title, quiz.Questions,
+		quiz.TimeLimit, quiz.PassingScore, quiz.Language, quiz.PromptTemplate, quiz.PromptVersion,
+		quiz.MaxAttempts, quiz.QuestionsPerAttempt, quiz.Adaptive, quiz.TargetStandardError,
+		quiz.CreatedAt, quiz.UpdatedAt,
+	)
+	return err
+}
+
+// requestKey is a short digest of a request, telling identical requests apart
+// from different ones
+func requestKey(req interface{}) string {
+	encoded, _ := json.Marshal(req)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
 func (qc *QuizController) GetQuiz(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -165,25 +317,36 @@ func (qc *QuizController) GetQuiz(c *gin.Context) {
 		return
 	}
 
-	materialID := c.Param("id")
-	if materialID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Material ID required"})
+	// The ID is a quiz ID, or a material ID for its latest quiz
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	// Students get the quiz without answers, teachers can ask for the answer
+	// key explicitly
+	mode := c.DefaultQuery("mode", QuizModeStudent)
+	if mode != QuizModeStudent && mode != QuizModeTeacher {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be student or teacher"})
 		return
 	}
 
 	// Get quiz and verify material belongs to user
-	query := `SELECT q.id, q.title, q.questions, q.time_limit, q.passing_score,
-					 m.title, m.subject
+	query := `SELECT q.id, q.material_id, q.title, q.questions, q.time_limit, q.passing_score, q.max_attempts, q.questions_per_attempt,
+					 q.adaptive, q.target_standard_error, q.language, m.title, m.subject
 			  FROM quizzes q
 			  JOIN materials m ON q.material_id = m.id
-			  WHERE m.id = $1 AND m.user_id = $2`
+			  WHERE (q.id = $1 OR m.id = $1) AND m.user_id = $2
+			  ORDER BY q.id = $1 DESC, q.created_at DESC
+			  LIMIT 1`
 
 	var quiz models.Quiz
 	var materialTitle, materialSubject string
 
-	err := qc.DB.QueryRow(query, materialID, userID).Scan(
-		&quiz.ID, &quiz.Title, &quiz.Questions, &quiz.TimeLimit, &quiz.PassingScore,
-		&materialTitle, &materialSubject,
+	err = qc.DB.QueryRow(query, id, userID).Scan(
+		&quiz.ID, &quiz.MaterialID, &quiz.Title, &quiz.Questions, &quiz.TimeLimit, &quiz.PassingScore, &quiz.MaxAttempts,
+		&quiz.QuestionsPerAttempt, &quiz.Adaptive, &quiz.TargetStandardError, &quiz.Language, &materialTitle, &materialSubject,
 	)
 
 	if err == sql.ErrNoRows {
@@ -196,25 +359,152 @@ func (qc *QuizController) GetQuiz(c *gin.Context) {
 		return
 	}
 
-	var questions []Question
-	json.Unmarshal([]byte(quiz.Questions), &questions)
+	if mode == QuizModeTeacher && !qc.requireAnswerKeyAccess(c, userID.(uuid.UUID), quiz.MaterialID) {
+		return
+	}
+
+	questions := parseQuestions(quiz.Questions)
+
+	var payload interface{} = studentQuestions(questions)
+	if mode == QuizModeTeacher {
+		payload = questions
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"quiz": gin.H{
-			"id":            quiz.ID,
-			"title":         quiz.Title,
-			"time_limit":    quiz.TimeLimit,
-			"passing_score": quiz.PassingScore,
-			"questions":     questions,
+			"id":                    quiz.ID,
+			"title":                 quiz.Title,
+			"time_limit":            quiz.TimeLimit,
+			"passing_score":         quiz.PassingScore,
+			"max_attempts":          quiz.MaxAttempts,
+			"questions_per_attempt": quiz.QuestionsPerAttempt,
+			"adaptive":              quiz.Adaptive,
+			"target_standard_error": quiz.TargetStandardError,
+			"language":              quiz.Language,
+			"mode":                  mode,
+			"questions":             payload,
 		},
 		"material": gin.H{
-			"id":      materialID,
+			"id":      quiz.MaterialID,
 			"title":   materialTitle,
 			"subject": materialSubject,
 		},
 	})
 }
 
+var (
+	errAnswerKeyRole        = errors.New("only teachers and admins can view the answer key")
+	errAnswerKeyOpenAttempt = errors.New("the answer key is not available while you have an attempt in progress")
+)
+
+// answerKeyAccess tells whether a user with role may see a quiz's answer key.
+// Owning the material is not enough, as students own the materials they
+// study; and nobody sees the key while taking the quiz.
+func answerKeyAccess(role string, openAttempt bool) error {
+	if role != models.RoleTeacher && role != models.RoleAdmin {
+		return errAnswerKeyRole
+	}
+	if openAttempt {
+		return errAnswerKeyOpenAttempt
+	}
+	return nil
+}
+
+// requireAnswerKeyAccess checks answerKeyAccess for the answer keys of a
+// material's quizzes, counting an attempt in progress at any of them. It
+// responds with the reason and returns false when the user may not see them.
+func (qc *QuizController) requireAnswerKeyAccess(c *gin.Context, userID, materialID uuid.UUID) bool {
+	var role string
+	var openAttempt bool
+	query := `SELECT u.role, EXISTS (SELECT 1 FROM quiz_attempts a
+									 JOIN quizzes q ON a.quiz_id = q.id
+									 WHERE q.material_id = $2 AND a.user_id = u.id AND a.status = $3)
+			  FROM users u WHERE u.id = $1`
+	if err := qc.DB.QueryRow(query, userID, materialID, models.AttemptInProgress).Scan(&role, &openAttempt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	if err := answerKeyAccess(role, openAttempt); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// ListMaterialQuizzes lists the quizzes generated for a material, newest
+// first, without their questions
+func (qc *QuizController) ListMaterialQuizzes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = qc.DB.QueryRow(`SELECT user_id FROM materials WHERE id = $1`, materialID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, userID.(uuid.UUID))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := `SELECT id, title, json_array_length(questions::json), time_limit, passing_score, max_attempts, questions_per_attempt, adaptive, language, created_at
+			  FROM quizzes
+			  WHERE material_id = $1
+			  ORDER BY created_at DESC`
+
+	rows, err := qc.DB.Query(query, materialID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	quizzes := []gin.H{}
+	for rows.Next() {
+		var quiz models.Quiz
+		var questionCount int
+		if err := rows.Scan(
+			&quiz.ID, &quiz.Title, &questionCount, &quiz.TimeLimit, &quiz.PassingScore,
+			&quiz.MaxAttempts, &quiz.QuestionsPerAttempt, &quiz.Adaptive, &quiz.Language, &quiz.CreatedAt,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		quizzes = append(quizzes, gin.H{
+			"id":                    quiz.ID,
+			"title":                 quiz.Title,
+			"question_count":        questionCount,
+			"time_limit":            quiz.TimeLimit,
+			"passing_score":         quiz.PassingScore,
+			"max_attempts":          quiz.MaxAttempts,
+			"questions_per_attempt": quiz.QuestionsPerAttempt,
+			"adaptive":              quiz.Adaptive,
+			"language":              quiz.Language,
+			"created_at":            quiz.CreatedAt,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quizzes": quizzes})
+}
+
 func (qc *QuizController) SubmitQuiz(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -222,9 +512,9 @@ func (qc *QuizController) SubmitQuiz(c *gin.Context) {
 		return
 	}
 
-	quizID := c.Param("id")
-	if quizID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Quiz ID required"})
+	quizID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
 		return
 	}
 
@@ -234,13 +524,20 @@ func (qc *QuizController) SubmitQuiz(c *gin.Context) {
 		return
 	}
 
-	// Get quiz questions
-	var quiz models.Quiz
-	query := `SELECT questions, passing_score FROM quizzes WHERE id = $1`
-	err := qc.DB.QueryRow(query, quizID).Scan(&quiz.Questions, &quiz.PassingScore)
+	quiz, ok := qc.loadQuizForUser(c, quizID, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+	if quiz.Adaptive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adaptive quizzes are answered one question at a time"})
+		return
+	}
+
+	attemptID := uuid.MustParse(submission.AttemptID) // validated when binding
+	attempt, err := getAttempt(qc.DB, attemptID)
+	if err == sql.ErrNoRows || (err == nil && (attempt.UserID != userID.(uuid.UUID) || attempt.QuizID != quiz.ID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
 		return
 	}
 
@@ -249,102 +546,181 @@ func (qc *QuizController) SubmitQuiz(c *gin.Context) {
 		return
 	}
 
-	// Calculate score
-	var questions []Question
-	json.Unmarshal([]byte(quiz.Questions), &questions)
-
-	correct := 0
-	total := len(questions)
+	// Late submissions are refused, the answers saved before the deadline are
+	// graded instead
+	status, answers, times := models.AttemptSubmitted, submission.Answers, submission.TimeSpent
+	if attemptExpired(attempt, quiz.TimeLimit, time.Now()) {
+		status, answers, times = models.AttemptExpired, nil, nil
+	}
 
-	for _, question := range questions {
-		if answer, exists := submission.Answers[string(rune(question.ID))]; exists {
-			if answer == question.CorrectAnswer {
-				correct++
-			}
+	questionIDs := map[string]bool{}
+	for _, question := range attemptQuestions(attempt, parseQuestions(quiz.Questions)) {
+		questionIDs[strconv.Itoa(question.ID)] = true
+	}
+	for id := range answers {
+		if !questionIDs[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown question ID: %s", id)})
+			return
+		}
+	}
+	for id := range times {
+		if !questionIDs[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown question ID: %s", id)})
+			return
 		}
 	}
 
-	score := int((float64(correct) / float64(total)) * 100)
-	passed := score >= quiz.PassingScore
+	attempt, grade, err := finishAttempt(qc.DB, attempt.ID, answers, times, status)
+	if err == errAttemptClosed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
 
-	// Save quiz attempt
-	attempt := models.QuizAttempt{
-		ID:        uuid.New(),
-		UserID:    userID.(uuid.UUID),
-		QuizID:    uuid.MustParse(quizID),
-		Score:     score,
-		TimeSpent: submission.TimeSpent,
-		Passed:    passed,
-		CreatedAt: time.Now(),
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz attempt"})
+		return
 	}
 
-	answersJSON, _ := json.Marshal(submission.Answers)
-	attempt.Answers = string(answersJSON)
+	result := qc.submissionResult(quiz, attempt, grade)
+	if attempt.Status == models.AttemptExpired {
+		result["error"] = "Time limit exceeded, the answers saved before it ran out were submitted"
+		c.JSON(http.StatusConflict, result)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// submissionResult describes a finished attempt with its per-question review.
+// It schedules grading of the attempt's essays, whose job is included.
+func (qc *QuizController) submissionResult(quiz models.Quiz, attempt models.QuizAttempt, grade services.GradeResult) gin.H {
+	result := gin.H{
+		"score":          grade.Score,
+		"correct":        grade.Correct,
+		"total":          grade.Total,
+		"passed":         grade.Passed,
+		"passing_score":  quiz.PassingScore,
+		"attempt_id":     attempt.ID,
+		"status":         attempt.Status,
+		"grading_status": attempt.GradingStatus,
+		"pending":        grade.Pending,
+		"time_spent":     attempt.TimeSpent,
+		"review":         attemptReview(attempt, parseQuestions(quiz.Questions), grade.Results),
+	}
 
-	insertQuery := `INSERT INTO quiz_attempts (id, user_id, quiz_id, answers, score, time_spent, passed, created_at)
-					VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	if attempt.Ability != nil {
+		result["ability"] = attempt.Ability
+		result["standard_error"] = attempt.StandardError
+	}
+
+	// Essays are graded in the background, the job can be polled
+	if job := qc.scheduleEssayGrading(attempt); job != nil {
+		result["job"] = job
+	}
+
+	return result
+}
+
+// attemptReview pairs the graded questions of a finished attempt with their
+// results and the time spent on each
+func attemptReview(attempt models.QuizAttempt, questions []models.Question, results []services.QuestionResult) []QuestionReview {
+	byID := make(map[int]services.QuestionResult, len(results))
+	for _, result := range results {
+		byID[result.QuestionID] = result
+	}
+	times := decodeQuestionTimes(attempt.QuestionTimes)
+
+	review := []QuestionReview{}
+	for _, question := range gradedQuestions(attempt, questions, decodeAnswers(attempt.Answers)) {
+		result, ok := byID[question.ID]
+		if !ok {
+			continue
+		}
+		review = append(review, QuestionReview{
+			ID:            question.ID,
+			Type:          question.Type,
+			Question:      question.Question,
+			Prompts:       question.Prompts,
+			Options:       question.Options,
+			Answer:        result.Answer,
+			CorrectAnswer: result.CorrectAnswer,
+			Credit:        result.Credit,
+			Correct:       result.Correct,
+			Pending:       result.Pending,
+			Rubric:        question.Rubric,
+			Criteria:      result.Criteria,
+			Feedback:      result.Feedback,
+			Explanation:   question.Explanation,
+			TimeSpent:     times[strconv.Itoa(question.ID)],
+		})
+	}
+	return review
+}
 
-	_, err = qc.DB.Exec(insertQuery,
-		attempt.ID, attempt.UserID, attempt.QuizID, attempt.Answers,
-		attempt.Score, attempt.TimeSpent, attempt.Passed, attempt.CreatedAt,
+// loadQuizForUser loads a quiz the user is allowed to take and writes the
+// error response when they aren't: 404 when the quiz doesn't exist, 403 when
+// it belongs to someone else's material
+func (qc *QuizController) loadQuizForUser(c *gin.Context, quizID, userID uuid.UUID) (models.Quiz, bool) {
+	query := `SELECT q.id, q.material_id, q.title, q.questions, q.time_limit, q.passing_score, q.max_attempts,
+					 q.questions_per_attempt, q.adaptive, q.target_standard_error, q.language, m.user_id
+			  FROM quizzes q
+			  JOIN materials m ON q.material_id = m.id
+			  WHERE q.id = $1`
+
+	var quiz models.Quiz
+	var ownerID uuid.UUID
+	err := qc.DB.QueryRow(query, quizID).Scan(
+		&quiz.ID, &quiz.MaterialID, &quiz.Title, &quiz.Questions, &quiz.TimeLimit, &quiz.PassingScore, &quiz.MaxAttempts,
+		&quiz.QuestionsPerAttempt, &quiz.Adaptive, &quiz.TargetStandardError, &quiz.Language, &ownerID,
 	)
 
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return quiz, false
+	}
+
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz attempt"})
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return quiz, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"score":         score,
-		"correct":       correct,
-		"total":         total,
-		"passed":        passed,
-		"passing_score": quiz.PassingScore,
-		"attempt_id":    attempt.ID,
-	})
+	if !canAccessMaterial(ownerID, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this quiz"})
+		return quiz, false
+	}
+
+	return quiz, true
 }
 
-// Mock AI question generation
-func (qc *QuizController) generateAIQuestions(text, subject string) []Question {
-	// This is a mock implementation
-	// In production, this would call OpenRouter API
-
-	return []Question{
-		{
-			ID:       1,
-			Type:     "multiple_choice",
-			Question: "Apa konsep utama yang dibahas dalam materi ini?",
-			Options: []string{
-				"Konsep A yang mendasar",
-				"Konsep B yang kompleks",
-				"Konsep C yang aplikatif",
-				"Konsep D yang teoritis",
-			},
-			CorrectAnswer: "Konsep A yang mendasar",
-			Explanation:   "Konsep A adalah fondasi utama yang harus dipahami sebelum mempelajari konsep lainnya.",
-			Difficulty:    "easy",
-		},
-		{
-			ID:            2,
-			Type:          "true_false",
-			Question:      "Apakah materi ini memiliki aplikasi praktis dalam kehidupan sehari-hari?",
-			CorrectAnswer: "true",
-			Explanation:   "Ya, materi ini memiliki banyak aplikasi praktis yang dapat diterapkan dalam berbagai situasi.",
-			Difficulty:    "easy",
-		},
-		{
-			ID:       3,
-			Type:     "multiple_choice",
-			Question: "Manakah yang merupakan karakteristik utama dari topik ini?",
-			Options: []string{
-				"Bersifat statis dan tidak berubah",
-				"Dinamis dan dapat berkembang",
-				"Hanya berlaku dalam kondisi tertentu",
-				"Tidak memiliki hubungan dengan bidang lain",
-			},
-			CorrectAnswer: "Dinamis dan dapat berkembang",
-			Explanation:   "Topik ini bersifat dinamis karena terus berkembang seiring dengan kemajuan penelitian dan aplikasi.",
-			Difficulty:    "medium",
-		},
+// canAccessMaterial reports whether userID may use the material owned by
+// ownerID. Only the owner can for now; shared access goes through here too.
+func canAccessMaterial(ownerID, userID uuid.UUID) bool {
+	return ownerID == userID
+}
+
+// parseQuestions decodes stored quiz questions into canonical form. Quizzes
+// saved before answer keys were normalized are normalized on the fly.
+func parseQuestions(raw string) []models.Question {
+	var questions []models.Question
+	if err := json.Unmarshal([]byte(raw), &questions); err != nil {
+		return nil
+	}
+	return services.NormalizeQuestions(questions)
+}
+
+// studentQuestions strips the answer key from questions
+func studentQuestions(questions []models.Question) []QuestionView {
+	views := make([]QuestionView, len(questions))
+	for i, question := range questions {
+		views[i] = QuestionView{
+			ID:         question.ID,
+			Type:       question.Type,
+			Question:   question.Question,
+			Prompts:    question.Prompts,
+			Options:    question.Options,
+			Rubric:     question.Rubric,
+			Difficulty: question.Difficulty,
+		}
 	}
+	return views
 }
@@ -0,0 +1,640 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// quizGracePeriod is how long after the time limit a submission is still
+// accepted, to absorb network latency
+const quizGracePeriod = 30 * time.Second
+
+// errAttemptClosed is returned when an attempt is no longer in progress
+var errAttemptClosed = errors.New("attempt is not in progress")
+
+// StartQuiz opens a quiz session with a server-side start time. The attempt
+// is assembled from a random seed: the quiz's questions, or as many as the
+// quiz asks for drawn from the material's question bank, with questions and
+// options shuffled. An open session is resumed instead; one whose time
+// ran out is submitted with its saved answers first.
+func (qc *QuizController) StartQuiz(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	quizID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	quiz, ok := qc.loadQuizForUser(c, quizID, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	questions := parseQuestions(quiz.Questions)
+	if len(questions) == 0 && !quiz.Adaptive {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Quiz has no questions"})
+		return
+	}
+
+	now := time.Now()
+	attempt, err := getOpenAttempt(qc.DB, userID.(uuid.UUID), quiz.ID)
+	switch {
+	case err == nil && !attemptExpired(attempt, quiz.TimeLimit, now):
+		c.JSON(http.StatusOK, sessionResponse(attempt, quiz, questions, now))
+		return
+	case err == nil:
+		if !qc.expireAttempt(c, attempt.ID) {
+			return
+		}
+	case err != sql.ErrNoRows:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if quiz.MaxAttempts > 0 {
+		var used int
+		countQuery := `SELECT COUNT(*) FROM quiz_attempts WHERE user_id = $1 AND quiz_id = $2 AND status <> $3`
+		if err := qc.DB.QueryRow(countQuery, userID, quiz.ID, models.AttemptInProgress).Scan(&used); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if used >= quiz.MaxAttempts {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Maximum number of attempts reached"})
+			return
+		}
+	}
+
+	// The seed is kept so the attempt can be assembled again from the pool
+	seed := rand.Int63()
+	var assembled []models.Question
+	var ability, standardError *float64
+
+	if quiz.Adaptive {
+		// Adaptive attempts start from the population average and get one
+		// question at a time
+		pool, params, err := adaptiveItems(qc.DB, quiz.MaterialID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		theta, se := services.EstimateAbility(nil)
+		first, found := nextAdaptiveQuestion(nil, pool, params, theta, rand.New(rand.NewSource(seed)))
+		if !found {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The material's question bank has no questions for an adaptive quiz"})
+			return
+		}
+		assembled = []models.Question{first}
+		ability, standardError = &theta, &se
+	} else {
+		pool := questions
+		if quiz.QuestionsPerAttempt > 0 {
+			bank, err := bankQuestions(qc.DB, quiz.MaterialID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if len(bank) > 0 {
+				pool = bank
+			}
+		}
+		assembled = services.AssembleQuiz(pool, quiz.QuestionsPerAttempt, seed)
+	}
+
+	order := make([]int, len(assembled))
+	for i, question := range assembled {
+		order[i] = question.ID
+	}
+	orderJSON, _ := json.Marshal(order)
+	assembledJSON, err := json.Marshal(assembled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start quiz"})
+		return
+	}
+
+	attempt = models.QuizAttempt{
+		ID:            uuid.New(),
+		UserID:        userID.(uuid.UUID),
+		QuizID:        quiz.ID,
+		Status:        models.AttemptInProgress,
+		QuestionOrder: string(orderJSON),
+		Seed:          seed,
+		Questions:     string(assembledJSON),
+		Answers:       "{}",
+		Results:       "[]",
+		Ability:       ability,
+		StandardError: standardError,
+		StartedAt:     now,
+		CreatedAt:     now,
+	}
+
+	// The open-session index makes concurrent starts collapse into one session
+	insertQuery := `INSERT INTO quiz_attempts (id, user_id, quiz_id, status, question_order, seed, questions, answers, results,
+											   score, time_spent, passed, ability, ability_se, started_at, created_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 0, 0, FALSE, $10, $11, $12, $13)
+					ON CONFLICT (user_id, quiz_id) WHERE status = 'in_progress' DO NOTHING`
+
+	result, err := qc.DB.Exec(insertQuery,
+		attempt.ID, attempt.UserID, attempt.QuizID, attempt.Status, attempt.QuestionOrder, attempt.Seed,
+		attempt.Questions, attempt.Answers, attempt.Results, attempt.Ability, attempt.StandardError,
+		attempt.StartedAt, attempt.CreatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start quiz"})
+		return
+	}
+
+	if created, _ := result.RowsAffected(); created == 0 {
+		attempt, err = getOpenAttempt(qc.DB, userID.(uuid.UUID), quiz.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusOK, sessionResponse(attempt, quiz, questions, now))
+		return
+	}
+
+	c.JSON(http.StatusCreated, sessionResponse(attempt, quiz, questions, now))
+}
+
+// SaveAnswers autosaves answers into an open attempt. Answers are merged
+// over the saved ones, so clients may send only what changed. The request
+// carries the attempt version it was based on; a stale version gets 409 with
+// the current answers so the client can merge and retry.
+func (qc *QuizController) SaveAnswers(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	attemptID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	var req models.AnswerDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attempt, err := getAttempt(qc.DB, attemptID)
+	if err == sql.ErrNoRows || (err == nil && attempt.UserID != userID.(uuid.UUID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if attempt.Status != models.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	var quiz models.Quiz
+	quizQuery := `SELECT questions, time_limit, adaptive FROM quizzes WHERE id = $1`
+	if err := qc.DB.QueryRow(quizQuery, attempt.QuizID).Scan(&quiz.Questions, &quiz.TimeLimit, &quiz.Adaptive); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if quiz.Adaptive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adaptive quizzes are answered one question at a time"})
+		return
+	}
+
+	now := time.Now()
+	if attemptExpired(attempt, quiz.TimeLimit, now) {
+		if !qc.expireAttempt(c, attempt.ID) {
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Time limit exceeded, the saved answers were submitted"})
+		return
+	}
+
+	questionIDs := map[string]bool{}
+	for _, question := range attemptQuestions(attempt, parseQuestions(quiz.Questions)) {
+		questionIDs[strconv.Itoa(question.ID)] = true
+	}
+	for id := range req.Answers {
+		if !questionIDs[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown question ID: %s", id)})
+			return
+		}
+	}
+	for id := range req.TimeSpent {
+		if !questionIDs[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown question ID: %s", id)})
+			return
+		}
+	}
+
+	if req.TimeSpent == nil {
+		req.TimeSpent = map[string]int{}
+	}
+	answersJSON, _ := json.Marshal(req.Answers)
+	timesJSON, _ := json.Marshal(req.TimeSpent)
+
+	updateQuery := `UPDATE quiz_attempts
+					SET answers = (answers::jsonb || $1::jsonb)::text,
+						question_times = (question_times::jsonb || $2::jsonb)::text,
+						version = version + 1
+					WHERE id = $3 AND status = $4 AND version = $5
+					RETURNING answers, version`
+
+	err = qc.DB.QueryRow(updateQuery, string(answersJSON), string(timesJSON), attempt.ID, models.AttemptInProgress, *req.Version).Scan(
+		&attempt.Answers, &attempt.Version,
+	)
+
+	if err == sql.ErrNoRows {
+		// Either the attempt was submitted meanwhile or another save won
+		current, err := getAttempt(qc.DB, attempt.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if current.Status != models.AttemptInProgress {
+			c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+			return
+		}
+
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Answers were saved from another session, merge and retry",
+			"version": current.Version,
+			"answers": decodeAnswers(current.Answers),
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answers"})
+		return
+	}
+
+	response := gin.H{
+		"attempt_id":        attempt.ID,
+		"version":           attempt.Version,
+		"answers":           decodeAnswers(attempt.Answers),
+		"remaining_seconds": nil,
+	}
+	if deadline, limited := attemptDeadline(attempt, quiz.TimeLimit); limited {
+		response["remaining_seconds"] = remainingSeconds(deadline, now)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExpireQuizAttempts submits every open attempt whose time limit and grace
+// period have passed, grading the answers saved so far
+func (qc *QuizController) ExpireQuizAttempts() (int, error) {
+	db := qc.DB
+	query := `SELECT a.id FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  WHERE a.status = $1 AND q.time_limit > 0
+				AND a.started_at + q.time_limit * INTERVAL '1 second' < $2`
+
+	rows, err := db.Query(query, models.AttemptInProgress, time.Now().Add(-quizGracePeriod))
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		attempt, _, err := finishAttempt(db, id, nil, nil, models.AttemptExpired)
+		if err == errAttemptClosed {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to expire quiz attempt %s: %v", id, err)
+			continue
+		}
+		qc.scheduleEssayGrading(attempt)
+		expired++
+	}
+
+	return expired, nil
+}
+
+// expireAttempt submits an attempt whose time ran out, writing the error
+// response if that fails
+func (qc *QuizController) expireAttempt(c *gin.Context, attemptID uuid.UUID) bool {
+	attempt, _, err := finishAttempt(qc.DB, attemptID, nil, nil, models.AttemptExpired)
+	if err == errAttemptClosed {
+		return true
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close expired attempt"})
+		return false
+	}
+
+	qc.scheduleEssayGrading(attempt)
+	return true
+}
+
+// getOpenAttempt returns the user's in-progress attempt at a quiz
+func getOpenAttempt(db *sql.DB, userID, quizID uuid.UUID) (models.QuizAttempt, error) {
+	query := `SELECT ` + attemptColumns + ` FROM quiz_attempts WHERE user_id = $1 AND quiz_id = $2 AND status = $3`
+	return scanAttempt(db.QueryRow(query, userID, quizID, models.AttemptInProgress))
+}
+
+// getAttempt returns an attempt by ID
+func getAttempt(db *sql.DB, id uuid.UUID) (models.QuizAttempt, error) {
+	query := `SELECT ` + attemptColumns + ` FROM quiz_attempts WHERE id = $1`
+	return scanAttempt(db.QueryRow(query, id))
+}
+
+const attemptColumns = `id, user_id, quiz_id, status, question_order, seed, questions, answers, question_times, version, results, score, time_spent, passed, grading_status, ability, ability_se, started_at, submitted_at, created_at`
+
+// scanAttempt scans a row selected with attemptColumns, followed by any
+// extra destinations the query selects after them
+func scanAttempt(row rowScanner, extra ...interface{}) (models.QuizAttempt, error) {
+	var attempt models.QuizAttempt
+	dest := []interface{}{
+		&attempt.ID, &attempt.UserID, &attempt.QuizID, &attempt.Status, &attempt.QuestionOrder, &attempt.Seed, &attempt.Questions,
+		&attempt.Answers, &attempt.QuestionTimes, &attempt.Version, &attempt.Results, &attempt.Score, &attempt.TimeSpent, &attempt.Passed,
+		&attempt.GradingStatus, &attempt.Ability, &attempt.StandardError, &attempt.StartedAt, &attempt.SubmittedAt, &attempt.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return attempt, err
+}
+
+// finishAttempt grades an open attempt and closes it with status. answers
+// and times are merged over the ones saved in the session; pass nil to grade
+// the saved answers alone. Time spent is measured from the server start time
+// and capped at the time limit, as is the time reported for each question.
+// It returns errAttemptClosed when the attempt was already submitted.
+func finishAttempt(db *sql.DB, attemptID uuid.UUID, answers map[string]models.Answer, times map[string]int, status string) (models.QuizAttempt, services.GradeResult, error) {
+	var grade services.GradeResult
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.QuizAttempt{}, grade, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + prefixedAttemptColumns + `, q.material_id, q.questions, q.time_limit, q.passing_score
+			  FROM quiz_attempts a
+			  JOIN quizzes q ON a.quiz_id = q.id
+			  WHERE a.id = $1
+			  FOR UPDATE OF a`
+
+	var quiz models.Quiz
+	attempt, err := scanAttempt(tx.QueryRow(query, attemptID), &quiz.MaterialID, &quiz.Questions, &quiz.TimeLimit, &quiz.PassingScore)
+	if err != nil {
+		return attempt, grade, err
+	}
+
+	if attempt.Status != models.AttemptInProgress {
+		return attempt, grade, errAttemptClosed
+	}
+
+	saved := decodeAnswers(attempt.Answers)
+	for id, answer := range answers {
+		saved[id] = answer
+	}
+
+	now := time.Now()
+	timeSpent := int(now.Sub(attempt.StartedAt).Seconds())
+	if quiz.TimeLimit > 0 && timeSpent > quiz.TimeLimit {
+		timeSpent = quiz.TimeLimit
+	}
+
+	savedTimes := decodeQuestionTimes(attempt.QuestionTimes)
+	for id, seconds := range times {
+		savedTimes[id] = seconds
+	}
+	for id, seconds := range savedTimes {
+		if seconds > timeSpent {
+			savedTimes[id] = timeSpent
+		}
+	}
+
+	questions := gradedQuestions(attempt, parseQuestions(quiz.Questions), saved)
+	grade = services.GradeQuiz(questions, saved, quiz.PassingScore)
+
+	// Students of an adaptive quiz answer different questions, so they are
+	// scored by their estimated ability instead
+	if attempt.Ability != nil {
+		if grade.Score, err = adaptiveScore(db, quiz.MaterialID, *attempt.Ability); err != nil {
+			return attempt, grade, err
+		}
+		grade.Passed = grade.Pending == 0 && grade.Score >= quiz.PassingScore
+	}
+
+	answersJSON, _ := json.Marshal(saved)
+	timesJSON, _ := json.Marshal(savedTimes)
+	resultsJSON, _ := json.Marshal(grade.Results)
+
+	attempt.Status = status
+	attempt.Answers = string(answersJSON)
+	attempt.QuestionTimes = string(timesJSON)
+	attempt.Results = string(resultsJSON)
+	attempt.Score = grade.Score
+	attempt.Passed = grade.Passed
+	attempt.TimeSpent = timeSpent
+	attempt.SubmittedAt = &now
+	attempt.GradingStatus = gradingStatus(grade)
+
+	updateQuery := `UPDATE quiz_attempts
+					SET status = $1, answers = $2, question_times = $3, results = $4, score = $5, passed = $6, time_spent = $7,
+						submitted_at = $8, grading_status = $9
+					WHERE id = $10`
+
+	_, err = tx.Exec(updateQuery,
+		attempt.Status, attempt.Answers, attempt.QuestionTimes, attempt.Results, attempt.Score,
+		attempt.Passed, attempt.TimeSpent, attempt.SubmittedAt, attempt.GradingStatus, attempt.ID,
+	)
+	if err != nil {
+		return attempt, grade, err
+	}
+
+	if err := recordQuizAttempt(tx, attempt.UserID, quiz.MaterialID, attempt.Score); err != nil {
+		return attempt, grade, err
+	}
+
+	if err := recordOutcomes(tx, attempt, quiz.MaterialID, questions, grade.Results); err != nil {
+		return attempt, grade, err
+	}
+
+	return attempt, grade, tx.Commit()
+}
+
+const prefixedAttemptColumns = `a.id, a.user_id, a.quiz_id, a.status, a.question_order, a.seed, a.questions, a.answers, a.question_times, a.version, a.results, a.score, a.time_spent, a.passed, a.grading_status, a.ability, a.ability_se, a.started_at, a.submitted_at, a.created_at`
+
+// gradingStatus is pending while any essay of grade awaits grading
+func gradingStatus(grade services.GradeResult) string {
+	if grade.Pending > 0 {
+		return models.GradingPending
+	}
+	return models.GradingGraded
+}
+
+// attemptDeadline returns when the attempt's time runs out, and false when
+// the quiz has no time limit
+func attemptDeadline(attempt models.QuizAttempt, timeLimit int) (time.Time, bool) {
+	if timeLimit <= 0 {
+		return time.Time{}, false
+	}
+	return attempt.StartedAt.Add(time.Duration(timeLimit) * time.Second), true
+}
+
+// attemptExpired reports whether the attempt's time limit and grace period
+// have passed at now
+func attemptExpired(attempt models.QuizAttempt, timeLimit int, now time.Time) bool {
+	deadline, limited := attemptDeadline(attempt, timeLimit)
+	return limited && now.After(deadline.Add(quizGracePeriod))
+}
+
+// attemptQuestions returns the questions of an attempt in the order they were
+// presented. Attempts store the questions they were assembled with; for older
+// attempts the quiz's questions are put in the attempt's order, with any
+// missing from it appended at the end.
+func attemptQuestions(attempt models.QuizAttempt, questions []models.Question) []models.Question {
+	if attempt.Questions != "" {
+		return parseQuestions(attempt.Questions)
+	}
+
+	var order []int
+	json.Unmarshal([]byte(attempt.QuestionOrder), &order)
+
+	byID := make(map[int]models.Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+
+	ordered := make([]models.Question, 0, len(questions))
+	for _, id := range order {
+		if question, ok := byID[id]; ok {
+			ordered = append(ordered, question)
+			delete(byID, id)
+		}
+	}
+	for _, question := range questions {
+		if _, ok := byID[question.ID]; ok {
+			ordered = append(ordered, question)
+		}
+	}
+
+	return ordered
+}
+
+// gradedQuestions are the attempt's questions that count towards its grade:
+// all of them, except that an adaptive attempt leaves out the question it
+// was showing, unanswered, when it ended
+func gradedQuestions(attempt models.QuizAttempt, questions []models.Question, answers map[string]models.Answer) []models.Question {
+	questions = attemptQuestions(attempt, questions)
+	if attempt.Ability == nil {
+		return questions
+	}
+
+	answered := make([]models.Question, 0, len(questions))
+	for _, question := range questions {
+		if _, ok := answers[strconv.Itoa(question.ID)]; ok {
+			answered = append(answered, question)
+		}
+	}
+	return answered
+}
+
+// decodeQuestionTimes decodes the seconds spent per question of an attempt,
+// keyed by question ID
+func decodeQuestionTimes(raw string) map[string]int {
+	times := map[string]int{}
+	json.Unmarshal([]byte(raw), &times)
+	return times
+}
+
+// remainingSeconds is the time left until deadline, never negative
+func remainingSeconds(deadline, now time.Time) int {
+	remaining := int(deadline.Sub(now).Seconds())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// decodeAnswers decodes the answers stored on an attempt
+func decodeAnswers(raw string) map[string]models.Answer {
+	answers := map[string]models.Answer{}
+	json.Unmarshal([]byte(raw), &answers)
+	return answers
+}
+
+// sessionResponse describes an open attempt with its saved answers and its
+// questions, without the answer key. Resuming a session returns the same.
+func sessionResponse(attempt models.QuizAttempt, quiz models.Quiz, questions []models.Question, now time.Time) gin.H {
+	session := gin.H{
+		"id":                attempt.ID,
+		"quiz_id":           attempt.QuizID,
+		"status":            attempt.Status,
+		"version":           attempt.Version,
+		"answers":           decodeAnswers(attempt.Answers),
+		"started_at":        attempt.StartedAt,
+		"expires_at":        nil,
+		"remaining_seconds": nil,
+	}
+
+	if attempt.Ability != nil {
+		session["ability"] = attempt.Ability
+		session["standard_error"] = attempt.StandardError
+	}
+
+	if deadline, limited := attemptDeadline(attempt, quiz.TimeLimit); limited {
+		session["expires_at"] = deadline
+		session["remaining_seconds"] = remainingSeconds(deadline, now)
+	}
+
+	return gin.H{
+		"attempt": session,
+		"quiz": gin.H{
+			"id":            quiz.ID,
+			"title":         quiz.Title,
+			"time_limit":    quiz.TimeLimit,
+			"passing_score": quiz.PassingScore,
+			"max_attempts":  quiz.MaxAttempts,
+			"adaptive":      quiz.Adaptive,
+			"language":      quiz.Language,
+			"questions":     studentQuestions(attemptQuestions(attempt, questions)),
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"testing"
+
+	"quicacademy-backend/models"
+)
+
+func TestAnswerKeyAccess(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		openAttempt bool
+		expected    error
+	}{
+		{name: "teacher", role: models.RoleTeacher, expected: nil},
+		{name: "admin", role: models.RoleAdmin, expected: nil},
+		{name: "student owning the material", role: models.RoleStudent, expected: errAnswerKeyRole},
+		{name: "unknown role", role: "", expected: errAnswerKeyRole},
+		{name: "teacher with an attempt in progress", role: models.RoleTeacher, openAttempt: true, expected: errAnswerKeyOpenAttempt},
+		{name: "admin with an attempt in progress", role: models.RoleAdmin, openAttempt: true, expected: errAnswerKeyOpenAttempt},
+		{name: "student with an attempt in progress", role: models.RoleStudent, openAttempt: true, expected: errAnswerKeyRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answerKeyAccess(tt.role, tt.openAttempt); got != tt.expected {
+				t.Errorf("answerKeyAccess(%q, %v) = %v, want %v", tt.role, tt.openAttempt, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,839 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
+	"quicacademy-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SharePasswordHeader carries the password of a password protected link
+const SharePasswordHeader = "X-Share-Password"
+
+// shareTokenBytes is the entropy of a share token, 192 bits
+const shareTokenBytes = 24
+
+type ShareController struct {
+	DB *sql.DB
+}
+
+func NewShareController(db *sql.DB) *ShareController {
+	return &ShareController{DB: db}
+}
+
+// CreateShareLink creates a link to a material's summary or to a quiz,
+// optionally expiring or protected by a password
+func (sc *ShareController) CreateShareLink(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	link := models.ShareLink{
+		ID:        uuid.New(),
+		UserID:    userID.(uuid.UUID),
+		Type:      req.Type,
+		CreatedAt: now,
+	}
+	if req.ExpiresAt != nil {
+		// Timestamps are stored in server time
+		expiresAt := req.ExpiresAt.Local()
+		link.ExpiresAt = &expiresAt
+	}
+
+	resourceID := uuid.MustParse(req.ResourceID) // validated when binding
+	var ownerID uuid.UUID
+	switch req.Type {
+	case models.ShareSummary:
+		var hasSummary bool
+		query := `SELECT m.id, m.user_id, EXISTS (SELECT 1 FROM summaries s WHERE s.material_id = m.id AND s.is_active)
+				  FROM materials m
+				  WHERE m.id = $1`
+		err := sc.DB.QueryRow(query, resourceID).Scan(&link.MaterialID, &ownerID, &hasSummary)
+		if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, link.UserID)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if !hasSummary {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+			return
+		}
+
+	case models.ShareQuiz:
+		var adaptive bool
+		query := `SELECT q.material_id, q.adaptive, m.user_id
+				  FROM quizzes q
+				  JOIN materials m ON q.material_id = m.id
+				  WHERE q.id = $1`
+		err := sc.DB.QueryRow(query, resourceID).Scan(&link.MaterialID, &adaptive, &ownerID)
+		if err == sql.ErrNoRows || (err == nil && !canAccessMaterial(ownerID, link.UserID)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		// Adaptive quizzes depend on calibrated item banks and per-student
+		// ability estimates, which guests have none of
+		if adaptive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Adaptive quizzes cannot be shared"})
+			return
+		}
+		link.QuizID = &resourceID
+	}
+
+	if req.Password != "" {
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+			return
+		}
+		link.PasswordHash = hash
+		link.HasPassword = true
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	link.Token = token
+
+	query := `INSERT INTO share_links (id, user_id, material_id, quiz_id, type, token, password_hash, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = sc.DB.Exec(query,
+		link.ID, link.UserID, link.MaterialID, link.QuizID, link.Type, link.Token, link.PasswordHash, link.ExpiresAt, link.CreatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"share": link})
+}
+
+// ListShareLinks lists the user's share links, newest first, with how often
+// each was viewed and how many guest attempts were submitted through it
+func (sc *ShareController) ListShareLinks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ShareLinkListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT ` + prefixedShareLinkColumns + `,
+					 (SELECT COUNT(*) FROM guest_attempts g WHERE g.share_link_id = l.id AND g.status <> $2)
+			  FROM share_links l
+			  WHERE l.user_id = $1
+				AND ($3 = '' OR l.material_id::text = $3)
+				AND ($4 = '' OR l.type = $4)
+			  ORDER BY l.created_at DESC`
+
+	rows, err := sc.DB.Query(query, userID, models.AttemptInProgress, req.MaterialID, req.Type)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		var attemptCount int
+		link, err := scanShareLink(rows, &attemptCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		link.AttemptCount = attemptCount
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": links})
+}
+
+// RevokeShareLink revokes a share link. It stops working at once, but is
+// kept with its view and attempt counts.
+func (sc *ShareController) RevokeShareLink(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	linkID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link ID"})
+		return
+	}
+
+	query := `UPDATE share_links SET revoked_at = COALESCE(revoked_at, $1)
+			  WHERE id = $2 AND user_id = $3
+			  RETURNING ` + shareLinkColumns
+
+	link, err := scanShareLink(sc.DB.QueryRow(query, time.Now(), linkID, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked", "share": link})
+}
+
+// ListGuestAttempts lists the guest attempts made through a quiz link,
+// newest first
+func (sc *ShareController) ListGuestAttempts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	linkID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link ID"})
+		return
+	}
+
+	var owned bool
+	err = sc.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM share_links WHERE id = $1 AND user_id = $2)`, linkID, userID).Scan(&owned)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !owned {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	query := `SELECT ` + guestAttemptColumns + ` FROM guest_attempts WHERE share_link_id = $1 ORDER BY started_at DESC`
+	rows, err := sc.DB.Query(query, linkID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []models.GuestAttempt{}
+	for rows.Next() {
+		attempt, err := scanGuestAttempt(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// GetSharedContent shows what a link shares without signing in: the active
+// summary of the material read-only, or a quiz's details without its
+// questions. Every request counts as a view.
+func (sc *ShareController) GetSharedContent(c *gin.Context) {
+	link, ok := sc.loadSharedLink(c)
+	if !ok {
+		return
+	}
+
+	if _, err := sc.DB.Exec(`UPDATE share_links SET view_count = view_count + 1 WHERE id = $1`, link.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var materialTitle, materialSubject string
+	if link.Type == models.ShareSummary {
+		query := `SELECT ` + prefixedSummaryColumns + `, m.title, m.subject
+				  FROM summaries s
+				  JOIN materials m ON s.material_id = m.id
+				  WHERE m.id = $1 AND s.is_active`
+
+		summary, err := scanSummary(sc.DB.QueryRow(query, link.MaterialID), &materialTitle, &materialSubject)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"type": link.Type,
+			"summary": gin.H{
+				"bullet_points": summary.BulletPoints,
+				"paragraphs":    summary.Paragraphs,
+				"concepts":      summary.Concepts,
+				"version":       summary.Version,
+				"language":      summary.Language,
+				"created_at":    summary.CreatedAt,
+			},
+			"material":   gin.H{"title": materialTitle, "subject": materialSubject},
+			"expires_at": link.ExpiresAt,
+		})
+		return
+	}
+
+	quiz, err := sc.sharedQuiz(link, &materialTitle, &materialSubject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	pool, err := sc.guestQuestions(quiz)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	questionCount := len(pool)
+	if quiz.QuestionsPerAttempt > 0 && quiz.QuestionsPerAttempt < questionCount {
+		questionCount = quiz.QuestionsPerAttempt
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"type": link.Type,
+		"quiz": gin.H{
+			"id":             quiz.ID,
+			"title":          quiz.Title,
+			"question_count": questionCount,
+			"time_limit":     quiz.TimeLimit,
+			"passing_score":  quiz.PassingScore,
+			"language":       quiz.Language,
+		},
+		"material":   gin.H{"title": materialTitle, "subject": materialSubject},
+		"expires_at": link.ExpiresAt,
+	})
+}
+
+// StartGuestAttempt starts an attempt at a shared quiz under the name the
+// guest gives. The attempt is assembled like a student's, except that essay
+// questions are left out as nobody would grade them.
+func (sc *ShareController) StartGuestAttempt(c *gin.Context) {
+	link, ok := sc.loadSharedLink(c)
+	if !ok {
+		return
+	}
+
+	if link.Type != models.ShareQuiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This link does not share a quiz"})
+		return
+	}
+
+	var req models.GuestAttemptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var materialTitle, materialSubject string
+	quiz, err := sc.sharedQuiz(link, &materialTitle, &materialSubject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	pool, err := sc.guestQuestions(quiz)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if len(pool) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Quiz has no questions guests can answer"})
+		return
+	}
+
+	assembled := services.AssembleQuiz(pool, quiz.QuestionsPerAttempt, mathrand.Int63())
+	questionsJSON, err := json.Marshal(assembled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start quiz"})
+		return
+	}
+
+	now := time.Now()
+	attempt := models.GuestAttempt{
+		ID:            uuid.New(),
+		ShareLinkID:   link.ID,
+		QuizID:        quiz.ID,
+		GuestName:     req.Name,
+		Status:        models.AttemptInProgress,
+		Questions:     string(questionsJSON),
+		Answers:       "{}",
+		QuestionTimes: "{}",
+		Results:       "[]",
+		StartedAt:     now,
+	}
+
+	query := `INSERT INTO guest_attempts (id, share_link_id, quiz_id, guest_name, status, questions, answers, question_times, results, started_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err = sc.DB.Exec(query,
+		attempt.ID, attempt.ShareLinkID, attempt.QuizID, attempt.GuestName, attempt.Status,
+		attempt.Questions, attempt.Answers, attempt.QuestionTimes, attempt.Results, attempt.StartedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start quiz"})
+		return
+	}
+
+	session := gin.H{
+		"id":                attempt.ID,
+		"guest_name":        attempt.GuestName,
+		"status":            attempt.Status,
+		"started_at":        attempt.StartedAt,
+		"expires_at":        nil,
+		"remaining_seconds": nil,
+	}
+	if deadline, limited := guestDeadline(attempt, quiz.TimeLimit); limited {
+		session["expires_at"] = deadline
+		session["remaining_seconds"] = remainingSeconds(deadline, now)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"attempt": session,
+		"quiz": gin.H{
+			"id":            quiz.ID,
+			"title":         quiz.Title,
+			"time_limit":    quiz.TimeLimit,
+			"passing_score": quiz.PassingScore,
+			"language":      quiz.Language,
+			"questions":     studentQuestions(assembled),
+		},
+	})
+}
+
+// SubmitGuestAttempt grades a guest attempt and returns the review. Guests
+// have no autosave, so answers submitted after the time limit and grace
+// period are refused and the attempt is closed as expired without them.
+func (sc *ShareController) SubmitGuestAttempt(c *gin.Context) {
+	link, ok := sc.loadSharedLink(c)
+	if !ok {
+		return
+	}
+
+	attemptID, err := uuid.Parse(c.Param("attemptId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	var submission models.GuestSubmission
+	if err := c.ShouldBindJSON(&submission); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := sc.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz attempt"})
+		return
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + prefixedGuestAttemptColumns + `, q.time_limit, q.passing_score
+			  FROM guest_attempts g
+			  JOIN quizzes q ON g.quiz_id = q.id
+			  WHERE g.id = $1 AND g.share_link_id = $2
+			  FOR UPDATE OF g`
+
+	var timeLimit, passingScore int
+	attempt, err := scanGuestAttempt(tx.QueryRow(query, attemptID, link.ID), &timeLimit, &passingScore)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if attempt.Status != models.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	questions := parseQuestions(attempt.Questions)
+	questionIDs := map[string]bool{}
+	for _, question := range questions {
+		questionIDs[strconv.Itoa(question.ID)] = true
+	}
+	for id := range submission.Answers {
+		if !questionIDs[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown question ID: %s", id)})
+			return
+		}
+	}
+
+	now := time.Now()
+	status, answers, times := models.AttemptSubmitted, submission.Answers, submission.TimeSpent
+	if deadline, limited := guestDeadline(attempt, timeLimit); limited && now.After(deadline.Add(quizGracePeriod)) {
+		status, answers, times = models.AttemptExpired, nil, nil
+	}
+
+	grade, err := closeGuestAttempt(tx, &attempt, questions, answers, times, status, timeLimit, passingScore, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz attempt"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz attempt"})
+		return
+	}
+
+	// The review is built as for a student's attempt, from the questions
+	// as the guest was shown them
+	review := attemptReview(models.QuizAttempt{
+		Questions:     attempt.Questions,
+		Answers:       attempt.Answers,
+		QuestionTimes: attempt.QuestionTimes,
+	}, questions, grade.Results)
+
+	result := gin.H{
+		"score":         grade.Score,
+		"correct":       grade.Correct,
+		"total":         grade.Total,
+		"passed":        grade.Passed,
+		"passing_score": passingScore,
+		"attempt_id":    attempt.ID,
+		"status":        attempt.Status,
+		"time_spent":    attempt.TimeSpent,
+		"review":        review,
+	}
+
+	if attempt.Status == models.AttemptExpired {
+		result["error"] = "Time limit exceeded, the answers were not accepted"
+		c.JSON(http.StatusConflict, result)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ExpireGuestAttempts closes every open guest attempt whose time limit and
+// grace period have passed. As for a late submission, the guest's answers
+// were never saved, so the attempt is graded without them.
+func ExpireGuestAttempts(db *sql.DB) (int, error) {
+	query := `SELECT g.id FROM guest_attempts g
+			  JOIN quizzes q ON g.quiz_id = q.id
+			  WHERE g.status = $1 AND q.time_limit > 0
+				AND g.started_at + q.time_limit * INTERVAL '1 second' < $2`
+
+	rows, err := db.Query(query, models.AttemptInProgress, time.Now().Add(-quizGracePeriod))
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		closed, err := expireGuestAttempt(db, id)
+		if err != nil {
+			log.Printf("Failed to expire guest attempt %s: %v", id, err)
+			continue
+		}
+		if closed {
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+// expireGuestAttempt closes a guest attempt as expired, unless it was
+// submitted in the meantime
+func expireGuestAttempt(db *sql.DB, attemptID uuid.UUID) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + prefixedGuestAttemptColumns + `, q.time_limit, q.passing_score
+			  FROM guest_attempts g
+			  JOIN quizzes q ON g.quiz_id = q.id
+			  WHERE g.id = $1
+			  FOR UPDATE OF g`
+
+	var timeLimit, passingScore int
+	attempt, err := scanGuestAttempt(tx.QueryRow(query, attemptID), &timeLimit, &passingScore)
+	if err != nil {
+		return false, err
+	}
+
+	if attempt.Status != models.AttemptInProgress {
+		return false, nil
+	}
+
+	questions := parseQuestions(attempt.Questions)
+	if _, err := closeGuestAttempt(tx, &attempt, questions, nil, nil, models.AttemptExpired, timeLimit, passingScore, time.Now()); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// closeGuestAttempt grades a guest attempt on answers and saves it with
+// status. Time spent is measured from the start time and capped at the time
+// limit, as is the time reported for each question.
+func closeGuestAttempt(tx *sql.Tx, attempt *models.GuestAttempt, questions []models.Question, answers map[string]models.Answer, times map[string]int, status string, timeLimit, passingScore int, now time.Time) (services.GradeResult, error) {
+	if answers == nil {
+		answers = map[string]models.Answer{}
+	}
+
+	timeSpent := int(now.Sub(attempt.StartedAt).Seconds())
+	if timeLimit > 0 && timeSpent > timeLimit {
+		timeSpent = timeLimit
+	}
+
+	questionIDs := map[string]bool{}
+	for _, question := range questions {
+		questionIDs[strconv.Itoa(question.ID)] = true
+	}
+
+	questionTimes := map[string]int{}
+	for id, seconds := range times {
+		if !questionIDs[id] {
+			continue
+		}
+		if seconds > timeSpent {
+			seconds = timeSpent
+		}
+		questionTimes[id] = seconds
+	}
+
+	grade := services.GradeQuiz(questions, answers, passingScore)
+
+	answersJSON, _ := json.Marshal(answers)
+	timesJSON, _ := json.Marshal(questionTimes)
+	resultsJSON, _ := json.Marshal(grade.Results)
+
+	attempt.Status = status
+	attempt.Answers = string(answersJSON)
+	attempt.QuestionTimes = string(timesJSON)
+	attempt.Results = string(resultsJSON)
+	attempt.Score = grade.Score
+	attempt.Correct = grade.Correct
+	attempt.Total = grade.Total
+	attempt.Passed = grade.Passed
+	attempt.TimeSpent = timeSpent
+	attempt.SubmittedAt = &now
+
+	updateQuery := `UPDATE guest_attempts
+					SET status = $1, answers = $2, question_times = $3, results = $4, score = $5, correct = $6, total = $7,
+						passed = $8, time_spent = $9, submitted_at = $10
+					WHERE id = $11`
+
+	_, err := tx.Exec(updateQuery,
+		attempt.Status, attempt.Answers, attempt.QuestionTimes, attempt.Results, attempt.Score, attempt.Correct,
+		attempt.Total, attempt.Passed, attempt.TimeSpent, attempt.SubmittedAt, attempt.ID,
+	)
+	return grade, err
+}
+
+// loadSharedLink loads the link of the token in the URL for a recipient and
+// writes the error response when it can't be used: 404 when it doesn't
+// exist, 410 when it was revoked or has expired and 401 when its password
+// is missing or wrong
+func (sc *ShareController) loadSharedLink(c *gin.Context) (models.ShareLink, bool) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE token = $1`
+	link, err := scanShareLink(sc.DB.QueryRow(query, c.Param("token")))
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return link, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return link, false
+	}
+
+	if link.RevokedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Share link has been revoked"})
+		return link, false
+	}
+
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Share link has expired"})
+		return link, false
+	}
+
+	if link.HasPassword {
+		password := c.GetHeader(SharePasswordHeader)
+		if password == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password required", "password_required": true})
+			return link, false
+		}
+
+		if !utils.CheckPasswordHash(password, link.PasswordHash) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect password", "password_required": true})
+			return link, false
+		}
+	}
+
+	return link, true
+}
+
+// sharedQuiz loads the quiz of a quiz link with its material's title and
+// subject
+func (sc *ShareController) sharedQuiz(link models.ShareLink, materialTitle, materialSubject *string) (models.Quiz, error) {
+	query := `SELECT q.id, q.material_id, q.title, q.questions, q.time_limit, q.passing_score, q.questions_per_attempt,
+					 q.language, m.title, m.subject
+			  FROM quizzes q
+			  JOIN materials m ON q.material_id = m.id
+			  WHERE q.id = $1`
+
+	var quiz models.Quiz
+	err := sc.DB.QueryRow(query, link.QuizID).Scan(
+		&quiz.ID, &quiz.MaterialID, &quiz.Title, &quiz.Questions, &quiz.TimeLimit, &quiz.PassingScore,
+		&quiz.QuestionsPerAttempt, &quiz.Language, materialTitle, materialSubject,
+	)
+	return quiz, err
+}
+
+// guestQuestions returns the questions guest attempts are drawn from: the
+// quiz's, or the material's question bank when the quiz draws from it, with
+// the essays left out
+func (sc *ShareController) guestQuestions(quiz models.Quiz) ([]models.Question, error) {
+	questions := parseQuestions(quiz.Questions)
+	if quiz.QuestionsPerAttempt > 0 {
+		bank, err := bankQuestions(sc.DB, quiz.MaterialID)
+		if err != nil {
+			return nil, err
+		}
+		if len(bank) > 0 {
+			questions = bank
+		}
+	}
+
+	pool := make([]models.Question, 0, len(questions))
+	for _, question := range questions {
+		if question.Type != models.QuestionEssay {
+			pool = append(pool, question)
+		}
+	}
+	return pool, nil
+}
+
+// guestDeadline returns when a guest attempt's time runs out, and false when
+// the quiz has no time limit
+func guestDeadline(attempt models.GuestAttempt, timeLimit int) (time.Time, bool) {
+	return attemptDeadline(models.QuizAttempt{StartedAt: attempt.StartedAt}, timeLimit)
+}
+
+// newShareToken returns a random URL-safe token
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+const shareLinkColumns = `id, user_id, material_id, quiz_id, type, token, password_hash, expires_at, revoked_at, view_count, created_at`
+
+const prefixedShareLinkColumns = `l.id, l.user_id, l.material_id, l.quiz_id, l.type, l.token, l.password_hash, l.expires_at, l.revoked_at, l.view_count, l.created_at`
+
+// scanShareLink scans a row selected with shareLinkColumns, followed by any
+// extra destinations the query selects after them
+func scanShareLink(row rowScanner, extra ...interface{}) (models.ShareLink, error) {
+	var link models.ShareLink
+	dest := []interface{}{
+		&link.ID, &link.UserID, &link.MaterialID, &link.QuizID, &link.Type, &link.Token, &link.PasswordHash,
+		&link.ExpiresAt, &link.RevokedAt, &link.ViewCount, &link.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	link.HasPassword = link.PasswordHash != ""
+	return link, err
+}
+
+const guestAttemptColumns = `id, share_link_id, quiz_id, guest_name, status, questions, answers, question_times, results, score, correct, total, passed, time_spent, started_at, submitted_at`
+
+const prefixedGuestAttemptColumns = `g.id, g.share_link_id, g.quiz_id, g.guest_name, g.status, g.questions, g.answers, g.question_times, g.results, g.score, g.correct, g.total, g.passed, g.time_spent, g.started_at, g.submitted_at`
+
+// scanGuestAttempt scans a row selected with guestAttemptColumns, followed
+// by any extra destinations the query selects after them
+func scanGuestAttempt(row rowScanner, extra ...interface{}) (models.GuestAttempt, error) {
+	var attempt models.GuestAttempt
+	dest := []interface{}{
+		&attempt.ID, &attempt.ShareLinkID, &attempt.QuizID, &attempt.GuestName, &attempt.Status, &attempt.Questions,
+		&attempt.Answers, &attempt.QuestionTimes, &attempt.Results, &attempt.Score, &attempt.Correct, &attempt.Total,
+		&attempt.Passed, &attempt.TimeSpent, &attempt.StartedAt, &attempt.SubmittedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return attempt, err
+}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"database/sql"
-	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"quicacademy-backend/models"
@@ -18,10 +20,10 @@ type SummaryController struct {
 	AIService *services.OpenRouterService
 }
 
-func NewSummaryController(db *sql.DB) *SummaryController {
+func NewSummaryController(db *sql.DB, aiService *services.OpenRouterService) *SummaryController {
 	return &SummaryController{
 		DB:        db,
-		AIService: services.NewOpenRouterService(),
+		AIService: aiService,
 	}
 }
 
@@ -38,10 +40,16 @@ func (sc *SummaryController) GenerateSummary(c *gin.Context) {
 		return
 	}
 
+	var req models.SummaryGenerateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check if material exists and belongs to user
 	var material models.Material
-	query := `SELECT id, title, extracted_text FROM materials WHERE id = $1 AND user_id = $2`
-	err := sc.DB.QueryRow(query, materialID, userID).Scan(&material.ID, &material.Title, &material.ExtractedText)
+	query := `SELECT id, title, extracted_text, language FROM materials WHERE id = $1 AND user_id = $2`
+	err := sc.DB.QueryRow(query, materialID, userID).Scan(&material.ID, &material.Title, &material.ExtractedText, &material.Language)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
@@ -58,64 +66,139 @@ func (sc *SummaryController) GenerateSummary(c *gin.Context) {
 		return
 	}
 
-	// Check if summary already exists
-	var existingSummary models.Summary
-	summaryQuery := `SELECT id, bullet_points, paragraphs, concepts FROM summaries WHERE material_id = $1`
-	err = sc.DB.QueryRow(summaryQuery, materialID).Scan(
-		&existingSummary.ID, &existingSummary.BulletPoints,
-		&existingSummary.Paragraphs, &existingSummary.Concepts,
-	)
+	language, err := userLanguage(sc.DB, userID, req.Language)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
-	if err == nil {
-		// Summary exists, return it
-		c.JSON(http.StatusOK, gin.H{
-			"summary": existingSummary,
-			"material": gin.H{
-				"id":    material.ID,
-				"title": material.Title,
-			},
-		})
+	// Return the active summary unless a new version, or one in a different
+	// language than explicitly requested, was asked for
+	if !req.Regenerate {
+		summaryQuery := `SELECT ` + summaryColumns + ` FROM summaries WHERE material_id = $1 AND is_active`
+		existingSummary, err := scanSummary(sc.DB.QueryRow(summaryQuery, materialID))
+
+		if err == nil && (req.Language == "" || existingSummary.Language == req.Language) {
+			c.JSON(http.StatusOK, gin.H{
+				"summary": existingSummary,
+				"material": gin.H{
+					"id":    material.ID,
+					"title": material.Title,
+				},
+			})
+			return
+		}
+
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	opts := services.SummaryOptions{
+		Length:   req.Length,
+		Audience: req.Audience,
+		Style:    req.Style,
+		Language: language,
+	}.WithDefaults()
+
+	// Generation can take a while, so it runs as a background job the client
+	// polls. Only a repeat of the same options is folded into the job already
+	// running.
+	dedupKey := fmt.Sprintf("%s:%s:%s", JobTypeSummary, material.ID, requestKey(opts))
+	job, created, err := enqueueJobWithKey(sc.DB, userID.(uuid.UUID), material.ID, JobTypeSummary, dedupKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue summary generation"})
 		return
 	}
 
-	// Generate new summary using AI
-	bulletPoints, paragraphs, concepts, err := sc.AIService.GenerateSummary(material.ExtractedText)
+	if created {
+		go runJob(sc.DB, job.ID, func() (uuid.UUID, error) {
+			return sc.createSummary(userID.(uuid.UUID), material, opts, req.Regenerate)
+		})
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job": job,
+		"material": gin.H{
+			"id":    material.ID,
+			"title": material.Title,
+		},
+	})
+}
+
+// createSummary generates a summary for the material and saves it as the
+// new active version. Regenerating skips cached AI responses.
+func (sc *SummaryController) createSummary(userID uuid.UUID, material models.Material, opts services.SummaryOptions, regenerate bool) (uuid.UUID, error) {
+	call := services.CallContext{
+		UserID:     userID,
+		MaterialID: uuid.NullUUID{UUID: material.ID, Valid: true},
+		Feature:    services.FeatureSummary,
+		Refresh:    regenerate,
+	}
+
+	// A failed generation fails the job and keeps the active summary
+	bulletPoints, paragraphs, concepts, prompt, err := sc.AIService.GenerateSummary(call, material.ExtractedText, material.Language, opts)
 	if err != nil {
-		// Fallback to mock if AI fails
-		bulletPoints, paragraphs, concepts = sc.generateAISummary(material.ExtractedText)
+		return uuid.Nil, fmt.Errorf("failed to generate summary: %w", err)
 	}
 
-	// Save summary to database
 	newSummary := models.Summary{
-		ID:           uuid.New(),
-		MaterialID:   material.ID,
-		BulletPoints: bulletPoints,
-		Paragraphs:   paragraphs,
-		Concepts:     concepts,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		ID:             uuid.New(),
+		MaterialID:     material.ID,
+		BulletPoints:   bulletPoints,
+		Paragraphs:     paragraphs,
+		Concepts:       concepts,
+		Length:         opts.Length,
+		Audience:       opts.Audience,
+		Style:          opts.Style,
+		Language:       opts.Language,
+		IsActive:       true,
+		PromptTemplate: prompt.Name,
+		PromptVersion:  prompt.Version,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	tx, err := sc.DB.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the material so concurrent writers agree on the next version number
+	if _, err := tx.Exec(`SELECT id FROM materials WHERE id = $1 FOR UPDATE`, material.ID); err != nil {
+		return uuid.Nil, err
+	}
+
+	versionQuery := `SELECT COALESCE(MAX(version), 0) + 1 FROM summaries WHERE material_id = $1`
+	if err := tx.QueryRow(versionQuery, material.ID).Scan(&newSummary.Version); err != nil {
+		return uuid.Nil, err
+	}
+
+	deactivateQuery := `UPDATE summaries SET is_active = FALSE, updated_at = $1 WHERE material_id = $2 AND is_active`
+	if _, err := tx.Exec(deactivateQuery, time.Now(), material.ID); err != nil {
+		return uuid.Nil, err
 	}
 
-	insertQuery := `INSERT INTO summaries (id, material_id, bullet_points, paragraphs, concepts, created_at, updated_at)
-					VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	insertQuery := `INSERT INTO summaries (id, material_id, bullet_points, paragraphs, concepts, version, length, audience, style, language, is_active, prompt_template, prompt_version, created_at, updated_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
 
-	_, err = sc.DB.Exec(insertQuery,
+	_, err = tx.Exec(insertQuery,
 		newSummary.ID, newSummary.MaterialID, newSummary.BulletPoints,
-		newSummary.Paragraphs, newSummary.Concepts, newSummary.CreatedAt, newSummary.UpdatedAt,
+		newSummary.Paragraphs, newSummary.Concepts, newSummary.Version,
+		newSummary.Length, newSummary.Audience, newSummary.Style, newSummary.Language, newSummary.IsActive,
+		newSummary.PromptTemplate, newSummary.PromptVersion, newSummary.CreatedAt, newSummary.UpdatedAt,
 	)
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save summary"})
-		return
+		return uuid.Nil, fmt.Errorf("failed to save summary: %w", err)
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"summary": newSummary,
-		"material": gin.H{
-			"id":    material.ID,
-			"title": material.Title,
-		},
-	})
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+
+	return newSummary.ID, nil
 }
 
 func (sc *SummaryController) GetSummary(c *gin.Context) {
@@ -131,20 +214,14 @@ func (sc *SummaryController) GetSummary(c *gin.Context) {
 		return
 	}
 
-	// Verify material belongs to user and get summary
-	query := `SELECT s.id, s.bullet_points, s.paragraphs, s.concepts, s.created_at, s.updated_at,
-					 m.title, m.subject
+	// Verify material belongs to user and get the active summary
+	query := `SELECT ` + prefixedSummaryColumns + `, m.title, m.subject
 			  FROM summaries s
 			  JOIN materials m ON s.material_id = m.id
-			  WHERE m.id = $1 AND m.user_id = $2`
+			  WHERE m.id = $1 AND m.user_id = $2 AND s.is_active`
 
-	var summary models.Summary
 	var materialTitle, materialSubject string
-
-	err := sc.DB.QueryRow(query, materialID, userID).Scan(
-		&summary.ID, &summary.BulletPoints, &summary.Paragraphs, &summary.Concepts,
-		&summary.CreatedAt, &summary.UpdatedAt, &materialTitle, &materialSubject,
-	)
+	summary, err := scanSummary(sc.DB.QueryRow(query, materialID, userID), &materialTitle, &materialSubject)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
@@ -156,6 +233,10 @@ func (sc *SummaryController) GetSummary(c *gin.Context) {
 		return
 	}
 
+	if err := recordSummaryView(sc.DB, userID.(uuid.UUID), summary.MaterialID); err != nil {
+		log.Printf("Failed to record summary view of material %s: %v", summary.MaterialID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"summary": summary,
 		"material": gin.H{
@@ -166,48 +247,173 @@ func (sc *SummaryController) GetSummary(c *gin.Context) {
 	})
 }
 
-// Mock AI summary generation
-func (sc *SummaryController) generateAISummary(text string) (string, string, string) {
-	// This is a mock implementation
-	// In production, this would call OpenRouter API
+// ListSummaryVersions lists every summary version of a material, newest first
+func (sc *SummaryController) ListSummaryVersions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID := c.Param("id")
+	if materialID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Material ID required"})
+		return
+	}
 
-	bulletPoints := `• Konsep fundamental dalam topik ini
-• Definisi dan karakteristik utama
-• Aplikasi praktis dalam kehidupan sehari-hari
-• Hubungan dengan konsep lain yang terkait
-• Metode dan teknik yang digunakan
-• Contoh konkret dan studi kasus`
+	query := `SELECT ` + prefixedSummaryColumns + `
+			  FROM summaries s
+			  JOIN materials m ON s.material_id = m.id
+			  WHERE m.id = $1 AND m.user_id = $2
+			  ORDER BY s.version DESC`
 
-	paragraphs := `Materi ini membahas konsep-konsep fundamental yang sangat penting untuk dipahami. 
-Pembahasan dimulai dengan definisi dasar dan karakteristik utama yang membedakan topik ini dari yang lain.
+	rows, err := sc.DB.Query(query, materialID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.Summary{}
+	for rows.Next() {
+		summary, err := scanSummary(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan summary"})
+			return
+		}
+		versions = append(versions, summary)
+	}
 
-Aplikasi praktis dari konsep ini dapat ditemukan dalam berbagai aspek kehidupan sehari-hari, 
-memberikan relevansi yang tinggi bagi pembelajaran. Hubungan dengan konsep lain menunjukkan 
-bagaimana topik ini terintegrasi dalam sistem pengetahuan yang lebih luas.
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+		return
+	}
 
-Metode dan teknik yang dibahas memberikan pendekatan praktis untuk memahami dan menerapkan konsep. 
-Contoh konkret dan studi kasus membantu memperkuat pemahaman melalui ilustrasi yang nyata.`
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
 
-	conceptsData := []map[string]string{
-		{
-			"title":       "Konsep Dasar",
-			"description": "Fondasi pemahaman yang harus dikuasai terlebih dahulu",
-		},
-		{
-			"title":       "Prinsip Utama",
-			"description": "Aturan-aturan fundamental yang mengatur topik ini",
-		},
-		{
-			"title":       "Aplikasi Praktis",
-			"description": "Cara menerapkan konsep dalam situasi nyata",
-		},
-		{
-			"title":       "Hubungan Antar Konsep",
-			"description": "Keterkaitan dengan topik lain dalam bidang yang sama",
-		},
+// GetSummaryVersion returns a single summary version of a material
+func (sc *SummaryController) GetSummaryVersion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID := c.Param("id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if materialID == "" || err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Material ID and version required"})
+		return
+	}
+
+	query := `SELECT ` + prefixedSummaryColumns + `
+			  FROM summaries s
+			  JOIN materials m ON s.material_id = m.id
+			  WHERE m.id = $1 AND m.user_id = $2 AND s.version = $3`
+
+	summary, err := scanSummary(sc.DB.QueryRow(query, materialID, userID, version))
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Summary version not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"summary": summary})
+}
+
+// RestoreSummaryVersion makes an older summary version the active one
+func (sc *SummaryController) RestoreSummaryVersion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	materialID := c.Param("id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if materialID == "" || err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Material ID and version required"})
+		return
+	}
+
+	tx, err := sc.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var summaryID uuid.UUID
+	findQuery := `SELECT s.id
+				  FROM summaries s
+				  JOIN materials m ON s.material_id = m.id
+				  WHERE m.id = $1 AND m.user_id = $2 AND s.version = $3
+				  FOR UPDATE OF m`
+	err = tx.QueryRow(findQuery, materialID, userID, version).Scan(&summaryID)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Summary version not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	now := time.Now()
+	deactivateQuery := `UPDATE summaries SET is_active = FALSE, updated_at = $1 WHERE material_id = $2 AND is_active`
+	if _, err := tx.Exec(deactivateQuery, now, materialID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore summary"})
+		return
+	}
+
+	activateQuery := `UPDATE summaries SET is_active = TRUE, updated_at = $1 WHERE id = $2`
+	if _, err := tx.Exec(activateQuery, now, summaryID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore summary"})
+		return
 	}
 
-	conceptsJSON, _ := json.Marshal(conceptsData)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore summary"})
+		return
+	}
+
+	summary, err := scanSummary(sc.DB.QueryRow(`SELECT `+summaryColumns+` FROM summaries WHERE id = $1`, summaryID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"summary": summary,
+		"message": "Summary version restored",
+	})
+}
+
+const summaryColumns = `id, material_id, bullet_points, paragraphs, concepts, version, length, audience, style, language, is_active, prompt_template, prompt_version, created_at, updated_at`
+
+const prefixedSummaryColumns = `s.id, s.material_id, s.bullet_points, s.paragraphs, s.concepts, s.version, s.length, s.audience, s.style, s.language, s.is_active, s.prompt_template, s.prompt_version, s.created_at, s.updated_at`
 
-	return bulletPoints, paragraphs, string(conceptsJSON)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSummary scans a row selected with summaryColumns, followed by any
+// extra destinations the query selects after them
+func scanSummary(row rowScanner, extra ...interface{}) (models.Summary, error) {
+	var summary models.Summary
+	dest := []interface{}{
+		&summary.ID, &summary.MaterialID, &summary.BulletPoints, &summary.Paragraphs, &summary.Concepts,
+		&summary.Version, &summary.Length, &summary.Audience, &summary.Style, &summary.Language, &summary.IsActive,
+		&summary.PromptTemplate, &summary.PromptVersion, &summary.CreatedAt, &summary.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return summary, err
 }
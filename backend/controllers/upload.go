@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"quicacademy-backend/models"
+	"quicacademy-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -68,7 +69,7 @@ func (uc *UploadController) UploadFile(c *gin.Context) {
 	// Get metadata from form
 	title := c.PostForm("title")
 	subject := c.PostForm("subject")
-	
+
 	if title == "" {
 		title = strings.TrimSuffix(fileHeader.Filename, ext)
 	}
@@ -119,7 +120,7 @@ func (uc *UploadController) UploadFile(c *gin.Context) {
 	query := `INSERT INTO materials (id, user_id, title, subject, file_name, file_url, file_size, file_type, status, created_at, updated_at)
 			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 
-	_, err = uc.DB.Exec(query, 
+	_, err = uc.DB.Exec(query,
 		material.ID, material.UserID, material.Title, material.Subject,
 		material.FileName, material.FileURL, material.FileSize, material.FileType,
 		material.Status, material.CreatedAt, material.UpdatedAt,
@@ -150,7 +151,7 @@ func (uc *UploadController) GetMaterials(c *gin.Context) {
 		return
 	}
 
-	query := `SELECT id, user_id, title, subject, file_name, file_url, file_size, file_type, status, word_count, created_at, updated_at
+	query := `SELECT id, user_id, title, subject, file_name, file_url, file_size, file_type, status, word_count, language, created_at, updated_at
 			  FROM materials WHERE user_id = $1 ORDER BY created_at DESC`
 
 	rows, err := uc.DB.Query(query, userID)
@@ -166,7 +167,7 @@ func (uc *UploadController) GetMaterials(c *gin.Context) {
 		err := rows.Scan(
 			&material.ID, &material.UserID, &material.Title, &material.Subject,
 			&material.FileName, &material.FileURL, &material.FileSize, &material.FileType,
-			&material.Status, &material.WordCount, &material.CreatedAt, &material.UpdatedAt,
+			&material.Status, &material.WordCount, &material.Language, &material.CreatedAt, &material.UpdatedAt,
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan material"})
@@ -192,13 +193,13 @@ func (uc *UploadController) GetMaterial(c *gin.Context) {
 	}
 
 	var material models.Material
-	query := `SELECT id, user_id, title, subject, file_name, file_url, file_size, file_type, status, extracted_text, word_count, created_at, updated_at
+	query := `SELECT id, user_id, title, subject, file_name, file_url, file_size, file_type, status, extracted_text, word_count, language, created_at, updated_at
 			  FROM materials WHERE id = $1 AND user_id = $2`
 
 	err := uc.DB.QueryRow(query, materialID, userID).Scan(
 		&material.ID, &material.UserID, &material.Title, &material.Subject,
 		&material.FileName, &material.FileURL, &material.FileSize, &material.FileType,
-		&material.Status, &material.ExtractedText, &material.WordCount,
+		&material.Status, &material.ExtractedText, &material.WordCount, &material.Language,
 		&material.CreatedAt, &material.UpdatedAt,
 	)
 
@@ -220,13 +221,14 @@ func (uc *UploadController) processFile(material models.Material) {
 	// TODO: Implement actual text extraction and AI processing
 	// For now, just update status to completed after a delay
 	time.Sleep(5 * time.Second)
-	
+
 	// Simulate text extraction
 	extractedText := "Sample extracted text from " + material.FileName
 	wordCount := len(strings.Fields(extractedText))
-	
-	query := `UPDATE materials SET status = $1, extracted_text = $2, word_count = $3, updated_at = $4 WHERE id = $5`
-	_, err := uc.DB.Exec(query, "completed", extractedText, wordCount, time.Now(), material.ID)
+	language := services.DetectLanguage(extractedText)
+
+	query := `UPDATE materials SET status = $1, extracted_text = $2, word_count = $3, language = $4, updated_at = $5 WHERE id = $6`
+	_, err := uc.DB.Exec(query, "completed", extractedText, wordCount, language, time.Now(), material.ID)
 	if err != nil {
 		fmt.Printf("Failed to update material status: %v\n", err)
 	}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"quicacademy-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type UsageController struct {
+	DB *sql.DB
+}
+
+func NewUsageController(db *sql.DB) *UsageController {
+	return &UsageController{DB: db}
+}
+
+// GetMyUsage reports the caller's AI usage by day and feature
+func (uc *UsageController) GetMyUsage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.UsageReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uc.respondWithUsage(c, req, uuid.NullUUID{UUID: userID.(uuid.UUID), Valid: true})
+}
+
+// GetUsage reports AI usage by day and feature across all users, or for the
+// user given by user_id. Admin only.
+func (uc *UsageController) GetUsage(c *gin.Context) {
+	var req models.UsageReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID uuid.NullUUID
+	if req.UserID != "" {
+		userID = uuid.NullUUID{UUID: uuid.MustParse(req.UserID), Valid: true}
+	}
+
+	uc.respondWithUsage(c, req, userID)
+}
+
+func (uc *UsageController) respondWithUsage(c *gin.Context, req models.UsageReportRequest, userID uuid.NullUUID) {
+	from, to, err := usageRange(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// NULL user_id filter means every user
+	query := `SELECT TO_CHAR(created_at, 'YYYY-MM-DD') AS day, feature, COUNT(*), COUNT(*) FILTER (WHERE cached),
+					 COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+					 COALESCE(SUM(cost), 0), COALESCE(SUM(saved_cost), 0)
+			  FROM ai_usage
+			  WHERE created_at >= $1 AND created_at < $2 AND ($3::uuid IS NULL OR user_id = $3)
+			  GROUP BY day, feature
+			  ORDER BY day, feature`
+
+	rows, err := uc.DB.Query(query, from, to.AddDate(0, 0, 1), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	buckets := []models.UsageBucket{}
+	total := models.UsageBucket{Feature: "all"}
+	for rows.Next() {
+		var bucket models.UsageBucket
+		err := rows.Scan(
+			&bucket.Day, &bucket.Feature, &bucket.Requests, &bucket.CachedRequests,
+			&bucket.PromptTokens, &bucket.CompletionTokens, &bucket.Cost, &bucket.SavedCost,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan usage"})
+			return
+		}
+
+		total.Requests += bucket.Requests
+		total.CachedRequests += bucket.CachedRequests
+		total.PromptTokens += bucket.PromptTokens
+		total.CompletionTokens += bucket.CompletionTokens
+		total.Cost += bucket.Cost
+		total.SavedCost += bucket.SavedCost
+		buckets = append(buckets, bucket)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+		"usage": buckets,
+		"total": total,
+	})
+}
+
+// usageRange resolves the inclusive date range of a report, defaulting to
+// the last 30 days
+func usageRange(req models.UsageReportRequest) (from, to time.Time, err error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from, to = today.AddDate(0, 0, -29), today
+
+	// Dates were validated when binding the request
+	if req.From != "" {
+		from, _ = time.ParseInLocation("2006-01-02", req.From, time.Local)
+	}
+	if req.To != "" {
+		to, _ = time.ParseInLocation("2006-01-02", req.To, time.Local)
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+
+	return from, to, nil
+}
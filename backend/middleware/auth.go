@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"database/sql"
 	"net/http"
 	"strings"
 
@@ -37,3 +38,35 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireRole only lets users with one of roles through. It must run after
+// AuthMiddleware. The role is read from the database rather than the token so
+// role changes apply immediately.
+func RequireRole(db *sql.DB, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var role string
+		err := db.QueryRow(`SELECT role FROM users WHERE id = $1`, c.MustGet("user_id")).Scan(&role)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Set("role", role)
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
@@ -1,81 +1,299 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// User roles
+const (
+	RoleStudent = "student"
+	RoleTeacher = "teacher"
+	RoleAdmin   = "admin"
+)
+
 type User struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name" validate:"required,min=2,max=100"`
-	Email     string    `json:"email" db:"email" validate:"required,email"`
-	Password  string    `json:"-" db:"password_hash" validate:"required,min=6"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID                uuid.UUID `json:"id" db:"id"`
+	Name              string    `json:"name" db:"name" validate:"required,min=2,max=100"`
+	Email             string    `json:"email" db:"email" validate:"required,email"`
+	Password          string    `json:"-" db:"password_hash" validate:"required,min=6"`
+	PreferredLanguage string    `json:"preferred_language" db:"preferred_language"` // id, en, id-en
+	Role              string    `json:"role" db:"role"`                             // student, teacher, admin
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Material struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	UserID       uuid.UUID `json:"user_id" db:"user_id"`
-	Title        string    `json:"title" db:"title" validate:"required,min=1,max=200"`
-	Subject      string    `json:"subject" db:"subject" validate:"required,min=1,max=100"`
-	FileName     string    `json:"file_name" db:"file_name"`
-	FileURL      string    `json:"file_url" db:"file_url"`
-	FileSize     int64     `json:"file_size" db:"file_size"`
-	FileType     string    `json:"file_type" db:"file_type"`
-	Status       string    `json:"status" db:"status"` // uploading, processing, completed, error
-	ExtractedText string   `json:"extracted_text" db:"extracted_text"`
-	WordCount    int       `json:"word_count" db:"word_count"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID            uuid.UUID `json:"id" db:"id"`
+	UserID        uuid.UUID `json:"user_id" db:"user_id"`
+	Title         string    `json:"title" db:"title" validate:"required,min=1,max=200"`
+	Subject       string    `json:"subject" db:"subject" validate:"required,min=1,max=100"`
+	FileName      string    `json:"file_name" db:"file_name"`
+	FileURL       string    `json:"file_url" db:"file_url"`
+	FileSize      int64     `json:"file_size" db:"file_size"`
+	FileType      string    `json:"file_type" db:"file_type"`
+	Status        string    `json:"status" db:"status"` // uploading, processing, completed, error
+	ExtractedText string    `json:"extracted_text" db:"extracted_text"`
+	WordCount     int       `json:"word_count" db:"word_count"`
+	Language      string    `json:"language" db:"language"` // detected during extraction: id, en
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Summary struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	MaterialID   uuid.UUID `json:"material_id" db:"material_id"`
-	BulletPoints string    `json:"bullet_points" db:"bullet_points"`
-	Paragraphs   string    `json:"paragraphs" db:"paragraphs"`
-	Concepts     string    `json:"concepts" db:"concepts"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID             uuid.UUID `json:"id" db:"id"`
+	MaterialID     uuid.UUID `json:"material_id" db:"material_id"`
+	BulletPoints   string    `json:"bullet_points" db:"bullet_points"`
+	Paragraphs     string    `json:"paragraphs" db:"paragraphs"`
+	Concepts       string    `json:"concepts" db:"concepts"`
+	Version        int       `json:"version" db:"version"`
+	Length         string    `json:"length" db:"length"`     // brief, standard, detailed
+	Audience       string    `json:"audience" db:"audience"` // smp, sma, university
+	Style          string    `json:"style" db:"style"`       // default, exam_cram, eli5, outline
+	Language       string    `json:"language" db:"language"` // id, en, id-en
+	IsActive       bool      `json:"is_active" db:"is_active"`
+	PromptTemplate string    `json:"prompt_template" db:"prompt_template"` // empty when the fallback was used
+	PromptVersion  int       `json:"prompt_version" db:"prompt_version"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Quiz struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	MaterialID  uuid.UUID `json:"material_id" db:"material_id"`
-	Title       string    `json:"title" db:"title"`
-	Questions   string    `json:"questions" db:"questions"` // JSON array of questions
-	TimeLimit   int       `json:"time_limit" db:"time_limit"` // in seconds
-	PassingScore int      `json:"passing_score" db:"passing_score"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID                  uuid.UUID `json:"id" db:"id"`
+	MaterialID          uuid.UUID `json:"material_id" db:"material_id"`
+	Title               string    `json:"title" db:"title"`
+	Questions           string    `json:"questions" db:"questions"`   // JSON array of questions
+	TimeLimit           int       `json:"time_limit" db:"time_limit"` // in seconds
+	PassingScore        int       `json:"passing_score" db:"passing_score"`
+	Language            string    `json:"language" db:"language"`               // id, en, id-en
+	PromptTemplate      string    `json:"prompt_template" db:"prompt_template"` // empty when the fallback was used
+	PromptVersion       int       `json:"prompt_version" db:"prompt_version"`
+	MaxAttempts         int       `json:"max_attempts" db:"max_attempts"`                   // 0 means unlimited
+	QuestionsPerAttempt int       `json:"questions_per_attempt" db:"questions_per_attempt"` // drawn from the question bank, 0 uses the quiz's own questions
+	Adaptive            bool      `json:"adaptive" db:"adaptive"`                           // questions picked one at a time by estimated ability
+	TargetStandardError float64   `json:"target_standard_error" db:"target_standard_error"` // adaptive attempts stop once the ability is this precise
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Question types
+const (
+	QuestionMultipleChoice = "multiple_choice"
+	QuestionTrueFalse      = "true_false"
+	QuestionMultiSelect    = "multi_select"
+	QuestionFillBlank      = "fill_blank"
+	QuestionShortAnswer    = "short_answer"
+	QuestionMatching       = "matching"
+	QuestionOrdering       = "ordering"
+	QuestionNumeric        = "numeric"
+	QuestionEssay          = "essay"
+)
+
+// Question is one entry of Quiz.Questions. Options are stored without their
+// letter prefix and are identified by position: the first option is "A", the
+// second "B" and so on. The answer key depends on the type:
+//
+//   - multiple_choice: CorrectAnswer is an option ID
+//   - true_false: CorrectAnswer is "true" or "false"
+//   - multi_select: CorrectAnswers lists every option ID to select
+//   - fill_blank, short_answer: CorrectAnswer and AcceptedAnswers are the
+//     accepted texts, compared ignoring case, spacing and punctuation
+//   - matching: Prompts are matched to Options, CorrectAnswers holds the
+//     option ID for each prompt in order
+//   - ordering: Options are the items in display order, CorrectAnswers their
+//     option IDs in the correct order
+//   - numeric: CorrectAnswer is a number, answers within Tolerance count
+//   - essay: graded by the AI against Rubric, with ModelAnswer as a reference
+//
+// Generated questions may describe matching with Pairs and ordering with
+// Items instead; they are converted to the form above when normalized.
+//
+// Concept tags the question for the question bank and Concepts lists every
+// summary concept it tests, for concept mastery; BankID links a question to
+// its bank entry.
+type Question struct {
+	ID              int               `json:"id"`
+	Type            string            `json:"type"`
+	Question        string            `json:"question"`
+	Prompts         []string          `json:"prompts,omitempty"`
+	Options         []string          `json:"options,omitempty"`
+	CorrectAnswer   string            `json:"correct_answer,omitempty"`
+	CorrectAnswers  []string          `json:"correct_answers,omitempty"`
+	AcceptedAnswers []string          `json:"accepted_answers,omitempty"`
+	Tolerance       float64           `json:"tolerance,omitempty"`
+	Pairs           []MatchPair       `json:"pairs,omitempty"`
+	Items           []string          `json:"items,omitempty"`
+	Rubric          []RubricCriterion `json:"rubric,omitempty"`
+	ModelAnswer     string            `json:"model_answer,omitempty"`
+	Explanation     string            `json:"explanation"`
+	Difficulty      string            `json:"difficulty"`
+	Concept         string            `json:"concept,omitempty"`
+	Concepts        []string          `json:"concepts,omitempty"`
+	BankID          *uuid.UUID        `json:"bank_id,omitempty"`
+}
+
+// MatchPair is one pair of a generated matching question
+type MatchPair struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
 }
 
+// RubricCriterion is one criterion an essay is graded on
+type RubricCriterion struct {
+	Criterion   string `json:"criterion"`
+	Description string `json:"description,omitempty"`
+	Points      int    `json:"points"`
+}
+
+// CriterionScore is the score an essay earned on one rubric criterion
+type CriterionScore struct {
+	Criterion string  `json:"criterion"`
+	Points    float64 `json:"points"`
+	MaxPoints int     `json:"max_points"`
+	Feedback  string  `json:"feedback,omitempty"`
+}
+
+// Answer is the answer to one question. Single-valued answers are sent as a
+// JSON string (or number), multi_select, matching and ordering answers as a
+// list of strings; matching lists follow the order of the prompts.
+type Answer []string
+
+// UnmarshalJSON accepts a string, a number, a list of strings or null
+func (a *Answer) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+	case string:
+		*a = Answer{v}
+	case float64:
+		*a = Answer{strconv.FormatFloat(v, 'f', -1, 64)}
+	case bool:
+		*a = Answer{strconv.FormatBool(v)}
+	case []interface{}:
+		list := make(Answer, len(v))
+		for i, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("answer lists must contain strings")
+			}
+			list[i] = text
+		}
+		*a = list
+	default:
+		return fmt.Errorf("answer must be a string or a list of strings")
+	}
+
+	return nil
+}
+
+// MarshalJSON writes single values as a plain string, so answers to single
+// choice questions look the same as before lists were supported
+func (a Answer) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Quiz attempt statuses
+const (
+	AttemptInProgress = "in_progress"
+	AttemptSubmitted  = "submitted"
+	AttemptExpired    = "expired" // submitted automatically when time ran out
+)
+
+// Grading statuses of a finished attempt. Essays stay pending until the AI
+// or a teacher has scored them.
+const (
+	GradingGraded  = "graded"
+	GradingPending = "pending"
+)
+
+// QuizAttempt is a quiz session. It is created in_progress when the quiz is
+// started and graded once submitted or expired.
 type QuizAttempt struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	UserID    uuid.UUID `json:"user_id" db:"user_id"`
-	QuizID    uuid.UUID `json:"quiz_id" db:"quiz_id"`
-	Answers   string    `json:"answers" db:"answers"` // JSON object of answers
-	Score     int       `json:"score" db:"score"`
-	TimeSpent int       `json:"time_spent" db:"time_spent"` // in seconds
-	Passed    bool      `json:"passed" db:"passed"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	QuizID        uuid.UUID  `json:"quiz_id" db:"quiz_id"`
+	Status        string     `json:"status" db:"status"`
+	QuestionOrder string     `json:"question_order" db:"question_order"` // JSON array of question IDs
+	Seed          int64      `json:"seed" db:"seed"`                     // assembles Questions, 0 on older attempts
+	Questions     string     `json:"questions" db:"questions"`           // JSON array of the questions as presented
+	Answers       string     `json:"answers" db:"answers"`               // JSON object of answers
+	QuestionTimes string     `json:"question_times" db:"question_times"` // JSON object of seconds spent per question
+	Version       int        `json:"version" db:"version"`               // bumped on every autosave
+	Results       string     `json:"results" db:"results"`               // JSON array of per-question results
+	Score         int        `json:"score" db:"score"`
+	TimeSpent     int        `json:"time_spent" db:"time_spent"` // in seconds, measured by the server
+	Passed        bool       `json:"passed" db:"passed"`
+	GradingStatus string     `json:"grading_status" db:"grading_status"`
+	Ability       *float64   `json:"ability,omitempty" db:"ability"`           // adaptive attempts only
+	StandardError *float64   `json:"standard_error,omitempty" db:"ability_se"` // of Ability
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	SubmittedAt   *time.Time `json:"submitted_at" db:"submitted_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 }
 
 type Progress struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	UserID       uuid.UUID `json:"user_id" db:"user_id"`
-	MaterialID   uuid.UUID `json:"material_id" db:"material_id"`
-	HasViewedSummary bool  `json:"has_viewed_summary" db:"has_viewed_summary"`
-	HasTakenQuiz     bool  `json:"has_taken_quiz" db:"has_taken_quiz"`
-	BestScore        int   `json:"best_score" db:"best_score"`
-	TotalAttempts    int   `json:"total_attempts" db:"total_attempts"`
+	ID               uuid.UUID `json:"id" db:"id"`
+	UserID           uuid.UUID `json:"user_id" db:"user_id"`
+	MaterialID       uuid.UUID `json:"material_id" db:"material_id"`
+	HasViewedSummary bool      `json:"has_viewed_summary" db:"has_viewed_summary"`
+	HasTakenQuiz     bool      `json:"has_taken_quiz" db:"has_taken_quiz"`
+	BestScore        int       `json:"best_score" db:"best_score"`
+	TotalAttempts    int       `json:"total_attempts" db:"total_attempts"`
 	LastAccessedAt   time.Time `json:"last_accessed_at" db:"last_accessed_at"`
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
 
+type ChatMessage struct {
+	ID             uuid.UUID     `json:"id" db:"id"`
+	UserID         uuid.UUID     `json:"user_id" db:"user_id"`
+	MaterialID     uuid.NullUUID `json:"material_id" db:"material_id"`
+	Message        string        `json:"message" db:"message"`
+	Response       string        `json:"response" db:"response"`
+	Language       string        `json:"language" db:"language"`
+	PromptTemplate string        `json:"prompt_template" db:"prompt_template"`
+	PromptVersion  int           `json:"prompt_version" db:"prompt_version"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+}
+
+type AIUsage struct {
+	ID               uuid.UUID     `json:"id" db:"id"`
+	UserID           uuid.UUID     `json:"user_id" db:"user_id"`
+	MaterialID       uuid.NullUUID `json:"material_id" db:"material_id"`
+	Feature          string        `json:"feature" db:"feature"` // summary, quiz, chat
+	Model            string        `json:"model" db:"model"`
+	PromptTokens     int           `json:"prompt_tokens" db:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens" db:"completion_tokens"`
+	Cost             float64       `json:"cost" db:"cost"` // USD
+	Cached           bool          `json:"cached" db:"cached"`
+	SavedCost        float64       `json:"saved_cost" db:"saved_cost"` // USD a cache hit would have cost
+	CreatedAt        time.Time     `json:"created_at" db:"created_at"`
+}
+
+type Job struct {
+	ID         uuid.UUID     `json:"id" db:"id"`
+	UserID     uuid.UUID     `json:"user_id" db:"user_id"`
+	MaterialID uuid.UUID     `json:"material_id" db:"material_id"`
+	Type       string        `json:"type" db:"type"`     // summary, quiz
+	Status     string        `json:"status" db:"status"` // pending, running, completed, failed
+	ResultID   uuid.NullUUID `json:"result_id" db:"result_id"`
+	Error      string        `json:"error,omitempty" db:"error"`
+	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at" db:"updated_at"`
+}
+
 // Request/Response DTOs
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
@@ -88,6 +306,298 @@ type RegisterRequest struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+type UpdateProfileRequest struct {
+	Name              string `json:"name" binding:"omitempty,min=2,max=100"`
+	PreferredLanguage string `json:"preferred_language" binding:"omitempty,oneof=id en id-en"`
+}
+
+type UsageReportRequest struct {
+	From   string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To     string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	UserID string `form:"user_id" binding:"omitempty,uuid"`
+}
+
+// UsageBucket aggregates AI usage for one day and feature
+type UsageBucket struct {
+	Day              string  `json:"day"`
+	Feature          string  `json:"feature"`
+	Requests         int     `json:"requests"`
+	CachedRequests   int     `json:"cached_requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	SavedCost        float64 `json:"saved_cost"`
+}
+
+// ConceptMastery is the estimated chance that a user has mastered a concept
+// of a material, traced from their graded answers
+type ConceptMastery struct {
+	Concept         string     `json:"concept" db:"concept"`
+	Mastery         float64    `json:"mastery" db:"mastery"` // 0-1
+	Level           string     `json:"level" db:"-"`         // not_started, needs_review, learning, mastered
+	Responses       int        `json:"responses" db:"responses"`
+	LastPracticedAt *time.Time `json:"last_practiced_at" db:"last_practiced_at"`
+}
+
+// FlashcardDeck is a set of flashcards a user studies about a material
+type FlashcardDeck struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	MaterialID     uuid.UUID `json:"material_id" db:"material_id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	Title          string    `json:"title" db:"title"`
+	Language       string    `json:"language" db:"language"`               // id, en, id-en
+	PromptTemplate string    `json:"prompt_template" db:"prompt_template"` // empty when built from the summary's concepts
+	PromptVersion  int       `json:"prompt_version" db:"prompt_version"`
+	CardCount      int       `json:"card_count" db:"-"`
+	DueCount       int       `json:"due_count" db:"-"` // cards due now
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Flashcard is one card of a deck with its SM-2 review schedule
+type Flashcard struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	DeckID         uuid.UUID  `json:"deck_id" db:"deck_id"`
+	Front          string     `json:"front" db:"front"`
+	Back           string     `json:"back" db:"back"`
+	Concept        string     `json:"concept" db:"concept"`
+	Position       int        `json:"position" db:"position"`
+	EaseFactor     float64    `json:"ease_factor" db:"ease_factor"`
+	IntervalDays   int        `json:"interval_days" db:"interval_days"`
+	Repetitions    int        `json:"repetitions" db:"repetitions"` // successful reviews in a row
+	Lapses         int        `json:"lapses" db:"lapses"`
+	DueAt          time.Time  `json:"due_at" db:"due_at"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at" db:"last_reviewed_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// FlashcardGenerateRequest configures a deck generated from a material's
+// summary
+type FlashcardGenerateRequest struct {
+	Title     string `json:"title" form:"title" binding:"max=200"`
+	CardCount int    `json:"card_count" form:"card_count" binding:"omitempty,min=1,max=50"`
+	Language  string `json:"language" form:"language" binding:"omitempty,oneof=id en id-en"`
+}
+
+// FlashcardDeckRequest renames a deck
+type FlashcardDeckRequest struct {
+	Title string `json:"title" binding:"required,max=200"`
+}
+
+// FlashcardRequest adds a card to a deck or edits one
+type FlashcardRequest struct {
+	Front   string `json:"front" binding:"required,max=1000"`
+	Back    string `json:"back" binding:"required,max=2000"`
+	Concept string `json:"concept" binding:"max=200"`
+}
+
+// FlashcardReviewRequest grades how well a card was recalled, from 0 (not
+// at all) to 5 (perfectly)
+type FlashcardReviewRequest struct {
+	Grade *int `json:"grade" binding:"required,min=0,max=5"`
+}
+
+// DueReviewsRequest lists the cards due by the end of today in the given
+// IANA timezone
+type DueReviewsRequest struct {
+	Timezone string `form:"timezone"`
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+// AnkiExportRequest selects the format of an Anki export: an .apkg package
+// or a CSV or TSV text file
+type AnkiExportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=apkg csv tsv"`
+}
+
+// QuizExportRequest selects the format of a quiz export: one of the Anki
+// formats, Moodle XML, GIFT or an IMS QTI 2.1 package
+type QuizExportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=apkg csv tsv moodle gift qti"`
+}
+
+// QuestionBankExportRequest selects the interchange format of a question
+// bank export
+type QuestionBankExportRequest struct {
+	Format string `form:"format" binding:"required,oneof=moodle gift qti"`
+}
+
+// QuizImportRequest are the form fields of a quiz import besides the file.
+// The format is inferred from the file's extension when not given.
+type QuizImportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=moodle gift qti"`
+	Title  string `form:"title" binding:"omitempty,max=200"`
+}
+
+// SummaryExportRequest selects the format of a summary export and,
+// optionally, a version other than the active one
+type SummaryExportRequest struct {
+	Format  string `form:"format" binding:"omitempty,oneof=pdf md docx"`
+	Version int    `form:"version" binding:"omitempty,min=1"`
+}
+
+// Kinds of content a share link opens
+const (
+	ShareSummary = "summary"
+	ShareQuiz    = "quiz"
+)
+
+// ShareLink gives anyone with its token read-only access to a material's
+// summary, or lets them take a quiz as a guest
+type ShareLink struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	MaterialID   uuid.UUID  `json:"material_id" db:"material_id"`
+	QuizID       *uuid.UUID `json:"quiz_id" db:"quiz_id"` // quiz links only
+	Type         string     `json:"type" db:"type"`       // summary, quiz
+	Token        string     `json:"token" db:"token"`
+	PasswordHash string     `json:"-" db:"password_hash"` // empty without a password
+	HasPassword  bool       `json:"has_password" db:"-"`
+	ExpiresAt    *time.Time `json:"expires_at" db:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at" db:"revoked_at"`
+	ViewCount    int        `json:"view_count" db:"view_count"`
+	AttemptCount int        `json:"attempt_count" db:"-"` // guest attempts submitted
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ShareLinkRequest creates a share link. ResourceID is the material ID of
+// a summary link and the quiz ID of a quiz link.
+type ShareLinkRequest struct {
+	Type       string     `json:"type" binding:"required,oneof=summary quiz"`
+	ResourceID string     `json:"resource_id" binding:"required,uuid"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Password   string     `json:"password" binding:"omitempty,min=4,max=72"`
+}
+
+// ShareLinkListRequest filters the share links of the user
+type ShareLinkListRequest struct {
+	MaterialID string `form:"material_id" binding:"omitempty,uuid"`
+	Type       string `form:"type" binding:"omitempty,oneof=summary quiz"`
+}
+
+// GuestAttempt is an attempt at a shared quiz by someone without an account.
+// Guest attempts are kept apart from quiz attempts and count towards no
+// one's progress.
+type GuestAttempt struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	ShareLinkID   uuid.UUID  `json:"share_link_id" db:"share_link_id"`
+	QuizID        uuid.UUID  `json:"quiz_id" db:"quiz_id"`
+	GuestName     string     `json:"guest_name" db:"guest_name"`
+	Status        string     `json:"status" db:"status"`    // in_progress, submitted, expired
+	Questions     string     `json:"-" db:"questions"`      // JSON array of the questions as presented
+	Answers       string     `json:"-" db:"answers"`        // JSON object of answers
+	QuestionTimes string     `json:"-" db:"question_times"` // JSON object of seconds spent per question
+	Results       string     `json:"-" db:"results"`        // JSON array of per-question results
+	Score         int        `json:"score" db:"score"`
+	Correct       int        `json:"correct" db:"correct"`
+	Total         int        `json:"total" db:"total"`
+	Passed        bool       `json:"passed" db:"passed"`
+	TimeSpent     int        `json:"time_spent" db:"time_spent"` // in seconds, measured by the server
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	SubmittedAt   *time.Time `json:"submitted_at" db:"submitted_at"`
+}
+
+// GuestAttemptRequest starts an attempt at a shared quiz
+type GuestAttemptRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// GuestSubmission submits the answers of a guest attempt
+type GuestSubmission struct {
+	Answers   map[string]Answer `json:"answers"`
+	TimeSpent map[string]int    `json:"time_spent" binding:"omitempty,dive,min=0"` // seconds spent on each question
+}
+
+// DueFlashcard is a card due for review with the deck and material it
+// belongs to
+type DueFlashcard struct {
+	Flashcard
+	DeckTitle     string    `json:"deck_title"`
+	MaterialID    uuid.UUID `json:"material_id"`
+	MaterialTitle string    `json:"material_title"`
+}
+
+// Activity types recorded in the activity log
+const (
+	ActivitySummaryView     = "summary_view"
+	ActivityStudy           = "study" // a study session reported by the client
+	ActivityFlashcardReview = "flashcard_review"
+)
+
+// ActivityLog is one learning activity of a user, optionally on a material
+type ActivityLog struct {
+	ID              uuid.UUID     `json:"id" db:"id"`
+	UserID          uuid.UUID     `json:"user_id" db:"user_id"`
+	MaterialID      uuid.NullUUID `json:"material_id" db:"material_id"`
+	Type            string        `json:"type" db:"type"`
+	DurationSeconds int           `json:"duration_seconds" db:"duration_seconds"`
+	OccurredAt      time.Time     `json:"occurred_at" db:"occurred_at"`
+}
+
+// StudySessionRequest reports time spent studying, e.g. reading a summary
+type StudySessionRequest struct {
+	MaterialID      string `json:"material_id" binding:"omitempty,uuid"`
+	DurationSeconds int    `json:"duration_seconds" binding:"required,min=1,max=14400"`
+}
+
+// AnalyticsOverviewRequest selects the date range of the analytics overview,
+// in the given IANA timezone, and how many days without activity make a
+// material stale
+type AnalyticsOverviewRequest struct {
+	From      string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To        string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Timezone  string `form:"timezone"`
+	StaleDays int    `form:"stale_days" binding:"omitempty,min=1,max=365"`
+}
+
+// WeeklyActivity aggregates a user's learning for one week, starting Monday
+type WeeklyActivity struct {
+	WeekStart    string `json:"week_start"`
+	StudySeconds int    `json:"study_seconds"` // quiz time plus reported study sessions
+	QuizzesTaken int    `json:"quizzes_taken"`
+	AverageScore *int   `json:"average_score"` // nil without quizzes
+}
+
+// SubjectPerformance is a user's average quiz score in one subject
+type SubjectPerformance struct {
+	Subject      string `json:"subject"`
+	Attempts     int    `json:"attempts"`
+	AverageScore int    `json:"average_score"`
+}
+
+// StaleMaterial is a material the user hasn't touched for a while
+type StaleMaterial struct {
+	ID             uuid.UUID `json:"id"`
+	Title          string    `json:"title"`
+	Subject        string    `json:"subject"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+	DaysInactive   int       `json:"days_inactive"`
+}
+
+// AnalyticsOverview is the learning analytics dashboard of a user
+type AnalyticsOverview struct {
+	From             string               `json:"from"`
+	To               string               `json:"to"`
+	Timezone         string               `json:"timezone"`
+	StudySeconds     int                  `json:"study_seconds"`
+	QuizzesTaken     int                  `json:"quizzes_taken"`
+	AverageScore     *int                 `json:"average_score"`
+	Weeks            []WeeklyActivity     `json:"weeks"`
+	Subjects         []SubjectPerformance `json:"subjects"` // best first
+	StrongestSubject *SubjectPerformance  `json:"strongest_subject"`
+	WeakestSubject   *SubjectPerformance  `json:"weakest_subject"` // nil with fewer than two subjects
+	StaleDays        int                  `json:"stale_days"`
+	StaleMaterials   []StaleMaterial      `json:"stale_materials"`
+}
+
+type CacheInvalidateRequest struct {
+	Key        string `form:"key"`
+	MaterialID string `form:"material_id" binding:"omitempty,uuid"`
+	Template   string `form:"template"`
+	All        bool   `form:"all"`
+}
+
 type AuthResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
@@ -102,6 +612,106 @@ type SummaryRequest struct {
 	MaterialID string `json:"material_id" validate:"required,uuid"`
 }
 
+type SummaryGenerateRequest struct {
+	Regenerate bool   `form:"regenerate"`
+	Length     string `form:"length" binding:"omitempty,oneof=brief standard detailed"`
+	Audience   string `form:"audience" binding:"omitempty,oneof=smp sma university"`
+	Style      string `form:"style" binding:"omitempty,oneof=default exam_cram eli5 outline"`
+	Language   string `form:"language" binding:"omitempty,oneof=id en id-en"`
+}
+
 type QuizRequest struct {
 	MaterialID string `json:"material_id" validate:"required,uuid"`
 }
+
+// AnswerDraftRequest autosaves answers into an open attempt. Version must be
+// the attempt version the client last saw.
+type AnswerDraftRequest struct {
+	Answers   map[string]Answer `json:"answers" binding:"required"`
+	Version   *int              `json:"version" binding:"required,min=0"`
+	TimeSpent map[string]int    `json:"time_spent" binding:"omitempty,dive,min=0"` // seconds spent on each question so far
+}
+
+// AdaptiveAnswerRequest answers the current question of an adaptive attempt
+type AdaptiveAnswerRequest struct {
+	QuestionID int    `json:"question_id" binding:"required,min=1"`
+	Answer     Answer `json:"answer"`
+}
+
+// ScoreOverrideRequest replaces the score of one question of an attempt.
+// Points are out of the question's rubric total, or out of 1 for questions
+// without a rubric.
+type ScoreOverrideRequest struct {
+	Points   *float64 `json:"points" binding:"required,min=0"`
+	Feedback string   `json:"feedback"`
+}
+
+// DifficultyMix is the share of questions, in percent, at each difficulty.
+// All zero leaves the mix to the generator.
+type DifficultyMix struct {
+	Easy   int `json:"easy" binding:"min=0,max=100"`
+	Medium int `json:"medium" binding:"min=0,max=100"`
+	Hard   int `json:"hard" binding:"min=0,max=100"`
+}
+
+// Split divides count questions by the mix, giving leftovers from rounding
+// to the difficulties with the largest remainders
+func (mix DifficultyMix) Split(count int) (easy, medium, hard int) {
+	total := mix.Easy + mix.Medium + mix.Hard
+	if total == 0 {
+		return 0, 0, 0
+	}
+
+	shares := []int{mix.Easy, mix.Medium, mix.Hard}
+	counts := make([]int, 3)
+	remainders := make([]int, 3)
+	assigned := 0
+	for i, share := range shares {
+		counts[i] = count * share / total
+		remainders[i] = count * share % total
+		assigned += counts[i]
+	}
+
+	for ; assigned < count; assigned++ {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		counts[largest]++
+		remainders[largest] = -1
+	}
+
+	return counts[0], counts[1], counts[2]
+}
+
+// QuizGenerateRequest configures a generated quiz. It is read from the JSON
+// body; language and max_attempts are also accepted as query parameters.
+type QuizGenerateRequest struct {
+	Title               string         `json:"title" binding:"max=200"`
+	QuestionCount       int            `json:"question_count" binding:"min=0,max=50"`
+	Difficulty          *DifficultyMix `json:"difficulty"`
+	Types               []string       `json:"types" binding:"dive,oneof=multiple_choice true_false multi_select fill_blank short_answer matching ordering numeric essay"`
+	FocusConcepts       []string       `json:"focus_concepts" binding:"max=20,dive,required,max=200"`
+	FocusPages          []int          `json:"focus_pages" binding:"max=100,dive,min=1"`
+	TimeLimit           int            `json:"time_limit" binding:"omitempty,min=60,max=28800"` // seconds
+	PassingScore        *int           `json:"passing_score" binding:"omitempty,min=0,max=100"`
+	Language            string         `json:"language" form:"language" binding:"omitempty,oneof=id en id-en"`
+	MaxAttempts         int            `json:"max_attempts" form:"max_attempts" binding:"min=0"`
+	QuestionsPerAttempt int            `json:"questions_per_attempt" binding:"min=0,max=50"`            // drawn from the question bank
+	Adaptive            bool           `json:"adaptive"`                                                // ask bank questions one at a time by ability
+	TargetStandardError float64        `json:"target_standard_error" binding:"omitempty,min=0.1,max=1"` // when adaptive attempts stop
+}
+
+// QuestionBankEntry is a question kept in a material's question bank
+type QuestionBankEntry struct {
+	ID         uuid.UUID     `json:"id" db:"id"`
+	MaterialID uuid.UUID     `json:"material_id" db:"material_id"`
+	QuizID     uuid.NullUUID `json:"quiz_id" db:"quiz_id"` // the quiz it was generated for
+	Type       string        `json:"type" db:"type"`
+	Concept    string        `json:"concept" db:"concept"`
+	Difficulty string        `json:"difficulty" db:"difficulty"`
+	Question   Question      `json:"question" db:"question"`
+	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
+}
@@ -5,27 +5,37 @@ import (
 
 	"quicacademy-backend/controllers"
 	"quicacademy-backend/middleware"
+	"quicacademy-backend/models"
+	"quicacademy-backend/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(db *sql.DB, jwtSecret string) *gin.Engine {
+func SetupRoutes(db *sql.DB, jwtSecret string, aiService *services.OpenRouterService) *gin.Engine {
 	r := gin.Default()
 
 	// CORS middleware
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:3000", "http://localhost:3001"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", controllers.SharePasswordHeader}
+	config.ExposeHeaders = []string{"Content-Disposition", controllers.SkippedQuestionsHeader}
 	r.Use(cors.New(config))
 
 	// Initialize controllers
 	authController := controllers.NewAuthController(db, jwtSecret)
 	uploadController := controllers.NewUploadController(db)
-	summaryController := controllers.NewSummaryController(db)
-	quizController := controllers.NewQuizController(db)
-	assistantController := controllers.NewAssistantController(db)
+	summaryController := controllers.NewSummaryController(db, aiService)
+	quizController := controllers.NewQuizController(db, aiService)
+	flashcardController := controllers.NewFlashcardController(db, aiService)
+	assistantController := controllers.NewAssistantController(db, aiService)
+	jobController := controllers.NewJobController(db)
+	progressController := controllers.NewProgressController(db)
+	analyticsController := controllers.NewAnalyticsController(db)
+	usageController := controllers.NewUsageController(db)
+	cacheController := controllers.NewCacheController(aiService.Cache)
+	shareController := controllers.NewShareController(db)
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -42,12 +52,21 @@ func SetupRoutes(db *sql.DB, jwtSecret string) *gin.Engine {
 			auth.POST("/login", authController.Login)
 		}
 
+		// Shared summaries and quizzes, opened by link token
+		shared := api.Group("/shared")
+		{
+			shared.GET("/:token", shareController.GetSharedContent)
+			shared.POST("/:token/attempts", shareController.StartGuestAttempt)
+			shared.POST("/:token/attempts/:attemptId/submit", shareController.SubmitGuestAttempt)
+		}
+
 		// Protected routes (authentication required)
 		protected := api.Group("/")
 		protected.Use(middleware.AuthMiddleware(jwtSecret))
 		{
 			// User profile
 			protected.GET("/profile", authController.GetProfile)
+			protected.PUT("/profile", authController.UpdateProfile)
 
 			// Materials
 			materials := protected.Group("/materials")
@@ -55,6 +74,12 @@ func SetupRoutes(db *sql.DB, jwtSecret string) *gin.Engine {
 				materials.POST("/upload", uploadController.UploadFile)
 				materials.GET("/", uploadController.GetMaterials)
 				materials.GET("/:id", uploadController.GetMaterial)
+				materials.GET("/:id/quizzes", quizController.ListMaterialQuizzes)
+				materials.POST("/:id/quizzes/import", quizController.ImportQuiz)
+				materials.GET("/:id/question-bank", quizController.GetQuestionBank)
+				materials.GET("/:id/question-bank/export", quizController.ExportQuestionBank)
+				materials.GET("/:id/mastery", progressController.GetMasteryMap)
+				materials.GET("/:id/decks", flashcardController.ListMaterialDecks)
 			}
 
 			// Summaries
@@ -62,6 +87,11 @@ func SetupRoutes(db *sql.DB, jwtSecret string) *gin.Engine {
 			{
 				summaries.POST("/generate/:id", summaryController.GenerateSummary)
 				summaries.GET("/:id", summaryController.GetSummary)
+				summaries.GET("/:id/versions", summaryController.ListSummaryVersions)
+				summaries.GET("/:id/versions/:version", summaryController.GetSummaryVersion)
+				summaries.POST("/:id/versions/:version/restore", summaryController.RestoreSummaryVersion)
+				summaries.GET("/:id/concepts/export", summaryController.ExportConcepts)
+				summaries.GET("/:id/export", summaryController.ExportSummary)
 			}
 
 			// Quizzes
@@ -69,14 +99,87 @@ func SetupRoutes(db *sql.DB, jwtSecret string) *gin.Engine {
 			{
 				quizzes.POST("/generate/:id", quizController.GenerateQuiz)
 				quizzes.GET("/:id", quizController.GetQuiz)
+				quizzes.POST("/:id/start", quizController.StartQuiz)
+				quizzes.GET("/:id/attempts", quizController.ListQuizAttempts)
+				quizzes.GET("/:id/export", quizController.ExportQuiz)
 				quizzes.POST("/submit/:id", quizController.SubmitQuiz)
 			}
 
+			// Quiz attempts
+			attempts := protected.Group("/attempts")
+			{
+				attempts.GET("/:id", quizController.GetAttempt)
+				attempts.PATCH("/:id/answers", quizController.SaveAnswers)
+				attempts.POST("/:id/answer", quizController.AnswerQuestion)
+				attempts.PUT("/:id/questions/:questionId/score",
+					middleware.RequireRole(db, models.RoleTeacher, models.RoleAdmin), quizController.OverrideScore)
+			}
+
+			// Flashcard decks
+			decks := protected.Group("/decks")
+			{
+				decks.GET("/:id", flashcardController.GetDeck)
+				decks.PUT("/:id", flashcardController.UpdateDeck)
+				decks.DELETE("/:id", flashcardController.DeleteDeck)
+				decks.POST("/:id/cards", flashcardController.AddCard)
+				decks.GET("/:id/export", flashcardController.ExportDeck)
+				decks.POST("/:id/import", flashcardController.ImportDeck)
+			}
+
+			// Flashcards
+			flashcards := protected.Group("/flashcards")
+			{
+				flashcards.POST("/generate/:id", flashcardController.GenerateDeck)
+				flashcards.PUT("/:id", flashcardController.UpdateCard)
+				flashcards.DELETE("/:id", flashcardController.DeleteCard)
+				flashcards.POST("/:id/review", flashcardController.ReviewCard)
+			}
+
+			// Share links
+			shares := protected.Group("/shares")
+			{
+				shares.POST("", shareController.CreateShareLink)
+				shares.GET("", shareController.ListShareLinks)
+				shares.POST("/:id/revoke", shareController.RevokeShareLink)
+				shares.GET("/:id/attempts", shareController.ListGuestAttempts)
+			}
+
+			// Spaced repetition reviews
+			protected.GET("/reviews/due", flashcardController.GetDueReviews)
+
+			// Learning progress
+			progress := protected.Group("/progress")
+			{
+				progress.GET("", progressController.ListProgress)
+				progress.GET("/:materialId", progressController.GetMaterialProgress)
+			}
+
+			// Learning analytics
+			analytics := protected.Group("/analytics")
+			{
+				analytics.GET("/overview", analyticsController.GetOverview)
+				analytics.POST("/activity", analyticsController.LogStudySession)
+			}
+
+			// Background jobs
+			protected.GET("/jobs/:id", jobController.GetJob)
+
 			// AI Assistant
 			assistant := protected.Group("/assistant")
 			{
 				assistant.POST("/chat", assistantController.Chat)
 			}
+
+			// AI usage and cost
+			protected.GET("/usage", usageController.GetMyUsage)
+
+			// Admin
+			admin := protected.Group("/admin")
+			admin.Use(middleware.RequireRole(db, models.RoleAdmin))
+			{
+				admin.GET("/usage", usageController.GetUsage)
+				admin.DELETE("/ai-cache", cacheController.Invalidate)
+			}
 		}
 	}
 
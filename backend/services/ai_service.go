@@ -2,17 +2,23 @@ package services
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+
+	"quicacademy-backend/models"
 )
 
 type OpenRouterService struct {
 	APIKey  string
 	BaseURL string
+	Prompts *PromptRegistry
+	Usage   *UsageLedger
+	Cache   *AICache
 }
 
 type OpenRouterRequest struct {
@@ -26,119 +32,267 @@ type Message struct {
 }
 
 type OpenRouterResponse struct {
-	Choices []Choice `json:"choices"`
+	Model   string     `json:"model"`
+	Choices []Choice   `json:"choices"`
+	Usage   TokenUsage `json:"usage"`
 }
 
 type Choice struct {
 	Message Message `json:"message"`
 }
 
-func NewOpenRouterService() *OpenRouterService {
+func NewOpenRouterService(db *sql.DB) *OpenRouterService {
 	return &OpenRouterService{
 		APIKey:  os.Getenv("OPENROUTER_API_KEY"),
 		BaseURL: "https://openrouter.ai/api/v1/chat/completions",
+		Prompts: DefaultPrompts,
+		Usage:   NewUsageLedger(db),
+		Cache:   NewAICache(db),
 	}
 }
 
-func (o *OpenRouterService) GenerateSummary(text string) (bulletPoints, paragraphs, concepts string, err error) {
-	prompt := fmt.Sprintf(`Berikan ringkasan dari materi berikut dalam 3 format:
+// Summary generation options
+const (
+	SummaryLengthBrief    = "brief"
+	SummaryLengthStandard = "standard"
+	SummaryLengthDetailed = "detailed"
 
-1. BULLET_POINTS: Buat 6-8 poin utama dengan bullet points
-2. PARAGRAPHS: Buat ringkasan dalam 2-3 paragraf yang mudah dipahami
-3. CONCEPTS: Buat 4-5 konsep kunci dengan penjelasan singkat
+	AudienceSMP        = "smp"
+	AudienceSMA        = "sma"
+	AudienceUniversity = "university"
 
-Materi:
-%s
+	SummaryStyleDefault  = "default"
+	SummaryStyleExamCram = "exam_cram"
+	SummaryStyleELI5     = "eli5"
+	SummaryStyleOutline  = "outline"
+)
 
-Format jawaban:
-BULLET_POINTS:
-• [poin 1]
-• [poin 2]
-...
+// DefaultQuestionTypes is the mix of question types generated when a quiz
+// doesn't ask for specific ones
+var DefaultQuestionTypes = []string{
+	models.QuestionMultipleChoice,
+	models.QuestionTrueFalse,
+	models.QuestionMultiSelect,
+	models.QuestionFillBlank,
+	models.QuestionMatching,
+	models.QuestionOrdering,
+	models.QuestionNumeric,
+}
 
-PARAGRAPHS:
-[paragraf 1]
+type SummaryOptions struct {
+	Length   string `json:"length"`
+	Audience string `json:"audience"`
+	Style    string `json:"style"`
+	Language string `json:"language"`
+}
 
-[paragraf 2]
+// WithDefaults fills in any option left empty
+func (opts SummaryOptions) WithDefaults() SummaryOptions {
+	if opts.Length == "" {
+		opts.Length = SummaryLengthStandard
+	}
+	if opts.Audience == "" {
+		opts.Audience = AudienceSMA
+	}
+	if opts.Style == "" {
+		opts.Style = SummaryStyleDefault
+	}
+	if opts.Language == "" {
+		opts.Language = LanguageIndonesian
+	}
+	return opts
+}
 
-CONCEPTS:
-[konsep 1]: [penjelasan]
-[konsep 2]: [penjelasan]
-...`, text)
+// GenerateSummary summarizes text written in sourceLanguage, in the language
+// and shape given by opts
+func (o *OpenRouterService) GenerateSummary(call CallContext, text, sourceLanguage string, opts SummaryOptions) (bulletPoints, paragraphs, concepts string, prompt PromptRef, err error) {
+	opts = opts.WithDefaults()
+	templateLanguage, bilingual := promptLanguage(opts.Language)
+
+	rendered, prompt, err := o.Prompts.Render(PromptSummary, templateLanguage, SummaryPromptData{
+		Text:           text,
+		Length:         opts.Length,
+		Audience:       opts.Audience,
+		Style:          opts.Style,
+		SourceLanguage: sourceLanguage,
+		Bilingual:      bilingual,
+	})
+	if err != nil {
+		return "", "", "", PromptRef{}, err
+	}
 
-	response, err := o.callAPI("anthropic/claude-3-haiku", prompt)
+	response, err := o.callAPI(call, prompt, "anthropic/claude-3-haiku", rendered)
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", PromptRef{}, err
 	}
 
 	// Parse response to extract sections
 	bulletPoints, paragraphs, concepts = o.parseSummaryResponse(response)
-	return bulletPoints, paragraphs, concepts, nil
+	return bulletPoints, paragraphs, concepts, prompt, nil
+}
+
+// Quiz generation limits
+const (
+	DefaultQuestionCount = 10
+	MaxQuestionCount     = 50
+)
+
+// QuizOptions shapes a generated quiz
+type QuizOptions struct {
+	Count      int                  `json:"question_count"`
+	Difficulty models.DifficultyMix `json:"difficulty"`
+	Types      []string             `json:"types"`
+	Focus      []string             `json:"focus_concepts"`
+	Concepts   []string             `json:"concepts"` // known concepts of the material
+	Language   string               `json:"language"`
 }
 
-func (o *OpenRouterService) GenerateQuiz(text, subject string) ([]byte, error) {
-	prompt := fmt.Sprintf(`Buat 10 soal pilihan ganda berdasarkan materi %s berikut:
-
-%s
-
-Format JSON yang diinginkan:
-[
-  {
-    "id": 1,
-    "type": "multiple_choice",
-    "question": "Pertanyaan soal",
-    "options": ["A. Pilihan 1", "B. Pilihan 2", "C. Pilihan 3", "D. Pilihan 4"],
-    "correct_answer": "A",
-    "explanation": "Penjelasan mengapa jawaban A benar",
-    "difficulty": "medium"
-  }
-]
-
-Buat soal yang:
-- Bervariasi tingkat kesulitan (easy, medium, hard)
-- Mencakup konsep utama dari materi
-- Memiliki penjelasan yang jelas
-- Opsi jawaban yang masuk akal`, subject, text)
-
-	response, err := o.callAPI("anthropic/claude-3-haiku", prompt)
+// WithDefaults fills in any option left empty
+func (opts QuizOptions) WithDefaults() QuizOptions {
+	if opts.Count == 0 {
+		opts.Count = DefaultQuestionCount
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = DefaultQuestionTypes
+	}
+	if opts.Language == "" {
+		opts.Language = LanguageIndonesian
+	}
+	return opts
+}
+
+// GenerateQuiz writes quiz questions about text written in sourceLanguage,
+// in the language and shape given by opts
+func (o *OpenRouterService) GenerateQuiz(call CallContext, text, subject, sourceLanguage string, opts QuizOptions) ([]byte, PromptRef, error) {
+	opts = opts.WithDefaults()
+	language := opts.Language
+	templateLanguage, bilingual := promptLanguage(language)
+	easy, medium, hard := opts.Difficulty.Split(opts.Count)
+
+	rendered, prompt, err := o.Prompts.Render(PromptQuiz, templateLanguage, QuizPromptData{
+		Text:           text,
+		Subject:        subject,
+		Count:          opts.Count,
+		Easy:           easy,
+		Medium:         medium,
+		Hard:           hard,
+		Types:          opts.Types,
+		Focus:          opts.Focus,
+		Concepts:       opts.Concepts,
+		SourceLanguage: sourceLanguage,
+		Bilingual:      bilingual,
+	})
 	if err != nil {
-		return nil, err
+		return nil, PromptRef{}, err
 	}
 
-	// Try to extract JSON from response
-	questions, err := o.parseQuizResponse(response)
+	model := "anthropic/claude-3-haiku"
+	response, err := o.callAPI(call, prompt, model, rendered)
 	if err != nil {
-		return nil, err
+		return nil, PromptRef{}, err
 	}
 
-	return questions, nil
+	questions, err := parseQuizResponse(response)
+	if err != nil {
+		// Drop the response so the next request asks the model again
+		o.Cache.Invalidate(CacheKey(model, prompt, rendered))
+		return nil, PromptRef{}, err
+	}
+
+	return questions, prompt, nil
 }
 
-func (o *OpenRouterService) ChatAssistant(message, context string) (string, error) {
-	prompt := fmt.Sprintf(`Kamu adalah AI Assistant untuk platform pembelajaran Quicacademy. 
-Berikan jawaban yang helpful, informatif, dan mudah dipahami untuk pertanyaan berikut.
+// SelectPages keeps the given 1-based pages of text, which are separated by
+// form feeds as text extractors write them. Text without page breaks is a
+// single page. Pages out of range are skipped.
+func SelectPages(text string, pages []int) string {
+	if len(pages) == 0 {
+		return text
+	}
+
+	wanted := map[int]bool{}
+	for _, page := range pages {
+		wanted[page] = true
+	}
+
+	var selected []string
+	for i, page := range strings.Split(text, "\f") {
+		if wanted[i+1] {
+			selected = append(selected, page)
+		}
+	}
+	return strings.Join(selected, "\f")
+}
 
-Konteks materi: %s
+// ChatAssistant answers message in language, using context (material text
+// written in sourceLanguage) when given
+func (o *OpenRouterService) ChatAssistant(call CallContext, message, context, sourceLanguage, language string) (string, PromptRef, error) {
+	templateLanguage, bilingual := promptLanguage(language)
 
-Pertanyaan: %s
+	if context == "" {
+		sourceLanguage = ""
+	}
 
-Berikan jawaban yang:
-- Jelas dan mudah dipahami
-- Menggunakan contoh jika diperlukan
-- Berkaitan dengan konteks materi jika relevan
-- Mendorong pembelajaran lebih lanjut`, context, message)
+	rendered, prompt, err := o.Prompts.Render(PromptChat, templateLanguage, ChatPromptData{
+		Message:        message,
+		Context:        context,
+		SourceLanguage: sourceLanguage,
+		Bilingual:      bilingual,
+	})
+	if err != nil {
+		return "", PromptRef{}, err
+	}
 
-	response, err := o.callAPI("anthropic/claude-3-haiku", prompt)
+	response, err := o.callAPI(call, prompt, "anthropic/claude-3-haiku", rendered)
+	if err != nil {
+		return "", PromptRef{}, err
+	}
+
+	return response, prompt, nil
+}
+
+// callAPI sends a prompt rendered from template to model, serving it from
+// the cache when possible, and records the tokens it used against call
+func (o *OpenRouterService) callAPI(call CallContext, template PromptRef, model, prompt string) (string, error) {
+	key := CacheKey(model, template, prompt)
+
+	if !call.Refresh {
+		if entry, ok := o.Cache.Get(key); ok {
+			o.Usage.Record(call, entry.Model, model, entry.Usage, true)
+			return entry.Response, nil
+		}
+	}
+
+	response, err := o.requestCompletion(model, prompt)
 	if err != nil {
 		return "", err
 	}
 
-	return response, nil
+	// The provider may route to a more specific model version than requested
+	if response.Model == "" {
+		response.Model = model
+	}
+	o.Usage.Record(call, response.Model, model, response.Usage, false)
+
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no response from API")
+	}
+
+	content := response.Choices[0].Message.Content
+	o.Cache.Set(key, CacheEntry{
+		Model:      response.Model,
+		Template:   template,
+		MaterialID: call.MaterialID,
+		Response:   content,
+		Usage:      response.Usage,
+	})
+
+	return content, nil
 }
 
-func (o *OpenRouterService) callAPI(model, prompt string) (string, error) {
+func (o *OpenRouterService) requestCompletion(model, prompt string) (*OpenRouterResponse, error) {
 	if o.APIKey == "" {
-		return "", fmt.Errorf("OpenRouter API key not configured")
+		return nil, fmt.Errorf("OpenRouter API key not configured")
 	}
 
 	request := OpenRouterRequest{
@@ -153,12 +307,12 @@ func (o *OpenRouterService) callAPI(model, prompt string) (string, error) {
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req, err := http.NewRequest("POST", o.BaseURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -168,29 +322,25 @@ func (o *OpenRouterService) callAPI(model, prompt string) (string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var response OpenRouterResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", err
-	}
-
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no response from API")
+		return nil, err
 	}
 
-	return response.Choices[0].Message.Content, nil
+	return &response, nil
 }
 
 func (o *OpenRouterService) parseSummaryResponse(response string) (bulletPoints, paragraphs, concepts string) {
@@ -238,42 +388,22 @@ func (o *OpenRouterService) parseSummaryResponse(response string) (bulletPoints,
 	return bulletPoints, paragraphs, concepts
 }
 
-func (o *OpenRouterService) parseQuizResponse(response string) ([]byte, error) {
-	// Try to find JSON in the response
-	start := -1
-	end := -1
-
-	for i, char := range response {
-		if char == '[' && start == -1 {
-			start = i
-		}
-		if char == ']' {
-			end = i + 1
-		}
+// parseQuizResponse extracts the JSON array of questions from the model's
+// response
+func parseQuizResponse(response string) ([]byte, error) {
+	start, end := strings.Index(response, "["), strings.LastIndex(response, "]")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no questions found in response")
 	}
 
-	if start != -1 && end != -1 {
-		jsonStr := response[start:end]
-
-		// Validate JSON
-		var questions []interface{}
-		if err := json.Unmarshal([]byte(jsonStr), &questions); err == nil {
-			return []byte(jsonStr), nil
-		}
+	jsonStr := response[start : end+1]
+	var questions []interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &questions); err != nil {
+		return nil, fmt.Errorf("invalid questions: %w", err)
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("no questions found in response")
 	}
 
-	// Fallback: return mock questions if parsing fails
-	mockQuestions := `[
-		{
-			"id": 1,
-			"type": "multiple_choice",
-			"question": "Berdasarkan materi yang diberikan, konsep utama yang dibahas adalah?",
-			"options": ["A. Konsep dasar", "B. Aplikasi praktis", "C. Teori lanjutan", "D. Semua benar"],
-			"correct_answer": "D",
-			"explanation": "Materi mencakup berbagai aspek dari konsep dasar hingga aplikasi praktis",
-			"difficulty": "medium"
-		}
-	]`
-
-	return []byte(mockQuestions), nil
+	return []byte(jsonStr), nil
 }
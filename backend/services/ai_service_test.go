@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestParseQuizResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected string
+		wantErr  bool
+	}{
+		{name: "bare array", response: `[{"id": 1}]`, expected: `[{"id": 1}]`},
+		{name: "surrounding text", response: "Here are the questions:\n[{\"id\": 1, \"options\": [\"A\"]}]\nGood luck!", expected: `[{"id": 1, "options": ["A"]}]`},
+		{name: "no array", response: "I cannot write questions about this material.", wantErr: true},
+		{name: "invalid JSON", response: `[{"id": 1,}]`, wantErr: true},
+		{name: "empty array", response: "[]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions, err := parseQuizResponse(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsed %s", questions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(questions) != tt.expected {
+				t.Errorf("got %s, want %s", questions, tt.expected)
+			}
+		})
+	}
+}
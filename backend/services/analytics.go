@@ -0,0 +1,262 @@
+package services
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"quicacademy-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsService aggregates a user's quiz attempts, progress and activity
+// log for the analytics dashboard
+type AnalyticsService struct {
+	DB *sql.DB
+}
+
+func NewAnalyticsService(db *sql.DB) *AnalyticsService {
+	return &AnalyticsService{DB: db}
+}
+
+// Execer runs a statement on a database or within a transaction
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// StudyEvent is one timed learning activity: a finished quiz attempt, with
+// its score and the material's subject, or a logged activity
+type StudyEvent struct {
+	At      time.Time
+	Seconds int
+	Quiz    bool
+	Score   int
+	Subject string
+}
+
+// LogActivity records a learning activity of a user
+func LogActivity(db Execer, userID uuid.UUID, materialID uuid.NullUUID, activityType string, seconds int) error {
+	query := `INSERT INTO activity_log (id, user_id, material_id, type, duration_seconds, occurred_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := db.Exec(query, uuid.New(), userID, materialID, activityType, seconds, time.Now())
+	return err
+}
+
+// Overview builds the user's analytics for the days from and to, inclusive,
+// as dates in loc. Weeks start on Monday in loc. Materials count as stale
+// when nothing was done with them for staleDays days.
+func (s *AnalyticsService) Overview(userID uuid.UUID, from, to time.Time, loc *time.Location, staleDays int) (models.AnalyticsOverview, error) {
+	overview := models.AnalyticsOverview{
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		Timezone:  loc.String(),
+		StaleDays: staleDays,
+	}
+
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+
+	events, err := s.studyEvents(userID, start, end)
+	if err != nil {
+		return overview, err
+	}
+
+	overview.Weeks = BucketWeeks(events, start, end, loc)
+	overview.Subjects = SubjectPerformances(events)
+	if len(overview.Subjects) > 0 {
+		overview.StrongestSubject = &overview.Subjects[0]
+	}
+	if len(overview.Subjects) > 1 {
+		overview.WeakestSubject = &overview.Subjects[len(overview.Subjects)-1]
+	}
+
+	scoreTotal := 0
+	for _, event := range events {
+		overview.StudySeconds += event.Seconds
+		if event.Quiz {
+			overview.QuizzesTaken++
+			scoreTotal += event.Score
+		}
+	}
+	if overview.QuizzesTaken > 0 {
+		average := scoreTotal / overview.QuizzesTaken
+		overview.AverageScore = &average
+	}
+
+	overview.StaleMaterials, err = s.staleMaterials(userID, staleDays)
+	return overview, err
+}
+
+// studyEvents returns the user's finished quiz attempts and logged activities
+// between start and end
+func (s *AnalyticsService) studyEvents(userID uuid.UUID, start, end time.Time) ([]StudyEvent, error) {
+	// Timestamps are stored in server time
+	start, end = start.In(time.Local), end.In(time.Local)
+
+	attemptsQuery := `SELECT a.submitted_at, a.time_spent, a.score, m.subject
+					  FROM quiz_attempts a
+					  JOIN quizzes q ON a.quiz_id = q.id
+					  JOIN materials m ON q.material_id = m.id
+					  WHERE a.user_id = $1 AND a.status <> $2 AND a.submitted_at >= $3 AND a.submitted_at < $4`
+
+	rows, err := s.DB.Query(attemptsQuery, userID, models.AttemptInProgress, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []StudyEvent
+	for rows.Next() {
+		event := StudyEvent{Quiz: true}
+		if err := rows.Scan(&event.At, &event.Seconds, &event.Score, &event.Subject); err != nil {
+			return nil, err
+		}
+		event.At = serverTime(event.At)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	activityQuery := `SELECT occurred_at, duration_seconds
+					  FROM activity_log
+					  WHERE user_id = $1 AND occurred_at >= $2 AND occurred_at < $3`
+
+	activities, err := s.DB.Query(activityQuery, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer activities.Close()
+
+	for activities.Next() {
+		var event StudyEvent
+		if err := activities.Scan(&event.At, &event.Seconds); err != nil {
+			return nil, err
+		}
+		event.At = serverTime(event.At)
+		events = append(events, event)
+	}
+
+	return events, activities.Err()
+}
+
+// staleMaterials lists the user's materials without any activity, quiz
+// attempt or summary view for at least staleDays days, longest idle first
+func (s *AnalyticsService) staleMaterials(userID uuid.UUID, staleDays int) ([]models.StaleMaterial, error) {
+	// GREATEST ignores NULLs, a material never studied was last touched when
+	// it was uploaded
+	query := `SELECT id, title, subject, last_activity_at
+			  FROM (
+				  SELECT m.id, m.title, m.subject, GREATEST(m.created_at, p.last_accessed_at,
+						 (SELECT MAX(l.occurred_at) FROM activity_log l WHERE l.material_id = m.id AND l.user_id = m.user_id)
+						 ) AS last_activity_at
+				  FROM materials m
+				  LEFT JOIN progress p ON p.material_id = m.id AND p.user_id = m.user_id
+				  WHERE m.user_id = $1
+			  ) activity
+			  WHERE last_activity_at < $2
+			  ORDER BY last_activity_at`
+
+	now := time.Now()
+	rows, err := s.DB.Query(query, userID, now.AddDate(0, 0, -staleDays))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	materials := []models.StaleMaterial{}
+	for rows.Next() {
+		var material models.StaleMaterial
+		if err := rows.Scan(&material.ID, &material.Title, &material.Subject, &material.LastActivityAt); err != nil {
+			return nil, err
+		}
+		material.LastActivityAt = serverTime(material.LastActivityAt)
+		material.DaysInactive = int(now.Sub(material.LastActivityAt).Hours() / 24)
+		materials = append(materials, material)
+	}
+
+	return materials, rows.Err()
+}
+
+// BucketWeeks sums events into the weeks, starting Monday in loc, that
+// overlap start to end. Every week is included, also those without events.
+func BucketWeeks(events []StudyEvent, start, end time.Time, loc *time.Location) []models.WeeklyActivity {
+	weeks := []models.WeeklyActivity{}
+	index := map[string]int{}
+	scores := []int{}
+	for week := weekStart(start, loc); week.Before(end); week = week.AddDate(0, 0, 7) {
+		key := week.Format("2006-01-02")
+		index[key] = len(weeks)
+		weeks = append(weeks, models.WeeklyActivity{WeekStart: key})
+		scores = append(scores, 0)
+	}
+
+	for _, event := range events {
+		i, ok := index[weekStart(event.At, loc).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		weeks[i].StudySeconds += event.Seconds
+		if event.Quiz {
+			weeks[i].QuizzesTaken++
+			scores[i] += event.Score
+		}
+	}
+
+	for i := range weeks {
+		if weeks[i].QuizzesTaken > 0 {
+			average := scores[i] / weeks[i].QuizzesTaken
+			weeks[i].AverageScore = &average
+		}
+	}
+
+	return weeks
+}
+
+// SubjectPerformances averages the quiz scores of events per subject, best
+// subject first
+func SubjectPerformances(events []StudyEvent) []models.SubjectPerformance {
+	totals := map[string]*models.SubjectPerformance{}
+	for _, event := range events {
+		if !event.Quiz {
+			continue
+		}
+		subject, ok := totals[event.Subject]
+		if !ok {
+			subject = &models.SubjectPerformance{Subject: event.Subject}
+			totals[event.Subject] = subject
+		}
+		subject.Attempts++
+		subject.AverageScore += event.Score
+	}
+
+	subjects := []models.SubjectPerformance{}
+	for _, subject := range totals {
+		subject.AverageScore /= subject.Attempts
+		subjects = append(subjects, *subject)
+	}
+
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].AverageScore != subjects[j].AverageScore {
+			return subjects[i].AverageScore > subjects[j].AverageScore
+		}
+		return subjects[i].Subject < subjects[j].Subject
+	})
+
+	return subjects
+}
+
+// weekStart is midnight on the Monday of t's week in loc
+func weekStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+}
+
+// serverTime places a TIMESTAMP column, read back without a zone, in the
+// server's zone it was written in
+func serverTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"quicacademy-backend/models"
+)
+
+func TestBucketWeeks(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, jakarta) // a Monday
+	end := start.AddDate(0, 0, 14)
+
+	events := []StudyEvent{
+		{At: time.Date(2024, 3, 5, 10, 0, 0, 0, jakarta), Seconds: 600, Quiz: true, Score: 80},
+		{At: time.Date(2024, 3, 6, 10, 0, 0, 0, jakarta), Seconds: 300, Quiz: true, Score: 60},
+		// Sunday evening in UTC is already Monday in Jakarta
+		{At: time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC), Seconds: 120},
+	}
+
+	weeks := BucketWeeks(events, start, end, jakarta)
+	if len(weeks) != 2 {
+		t.Fatalf("got %d weeks, want 2", len(weeks))
+	}
+
+	if weeks[0].WeekStart != "2024-03-04" || weeks[0].StudySeconds != 900 || weeks[0].QuizzesTaken != 2 {
+		t.Errorf("first week is %+v", weeks[0])
+	}
+	if weeks[0].AverageScore == nil || *weeks[0].AverageScore != 70 {
+		t.Errorf("first week average score is %v, want 70", weeks[0].AverageScore)
+	}
+
+	if weeks[1].WeekStart != "2024-03-11" || weeks[1].StudySeconds != 120 || weeks[1].AverageScore != nil {
+		t.Errorf("second week is %+v, want 120 seconds without quizzes", weeks[1])
+	}
+}
+
+func TestSubjectPerformances(t *testing.T) {
+	subjects := SubjectPerformances([]StudyEvent{
+		{Quiz: true, Subject: "Biologi", Score: 90},
+		{Quiz: true, Subject: "Fisika", Score: 40},
+		{Quiz: true, Subject: "Fisika", Score: 60},
+		{Subject: "Kimia", Seconds: 600},
+	})
+
+	want := []models.SubjectPerformance{
+		{Subject: "Biologi", Attempts: 1, AverageScore: 90},
+		{Subject: "Fisika", Attempts: 2, AverageScore: 50},
+	}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("got %+v, want %+v", subjects, want)
+	}
+}
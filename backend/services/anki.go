@@ -0,0 +1,658 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"quicacademy-backend/models"
+)
+
+// Anki note types
+const (
+	AnkiBasic = "Basic"
+	AnkiCloze = "Cloze"
+)
+
+// Note type IDs are fixed so notes exported at different times share the
+// same note types in the user's collection
+const (
+	ankiBasicModelID = 1718200000001
+	ankiClozeModelID = 1718200000002
+)
+
+// AnkiTag marks every exported note
+const AnkiTag = "quicacademy"
+
+// AnkiNote is a note to export to Anki. Notes with cloze deletions in Front
+// ({{c1::answer}}) are cloze notes with Back as their extra field, the others
+// basic notes.
+type AnkiNote struct {
+	Key      string // stable key the note's GUID derives from, so exporting again updates the note
+	Front    string
+	Back     string
+	Tags     []string
+	Schedule *AnkiSchedule // nil for cards never reviewed
+}
+
+// AnkiSchedule carries a card's review state over to Anki
+type AnkiSchedule struct {
+	ReviewSchedule
+	DueAt time.Time
+}
+
+var clozeDeletion = regexp.MustCompile(`\{\{c(\d+)::`)
+
+// Type is the note type of the note
+func (n AnkiNote) Type() string {
+	if clozeDeletion.MatchString(n.Front) {
+		return AnkiCloze
+	}
+	return AnkiBasic
+}
+
+// clozeOrdinals are the card ordinals of a cloze note, one per cloze number
+func clozeOrdinals(text string) []int {
+	seen := map[int]bool{}
+	var ordinals []int
+	for _, match := range clozeDeletion.FindAllStringSubmatch(text, -1) {
+		number, err := strconv.Atoi(match[1])
+		if err != nil || number < 1 || seen[number] {
+			continue
+		}
+		seen[number] = true
+		ordinals = append(ordinals, number-1)
+	}
+	sort.Ints(ordinals)
+	return ordinals
+}
+
+// AnkiPackage builds an .apkg file holding notes in a deck named deckName:
+// a zip with the collection as a SQLite database and an empty media
+// manifest
+func AnkiPackage(deckName string, notes []AnkiNote, now time.Time) ([]byte, error) {
+	collection, err := ankiCollection(deckName, notes, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"collection.anki2", collection},
+		{"media", []byte("{}")},
+	} {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ankiCollection writes the collection database in Anki's schema version 11,
+// which every Anki version imports
+func ankiCollection(deckName string, notes []AnkiNote, now time.Time) ([]byte, error) {
+	nowMillis := now.UnixMilli()
+	deckID := nowMillis
+
+	// Review cards are due a number of days after the collection was created
+	created := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, note := range notes {
+		if note.Schedule != nil && note.Schedule.DueAt.Before(created) {
+			due := note.Schedule.DueAt.In(now.Location())
+			created = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, now.Location())
+		}
+	}
+
+	models, err := json.Marshal(map[string]interface{}{
+		strconv.Itoa(ankiBasicModelID): ankiModel(ankiBasicModelID, AnkiBasic, deckID, now),
+		strconv.Itoa(ankiClozeModelID): ankiModel(ankiClozeModelID, AnkiCloze, deckID, now),
+	})
+	if err != nil {
+		return nil, err
+	}
+	decks, err := json.Marshal(map[string]interface{}{
+		"1":                           ankiDeck(1, "Default", now),
+		strconv.FormatInt(deckID, 10): ankiDeck(deckID, deckName, now),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	col := sqliteRow{RowID: 1, Values: []interface{}{
+		nil, created.Unix(), nowMillis, nowMillis, int64(11), int64(0), int64(0), int64(0),
+		ankiCollectionConf, string(models), string(decks), ankiDeckConf, "{}",
+	}}
+
+	var noteRows, cardRows []sqliteRow
+	for i, note := range notes {
+		noteID := nowMillis + int64(i)
+		modelID := int64(ankiBasicModelID)
+		ordinals := []int{0}
+		if note.Type() == AnkiCloze {
+			modelID = ankiClozeModelID
+			ordinals = clozeOrdinals(note.Front)
+		}
+
+		front, back := textHTML(note.Front), textHTML(note.Back)
+		sortField := htmlText(front)
+		checksum := sha1.Sum([]byte(sortField))
+		csum, _ := strconv.ParseInt(hex.EncodeToString(checksum[:4]), 16, 64)
+
+		noteRows = append(noteRows, sqliteRow{RowID: noteID, Values: []interface{}{
+			nil, ankiGUID(note.Key), modelID, now.Unix(), int64(-1), ankiTags(note.Tags),
+			front + "\x1f" + back, sortField, csum, int64(0), "",
+		}})
+
+		for _, ordinal := range ordinals {
+			// type and queue: 0 new, 2 review
+			cardType, due, interval, factor, reps, lapses := int64(0), int64(i+1), int64(0), int64(0), int64(0), int64(0)
+			if s := note.Schedule; s != nil {
+				cardType = 2
+				due = int64(math.Floor(s.DueAt.Sub(created).Hours() / 24))
+				interval = int64(s.IntervalDays)
+				if interval < 1 {
+					interval = 1
+				}
+				factor = int64(math.Round(s.EaseFactor * 1000))
+				reps, lapses = int64(s.Repetitions), int64(s.Lapses)
+			}
+
+			cardRows = append(cardRows, sqliteRow{RowID: nowMillis + int64(len(cardRows)), Values: []interface{}{
+				nil, noteID, deckID, int64(ordinal), now.Unix(), int64(-1), cardType, cardType, due,
+				interval, factor, reps, lapses, int64(0), int64(0), int64(0), int64(0), "",
+			}})
+		}
+	}
+
+	return writeSQLite([]sqliteTable{
+		{Name: "col", SQL: ankiColSQL, Rows: []sqliteRow{col}},
+		{Name: "notes", SQL: ankiNotesSQL, Rows: noteRows},
+		{Name: "cards", SQL: ankiCardsSQL, Rows: cardRows},
+		{Name: "revlog", SQL: ankiRevlogSQL},
+		{Name: "graves", SQL: ankiGravesSQL},
+	}, []sqliteIndex{
+		{Name: "ix_notes_usn", Table: "notes", SQL: "CREATE INDEX ix_notes_usn on notes (usn)", Columns: []int{4}},
+		{Name: "ix_cards_usn", Table: "cards", SQL: "CREATE INDEX ix_cards_usn on cards (usn)", Columns: []int{5}},
+		{Name: "ix_revlog_usn", Table: "revlog", SQL: "CREATE INDEX ix_revlog_usn on revlog (usn)", Columns: []int{2}},
+		{Name: "ix_cards_nid", Table: "cards", SQL: "CREATE INDEX ix_cards_nid on cards (nid)", Columns: []int{1}},
+		{Name: "ix_cards_sched", Table: "cards", SQL: "CREATE INDEX ix_cards_sched on cards (did, queue, due)", Columns: []int{2, 7, 8}},
+		{Name: "ix_revlog_cid", Table: "revlog", SQL: "CREATE INDEX ix_revlog_cid on revlog (cid)", Columns: []int{1}},
+		{Name: "ix_notes_csum", Table: "notes", SQL: "CREATE INDEX ix_notes_csum on notes (csum)", Columns: []int{8}},
+	})
+}
+
+const ankiColSQL = `CREATE TABLE col (
+    id              integer primary key,
+    crt             integer not null,
+    mod             integer not null,
+    scm             integer not null,
+    ver             integer not null,
+    dty             integer not null,
+    usn             integer not null,
+    ls              integer not null,
+    conf            text not null,
+    models          text not null,
+    decks           text not null,
+    dconf           text not null,
+    tags            text not null
+)`
+
+const ankiNotesSQL = `CREATE TABLE notes (
+    id              integer primary key,
+    guid            text not null,
+    mid             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    tags            text not null,
+    flds            text not null,
+    sfld            integer not null,
+    csum            integer not null,
+    flags           integer not null,
+    data            text not null
+)`
+
+const ankiCardsSQL = `CREATE TABLE cards (
+    id              integer primary key,
+    nid             integer not null,
+    did             integer not null,
+    ord             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    type            integer not null,
+    queue           integer not null,
+    due             integer not null,
+    ivl             integer not null,
+    factor          integer not null,
+    reps            integer not null,
+    lapses          integer not null,
+    left            integer not null,
+    odue            integer not null,
+    odid            integer not null,
+    flags           integer not null,
+    data            text not null
+)`
+
+const ankiRevlogSQL = `CREATE TABLE revlog (
+    id              integer primary key,
+    cid             integer not null,
+    usn             integer not null,
+    ease            integer not null,
+    ivl             integer not null,
+    lastIvl         integer not null,
+    factor          integer not null,
+    time            integer not null,
+    type            integer not null
+)`
+
+const ankiGravesSQL = `CREATE TABLE graves (
+    usn             integer not null,
+    oid             integer not null,
+    type            integer not null
+)`
+
+const ankiCollectionConf = `{"activeDecks": [1], "curDeck": 1, "newSpread": 0, "collapseTime": 1200, "timeLim": 0, "estTimes": true, ` +
+	`"dueCounts": true, "curModel": null, "nextPos": 1, "sortType": "noteFld", "sortBackwards": false, "addToCur": true}`
+
+const ankiDeckConf = `{"1": {"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false, ` +
+	`"new": {"bury": true, "delays": [1, 10], "initialFactor": 2500, "ints": [1, 4, 7], "order": 1, "perDay": 20, "separate": true}, ` +
+	`"lapse": {"delays": [10], "leechAction": 0, "leechFails": 8, "minInt": 1, "mult": 0}, ` +
+	`"rev": {"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "perDay": 100}}}`
+
+const ankiCSS = `.card {
+  font-family: arial;
+  font-size: 20px;
+  text-align: center;
+  color: black;
+  background-color: white;
+}
+.cloze {
+  font-weight: bold;
+  color: blue;
+}`
+
+func ankiModel(id int64, name string, deckID int64, now time.Time) map[string]interface{} {
+	field := func(name string, ord int) map[string]interface{} {
+		return map[string]interface{}{"name": name, "ord": ord, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{}}
+	}
+	template := func(name, question, answer string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "ord": 0, "qfmt": question, "afmt": answer, "did": nil, "bqfmt": "", "bafmt": ""}
+	}
+
+	model := map[string]interface{}{
+		"id": id, "name": "Quicacademy " + name, "mod": now.Unix(), "usn": -1, "sortf": 0, "did": deckID,
+		"css": ankiCSS, "tags": []string{}, "vers": []string{}, "latexsvg": false,
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+	}
+	if name == AnkiCloze {
+		model["type"] = 1
+		model["flds"] = []interface{}{field("Text", 0), field("Back Extra", 1)}
+		model["tmpls"] = []interface{}{template("Cloze", "{{cloze:Text}}", "{{cloze:Text}}<br>\n{{Back Extra}}")}
+		model["req"] = []interface{}{[]interface{}{0, "any", []int{0}}}
+	} else {
+		model["type"] = 0
+		model["flds"] = []interface{}{field("Front", 0), field("Back", 1)}
+		model["tmpls"] = []interface{}{template("Card 1", "{{Front}}", "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}")}
+		model["req"] = []interface{}{[]interface{}{0, "any", []int{0}}}
+	}
+	return model
+}
+
+func ankiDeck(id int64, name string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "name": name, "mod": now.Unix(), "usn": -1, "desc": "", "dyn": 0, "conf": 1,
+		"collapsed": false, "browserCollapsed": false, "extendNew": 0, "extendRev": 0,
+		"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+	}
+}
+
+// ankiGUID derives a note GUID from its key
+func ankiGUID(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:10]
+}
+
+// ankiTags formats tags as Anki stores them: space separated, with spaces
+// around the list
+func ankiTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " " + strings.Join(ankiTagList(tags), " ") + " "
+}
+
+func ankiTagList(tags []string) []string {
+	list := []string{}
+	for _, tag := range tags {
+		if tag = strings.Join(strings.Fields(tag), "_"); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// textHTML turns plain text into HTML, such as an Anki field
+func textHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(strings.TrimSpace(text)), "\n", "<br>")
+}
+
+var (
+	htmlLineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</(?:div|p|li)>`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlText turns HTML, such as an Anki field, back into plain text
+func htmlText(field string) string {
+	text := htmlLineBreak.ReplaceAllString(field, "\n")
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, ""))
+	return strings.TrimSpace(text)
+}
+
+// WriteAnkiText writes notes in Anki's text import format, with the note
+// type, deck and tags of each note in its own column. separator is ',' for
+// CSV or '\t' for TSV.
+func WriteAnkiText(w io.Writer, deckName string, notes []AnkiNote, separator rune) error {
+	separatorName := "Comma"
+	if separator == '\t' {
+		separatorName = "Tab"
+	}
+
+	header := "#separator:" + separatorName + "\n" +
+		"#html:true\n" +
+		"#notetype column:1\n" +
+		"#deck column:2\n" +
+		"#tags column:5\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	for _, note := range notes {
+		record := []string{
+			"Quicacademy " + note.Type(), deckName, textHTML(note.Front), textHTML(note.Back),
+			strings.Join(ankiTagList(note.Tags), " "),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ankiSeparators maps the separator names of Anki's text header to the
+// characters
+var ankiSeparators = map[string]rune{
+	"comma": ',', "semicolon": ';', "tab": '\t', "space": ' ', "pipe": '|', "colon": ':',
+}
+
+// ParseAnkiText reads flashcards from a file in Anki's text format, as
+// exported by Anki or WriteAnkiText: the first two fields of each line, not
+// counting note type, deck, tags and GUID columns, become the front and
+// back; the first tag other than AnkiTag becomes the concept. Header lines
+// (#separator:, #html:, #columns:, ...) are optional; without them the
+// separator is guessed from the first line.
+func ParseAnkiText(data []byte) ([]GeneratedFlashcard, error) {
+	text := strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff")
+
+	headers := map[string]string{}
+	for strings.HasPrefix(text, "#") {
+		line := text
+		if i := strings.Index(text, "\n"); i >= 0 {
+			line, text = text[:i], text[i+1:]
+		} else {
+			text = ""
+		}
+		if key, value, ok := strings.Cut(line[1:], ":"); ok {
+			headers[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+
+	separator, ok := ankiSeparators[strings.ToLower(headers["separator"])]
+	if !ok && len([]rune(headers["separator"])) == 1 {
+		separator, ok = []rune(headers["separator"])[0], true
+	}
+	if !ok {
+		firstLine, _, _ := strings.Cut(text, "\n")
+		separator = ','
+		for _, candidate := range []rune{'\t', ';', ','} {
+			if strings.ContainsRune(firstLine, candidate) {
+				separator = candidate
+				break
+			}
+		}
+	}
+
+	// Columns are numbered from 1 in headers
+	skip := map[int]bool{}
+	tagsColumn := 0
+	for _, key := range []string{"notetype column", "deck column", "guid column", "tags column"} {
+		if column, err := strconv.Atoi(headers[key]); err == nil && column > 0 {
+			skip[column-1] = true
+			if key == "tags column" {
+				tagsColumn = column
+			}
+		}
+	}
+	if names := headers["columns"]; names != "" && tagsColumn == 0 {
+		for i, name := range strings.Split(names, string(separator)) {
+			if strings.EqualFold(strings.TrimSpace(name), "tags") {
+				skip[i], tagsColumn = true, i+1
+			}
+		}
+	}
+	isHTML := strings.EqualFold(headers["html"], "true")
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = separator
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	cards := []GeneratedFlashcard{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Anki text file: %w", err)
+		}
+
+		var fields []string
+		for i, field := range record {
+			if !skip[i] {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) < 2 {
+			continue
+		}
+
+		card := GeneratedFlashcard{Front: fields[0], Back: fields[1]}
+		if isHTML {
+			card.Front, card.Back = htmlText(card.Front), htmlText(card.Back)
+		}
+		if tagsColumn > 0 && tagsColumn <= len(record) {
+			for _, tag := range strings.Fields(record[tagsColumn-1]) {
+				if tag != AnkiTag {
+					card.Concept = strings.ReplaceAll(tag, "_", " ")
+					break
+				}
+			}
+		}
+		cards = append(cards, card)
+	}
+
+	return CleanFlashcards(cards), nil
+}
+
+// FlashcardNotes turns the cards of a deck into notes tagged with their
+// concept
+func FlashcardNotes(cards []models.Flashcard) []AnkiNote {
+	notes := make([]AnkiNote, 0, len(cards))
+	for _, card := range cards {
+		note := AnkiNote{
+			Key:   card.ID.String(),
+			Front: card.Front,
+			Back:  card.Back,
+			Tags:  []string{AnkiTag, card.Concept},
+		}
+		if card.LastReviewedAt != nil {
+			note.Schedule = &AnkiSchedule{
+				ReviewSchedule: ReviewSchedule{
+					EaseFactor:   card.EaseFactor,
+					IntervalDays: card.IntervalDays,
+					Repetitions:  card.Repetitions,
+					Lapses:       card.Lapses,
+				},
+				DueAt: card.DueAt,
+			}
+		}
+		notes = append(notes, note)
+	}
+	return notes
+}
+
+// ConceptNotes turns the concepts of a summary that come with an
+// explanation into notes, keyed under key
+func ConceptNotes(key, concepts string) []AnkiNote {
+	var notes []AnkiNote
+	for _, card := range ConceptFlashcards(concepts) {
+		notes = append(notes, AnkiNote{
+			Key:   key + ":" + strings.ToLower(card.Concept),
+			Front: card.Front,
+			Back:  card.Back,
+			Tags:  []string{AnkiTag, card.Concept},
+		})
+	}
+	return notes
+}
+
+var blankPattern = regexp.MustCompile(`_{3,}`)
+
+// QuestionNotes turns normalized quiz questions into notes keyed under key:
+// the question, with its options, on the front and the answer with its
+// explanation on the back. Fill in the blank questions become cloze notes.
+func QuestionNotes(key string, questions []models.Question, language string) []AnkiNote {
+	notes := make([]AnkiNote, 0, len(questions))
+	for _, question := range questions {
+		note := AnkiNote{
+			Key:  fmt.Sprintf("%s:%d", key, question.ID),
+			Tags: append([]string{AnkiTag}, QuestionConcepts(question)...),
+		}
+
+		if question.Type == models.QuestionFillBlank && blankPattern.MatchString(question.Question) {
+			blank := blankPattern.FindStringIndex(question.Question)
+			note.Front = question.Question[:blank[0]] + "{{c1::" + clozeEscape(question.CorrectAnswer) + "}}" + question.Question[blank[1]:]
+			note.Back = question.Explanation
+		} else {
+			note.Front = questionFront(question)
+			note.Back = strings.TrimSpace(questionAnswer(question, language) + "\n\n" + question.Explanation)
+		}
+		notes = append(notes, note)
+	}
+	return notes
+}
+
+// clozeEscape keeps an answer from closing its cloze deletion early
+func clozeEscape(text string) string {
+	return strings.ReplaceAll(strings.TrimSpace(text), "}}", "} }")
+}
+
+func questionFront(question models.Question) string {
+	lines := []string{question.Question}
+	switch question.Type {
+	case models.QuestionMultipleChoice, models.QuestionMultiSelect, models.QuestionOrdering:
+		lines = append(lines, "")
+		for i, option := range question.Options {
+			lines = append(lines, OptionID(i)+". "+option)
+		}
+	case models.QuestionMatching:
+		lines = append(lines, "")
+		for i, prompt := range question.Prompts {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, prompt))
+		}
+		lines = append(lines, "")
+		for i, option := range question.Options {
+			lines = append(lines, OptionID(i)+". "+option)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// questionAnswer writes out the answer key of a normalized question
+func questionAnswer(question models.Question, language string) string {
+	option := func(id string) string {
+		return id + ". " + optionText(question, id)
+	}
+
+	switch question.Type {
+	case models.QuestionMultipleChoice:
+		return option(question.CorrectAnswer)
+	case models.QuestionMultiSelect:
+		var lines []string
+		for _, id := range question.CorrectAnswers {
+			lines = append(lines, option(id))
+		}
+		return strings.Join(lines, "\n")
+	case models.QuestionMatching:
+		var lines []string
+		for i, id := range question.CorrectAnswers {
+			if i < len(question.Prompts) {
+				lines = append(lines, question.Prompts[i]+" → "+option(id))
+			}
+		}
+		return strings.Join(lines, "\n")
+	case models.QuestionOrdering:
+		var lines []string
+		for i, id := range question.CorrectAnswers {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, optionText(question, id)))
+		}
+		return strings.Join(lines, "\n")
+	case models.QuestionTrueFalse:
+		answers := map[string]string{"true": "Benar", "false": "Salah"}
+		if language == LanguageEnglish {
+			answers = map[string]string{"true": "True", "false": "False"}
+		}
+		if answer, ok := answers[question.CorrectAnswer]; ok {
+			return answer
+		}
+		return question.CorrectAnswer
+	case models.QuestionNumeric:
+		if question.Tolerance > 0 {
+			return question.CorrectAnswer + " ± " + formatNumber(question.Tolerance)
+		}
+		return question.CorrectAnswer
+	case models.QuestionEssay:
+		return question.ModelAnswer
+	default:
+		answers := append([]string{question.CorrectAnswer}, question.AcceptedAnswers...)
+		return strings.Join(answers, " / ")
+	}
+}
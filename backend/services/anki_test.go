@@ -0,0 +1,109 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"quicacademy-backend/models"
+)
+
+func TestAnkiPackage(t *testing.T) {
+	notes := []AnkiNote{
+		{Key: "1", Front: "Fotosintesis", Back: "Proses membuat makanan", Tags: []string{AnkiTag, "Fotosintesis"}},
+		{Key: "2", Front: "Tumbuhan memakai {{c1::klorofil}} dan {{c2::cahaya}}", Back: ""},
+	}
+
+	data, err := AnkiPackage("Quicacademy::Biologi", notes, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	if string(files["media"]) != "{}" {
+		t.Errorf("media manifest is %q", files["media"])
+	}
+	collection := files["collection.anki2"]
+	if !bytes.HasPrefix(collection, []byte("SQLite format 3\x00")) {
+		t.Fatal("the collection is not a SQLite database")
+	}
+	if pages := binary.BigEndian.Uint32(collection[28:]); int(pages)*sqlitePageSize != len(collection) {
+		t.Errorf("header counts %d pages for %d bytes", pages, len(collection))
+	}
+
+	if got := clozeOrdinals(notes[1].Front); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("cloze ordinals are %v", got)
+	}
+	if notes[0].Type() != AnkiBasic || notes[1].Type() != AnkiCloze {
+		t.Errorf("note types are %s and %s", notes[0].Type(), notes[1].Type())
+	}
+}
+
+func TestAnkiTextRoundTrip(t *testing.T) {
+	notes := []AnkiNote{
+		{Front: "Apa itu <sel>?", Back: "Unit terkecil\nkehidupan, \"dasar\"", Tags: []string{AnkiTag, "Sel hidup"}},
+		{Front: "Air mendidih pada {{c1::100}} °C", Back: ""},
+	}
+
+	for _, separator := range []rune{',', '\t'} {
+		var buf bytes.Buffer
+		if err := WriteAnkiText(&buf, "Quicacademy::Biologi", notes, separator); err != nil {
+			t.Fatal(err)
+		}
+
+		cards, err := ParseAnkiText(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []GeneratedFlashcard{{Front: "Apa itu <sel>?", Back: "Unit terkecil\nkehidupan, \"dasar\"", Concept: "Sel hidup"}}
+		if !reflect.DeepEqual(cards, want) {
+			t.Errorf("separator %q: got %+v, want %+v", separator, cards, want)
+		}
+	}
+
+	// Files without headers, e.g. from a spreadsheet
+	cards, err := ParseAnkiText([]byte("Sel;Unit terkecil kehidupan\nInti;Pusat kendali sel\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 2 || cards[1].Front != "Inti" || cards[1].Back != "Pusat kendali sel" {
+		t.Errorf("got %+v", cards)
+	}
+}
+
+func TestQuestionNotes(t *testing.T) {
+	fill := models.Question{ID: 2, Type: models.QuestionFillBlank, Question: "Ibu kota Indonesia adalah ___.", CorrectAnswer: "Jakarta", Explanation: "Penjelasan"}
+	questions := NormalizeQuestions([]models.Question{multipleChoice(1, "B", "Merah", "Hijau"), fill, trueFalse(3, "false")})
+
+	notes := QuestionNotes("quiz", questions, LanguageIndonesian)
+	if notes[0].Type() != AnkiBasic || !strings.Contains(notes[0].Front, "B. Hijau") || !strings.HasPrefix(notes[0].Back, "B. Hijau") {
+		t.Errorf("multiple choice note is %+v", notes[0])
+	}
+	if notes[1].Type() != AnkiCloze || notes[1].Front != "Ibu kota Indonesia adalah {{c1::Jakarta}}." {
+		t.Errorf("fill in the blank note is %+v", notes[1])
+	}
+	if notes[2].Back != "Salah" {
+		t.Errorf("true/false answer is %q", notes[2].Back)
+	}
+	if notes[0].Key == notes[1].Key {
+		t.Error("notes share a key")
+	}
+}
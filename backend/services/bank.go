@@ -0,0 +1,29 @@
+package services
+
+import (
+	"math/rand"
+
+	"quicacademy-backend/models"
+)
+
+// AssembleQuiz draws count questions from pool, or all of them when count is
+// 0 or exceeds the pool, and shuffles both the questions and their options.
+// The same pool and seed always assemble the same quiz. Questions are
+// renumbered 1..n in the order they are presented.
+func AssembleQuiz(pool []models.Question, count int, seed int64) []models.Question {
+	random := rand.New(rand.NewSource(seed))
+
+	order := random.Perm(len(pool))
+	if count > 0 && count < len(order) {
+		order = order[:count]
+	}
+
+	questions := make([]models.Question, len(order))
+	for i, index := range order {
+		question := ShuffleOptions(pool[index], random)
+		question.ID = i + 1
+		questions[i] = question
+	}
+
+	return questions
+}
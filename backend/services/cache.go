@@ -0,0 +1,238 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAICacheSize = 500
+	defaultAICacheTTL  = 7 * 24 * time.Hour
+)
+
+// CacheEntry is a cached AI response together with the usage it originally
+// took, so cache hits can be reported as savings
+type CacheEntry struct {
+	Key        string
+	Model      string
+	Template   PromptRef
+	MaterialID uuid.NullUUID // material the response was first generated for
+	Response   string
+	Usage      TokenUsage
+	ExpiresAt  time.Time
+}
+
+// AICache caches AI responses in two tiers: an in-memory LRU in front of the
+// ai_cache table, which is shared by every server instance. Entries expire
+// after TTL. The memory tier of other instances only notices invalidations
+// once their own entries expire or are evicted.
+type AICache struct {
+	DB       *sql.DB
+	TTL      time.Duration
+	Capacity int
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+// NewAICache creates a cache sized by AI_CACHE_SIZE (entries) with a TTL of
+// AI_CACHE_TTL (a Go duration such as 72h)
+func NewAICache(db *sql.DB) *AICache {
+	capacity := defaultAICacheSize
+	if size, err := strconv.Atoi(os.Getenv("AI_CACHE_SIZE")); err == nil && size > 0 {
+		capacity = size
+	}
+
+	ttl := defaultAICacheTTL
+	if d, err := time.ParseDuration(os.Getenv("AI_CACHE_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+
+	return &AICache{
+		DB:       db,
+		TTL:      ttl,
+		Capacity: capacity,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+// CacheKey hashes everything that determines an AI response: the model, the
+// prompt template revision and the rendered prompt, which carries the input
+// text and generation options
+func CacheKey(model string, template PromptRef, prompt string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d\x00", model, template.Name, template.Version)
+	hash.Write([]byte(prompt))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get looks key up in memory, then in the database. Database hits are
+// promoted into memory.
+func (c *AICache) Get(key string) (CacheEntry, bool) {
+	if c == nil {
+		return CacheEntry{}, false
+	}
+
+	if entry, ok := c.getMemory(key); ok {
+		return entry, true
+	}
+
+	if c.DB == nil {
+		return CacheEntry{}, false
+	}
+
+	entry := CacheEntry{Key: key}
+	query := `SELECT model, prompt_template, prompt_version, material_id, response, prompt_tokens, completion_tokens, expires_at
+			  FROM ai_cache WHERE key = $1 AND expires_at > $2`
+	err := c.DB.QueryRow(query, key, time.Now()).Scan(
+		&entry.Model, &entry.Template.Name, &entry.Template.Version, &entry.MaterialID, &entry.Response,
+		&entry.Usage.PromptTokens, &entry.Usage.CompletionTokens, &entry.ExpiresAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to read AI cache: %v", err)
+		}
+		return CacheEntry{}, false
+	}
+
+	entry.Usage.TotalTokens = entry.Usage.PromptTokens + entry.Usage.CompletionTokens
+	c.setMemory(entry)
+	return entry, true
+}
+
+// Set stores entry under key in both tiers
+func (c *AICache) Set(key string, entry CacheEntry) {
+	if c == nil {
+		return
+	}
+
+	entry.Key = key
+	entry.ExpiresAt = time.Now().Add(c.TTL)
+	c.setMemory(entry)
+
+	if c.DB == nil {
+		return
+	}
+
+	query := `INSERT INTO ai_cache (key, model, prompt_template, prompt_version, material_id, response, prompt_tokens, completion_tokens, created_at, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			  ON CONFLICT (key) DO UPDATE SET
+				  response = EXCLUDED.response,
+				  prompt_tokens = EXCLUDED.prompt_tokens,
+				  completion_tokens = EXCLUDED.completion_tokens,
+				  created_at = EXCLUDED.created_at,
+				  expires_at = EXCLUDED.expires_at`
+
+	_, err := c.DB.Exec(query,
+		key, entry.Model, entry.Template.Name, entry.Template.Version, entry.MaterialID, entry.Response,
+		entry.Usage.PromptTokens, entry.Usage.CompletionTokens, time.Now(), entry.ExpiresAt,
+	)
+	if err != nil {
+		log.Printf("Failed to write AI cache: %v", err)
+	}
+}
+
+// Invalidate removes a single key
+func (c *AICache) Invalidate(key string) (int64, error) {
+	return c.invalidate(func(entry CacheEntry) bool { return entry.Key == key },
+		`DELETE FROM ai_cache WHERE key = $1`, key)
+}
+
+// InvalidateMaterial removes every response first generated for a material
+func (c *AICache) InvalidateMaterial(materialID uuid.UUID) (int64, error) {
+	return c.invalidate(func(entry CacheEntry) bool { return entry.MaterialID.Valid && entry.MaterialID.UUID == materialID },
+		`DELETE FROM ai_cache WHERE material_id = $1`, materialID)
+}
+
+// InvalidateTemplate removes every response produced by a prompt template,
+// e.g. "summary.en", across all of its versions
+func (c *AICache) InvalidateTemplate(name string) (int64, error) {
+	return c.invalidate(func(entry CacheEntry) bool { return entry.Template.Name == name },
+		`DELETE FROM ai_cache WHERE prompt_template = $1`, name)
+}
+
+// InvalidateAll empties the cache
+func (c *AICache) InvalidateAll() (int64, error) {
+	return c.invalidate(func(CacheEntry) bool { return true }, `DELETE FROM ai_cache`)
+}
+
+// PurgeExpired deletes expired rows from the database tier
+func (c *AICache) PurgeExpired() (int64, error) {
+	result, err := c.DB.Exec(`DELETE FROM ai_cache WHERE expires_at <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c *AICache) invalidate(match func(CacheEntry) bool, query string, args ...interface{}) (int64, error) {
+	c.mu.Lock()
+	for key, element := range c.items {
+		if match(element.Value.(CacheEntry)) {
+			c.order.Remove(element)
+			delete(c.items, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.DB == nil {
+		return 0, nil
+	}
+
+	result, err := c.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c *AICache) getMemory(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+
+	entry := element.Value.(CacheEntry)
+	if time.Now().After(entry.ExpiresAt) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return CacheEntry{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+func (c *AICache) setMemory(entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[entry.Key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[entry.Key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.Capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(CacheEntry).Key)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAICacheLRU(t *testing.T) {
+	cache := NewAICache(nil)
+	cache.Capacity = 2
+
+	cache.Set("a", CacheEntry{Response: "A"})
+	cache.Set("b", CacheEntry{Response: "B"})
+
+	// Reading a makes b the least recently used
+	if entry, ok := cache.Get("a"); !ok || entry.Response != "A" {
+		t.Fatalf("a = %+v, %v", entry, ok)
+	}
+	cache.Set("c", CacheEntry{Response: "C"})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	// Setting a key again replaces its entry without growing the cache
+	cache.Set("a", CacheEntry{Response: "A2"})
+	if entry, _ := cache.Get("a"); entry.Response != "A2" {
+		t.Errorf("a = %q after it was replaced", entry.Response)
+	}
+	if cache.order.Len() != 2 || len(cache.items) != 2 {
+		t.Errorf("cache holds %d entries, capacity is 2", cache.order.Len())
+	}
+}
+
+func TestAICacheTTL(t *testing.T) {
+	cache := NewAICache(nil)
+	cache.TTL = time.Hour
+
+	cache.Set("fresh", CacheEntry{Response: "fresh"})
+	if entry, ok := cache.Get("fresh"); !ok || entry.ExpiresAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("fresh = %+v, %v; want it to expire in an hour", entry, ok)
+	}
+
+	cache.setMemory(CacheEntry{Key: "stale", Response: "stale", ExpiresAt: time.Now().Add(-time.Second)})
+	if _, ok := cache.Get("stale"); ok {
+		t.Error("an expired entry was served")
+	}
+	if _, ok := cache.items["stale"]; ok {
+		t.Error("an expired entry was kept after it was read")
+	}
+}
+
+func TestNewAICacheSettings(t *testing.T) {
+	t.Setenv("AI_CACHE_SIZE", "10")
+	t.Setenv("AI_CACHE_TTL", "72h")
+	if cache := NewAICache(nil); cache.Capacity != 10 || cache.TTL != 72*time.Hour {
+		t.Errorf("capacity %d and TTL %s", cache.Capacity, cache.TTL)
+	}
+
+	t.Setenv("AI_CACHE_SIZE", "-1")
+	t.Setenv("AI_CACHE_TTL", "soon")
+	if cache := NewAICache(nil); cache.Capacity != defaultAICacheSize || cache.TTL != defaultAICacheTTL {
+		t.Errorf("invalid settings gave capacity %d and TTL %s", cache.Capacity, cache.TTL)
+	}
+}
+
+func TestAICacheInvalidate(t *testing.T) {
+	cache := NewAICache(nil)
+	materialID := uuid.New()
+
+	cache.Set("summary", CacheEntry{Template: PromptRef{Name: "summary.id", Version: 1}, MaterialID: uuid.NullUUID{UUID: materialID, Valid: true}})
+	cache.Set("quiz", CacheEntry{Template: PromptRef{Name: "quiz.id", Version: 6}})
+	cache.Set("chat", CacheEntry{Template: PromptRef{Name: "chat.id", Version: 1}})
+
+	cache.InvalidateMaterial(materialID)
+	cache.InvalidateTemplate("quiz.id")
+
+	for key, want := range map[string]bool{"summary": false, "quiz": false, "chat": true} {
+		if _, ok := cache.Get(key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	ref := PromptRef{Name: "quiz.id", Version: 6}
+	key := CacheKey("model", ref, "prompt")
+
+	// Pinned so a change to the key derivation, which would orphan every
+	// stored entry, is noticed
+	if key != "b0213fc0f9826e83904774b8ae75aa57e063b83f957ee3505165aa42ff8aa2b5" {
+		t.Errorf("key = %s", key)
+	}
+	if CacheKey("model", ref, "prompt") != key {
+		t.Error("the same input gave a different key")
+	}
+
+	for name, other := range map[string]string{
+		"model":    CacheKey("other", ref, "prompt"),
+		"template": CacheKey("model", PromptRef{Name: "quiz.en", Version: 6}, "prompt"),
+		"version":  CacheKey("model", PromptRef{Name: "quiz.id", Version: 7}, "prompt"),
+		"prompt":   CacheKey("model", ref, "prompt "),
+		"boundary": CacheKey("mode", PromptRef{Name: "lquiz.id", Version: 6}, "prompt"),
+	} {
+		if other == key {
+			t.Errorf("a different %s gave the same key", name)
+		}
+	}
+}
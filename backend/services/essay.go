@@ -0,0 +1,179 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"quicacademy-backend/models"
+)
+
+// essayChunkSize is the rough size in characters of the material chunks an
+// essay is graded against
+const essayChunkSize = 1200
+
+// essaySourceChunks is how many chunks of the material go into the prompt
+const essaySourceChunks = 3
+
+// EssayGrade is the AI's assessment of one essay answer
+type EssayGrade struct {
+	Criteria []models.CriterionScore `json:"criteria"`
+	Feedback string                  `json:"feedback"`
+}
+
+// GradeEssay scores answer against the question's rubric, using the parts of
+// material most relevant to the question and answer as the source of truth.
+// Feedback is written in language.
+func (o *OpenRouterService) GradeEssay(call CallContext, question models.Question, answer, material, language string) (EssayGrade, PromptRef, error) {
+	templateLanguage, bilingual := promptLanguage(language)
+
+	rendered, prompt, err := o.Prompts.Render(PromptEssayGrading, templateLanguage, EssayGradingPromptData{
+		Question:    question.Question,
+		Answer:      answer,
+		ModelAnswer: question.ModelAnswer,
+		Rubric:      question.Rubric,
+		Sources:     RelevantChunks(material, question.Question+" "+answer, essaySourceChunks),
+		Bilingual:   bilingual,
+	})
+	if err != nil {
+		return EssayGrade{}, PromptRef{}, err
+	}
+
+	response, err := o.callAPI(call, prompt, "anthropic/claude-3-haiku", rendered)
+	if err != nil {
+		return EssayGrade{}, PromptRef{}, err
+	}
+
+	grade, err := parseEssayGrade(response)
+	if err != nil {
+		return EssayGrade{}, PromptRef{}, err
+	}
+
+	return grade, prompt, nil
+}
+
+// parseEssayGrade extracts the JSON object from the model's response. An
+// essay that can't be graded stays pending for a teacher.
+func parseEssayGrade(response string) (EssayGrade, error) {
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start == -1 || end < start {
+		return EssayGrade{}, fmt.Errorf("no grade found in response")
+	}
+
+	var grade EssayGrade
+	if err := json.Unmarshal([]byte(response[start:end+1]), &grade); err != nil {
+		return EssayGrade{}, fmt.Errorf("invalid grade: %w", err)
+	}
+
+	if len(grade.Criteria) == 0 {
+		return EssayGrade{}, fmt.Errorf("grade has no criteria")
+	}
+
+	return grade, nil
+}
+
+// SplitChunks splits text into chunks of about size characters, breaking at
+// paragraph and then sentence boundaries
+func SplitChunks(text string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		for _, sentence := range splitSentences(paragraph) {
+			if current.Len() > 0 && current.Len()+len(sentence) > size {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString(" ")
+			}
+			current.WriteString(sentence)
+		}
+		current.WriteString("\n")
+	}
+	flush()
+
+	return chunks
+}
+
+func splitSentences(paragraph string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range paragraph {
+		if (r == '.' || r == '?' || r == '!') && i+1 < len(paragraph) && paragraph[i+1] == ' ' {
+			sentences = append(sentences, paragraph[start:i+1])
+			start = i + 2
+		}
+	}
+	if start < len(paragraph) {
+		sentences = append(sentences, paragraph[start:])
+	}
+	return sentences
+}
+
+// RelevantChunks returns up to k chunks of text sharing the most words with
+// query, in the order they appear in text
+func RelevantChunks(text, query string, k int) []string {
+	chunks := SplitChunks(text, essayChunkSize)
+	if len(chunks) <= k {
+		return chunks
+	}
+
+	terms := map[string]bool{}
+	for _, word := range significantWords(query) {
+		terms[word] = true
+	}
+
+	type scored struct {
+		index int
+		score int
+	}
+	scores := make([]scored, len(chunks))
+	for i, chunk := range chunks {
+		scores[i] = scored{index: i}
+		for _, word := range significantWords(chunk) {
+			if terms[word] {
+				scores[i].score++
+			}
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	top := scores[:k]
+	sort.Slice(top, func(i, j int) bool { return top[i].index < top[j].index })
+
+	relevant := make([]string, k)
+	for i, s := range top {
+		relevant[i] = chunks[s.index]
+	}
+	return relevant
+}
+
+// significantWords lowercases text into words, skipping short ones that are
+// mostly function words
+func significantWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	significant := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) > 3 {
+			significant = append(significant, word)
+		}
+	}
+	return significant
+}
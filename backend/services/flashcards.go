@@ -0,0 +1,158 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Flashcard deck sizes
+const (
+	DefaultFlashcardCount = 20
+	MaxFlashcardCount     = 50
+)
+
+// SM-2 scheduling constants
+const (
+	InitialEaseFactor = 2.5
+	minEaseFactor     = 1.3
+	passingGrade      = 3 // grades below count as forgotten
+)
+
+// GeneratedFlashcard is a card written by the AI or built from a concept
+type GeneratedFlashcard struct {
+	Front   string `json:"front"`
+	Back    string `json:"back"`
+	Concept string `json:"concept"`
+}
+
+// ReviewSchedule is the SM-2 state of a flashcard
+type ReviewSchedule struct {
+	EaseFactor   float64
+	IntervalDays int
+	Repetitions  int // successful reviews in a row
+	Lapses       int
+}
+
+// NewReviewSchedule is the schedule of a card never reviewed
+func NewReviewSchedule() ReviewSchedule {
+	return ReviewSchedule{EaseFactor: InitialEaseFactor}
+}
+
+// ScheduleReview applies a review graded 0-5 to a card's schedule with the
+// SM-2 algorithm. A recalled card is seen again after 1 day, then 6 days,
+// then its previous interval times its ease factor; a forgotten card starts
+// over at 1 day. The ease factor moves with every grade, but never below 1.3.
+func ScheduleReview(s ReviewSchedule, grade int) ReviewSchedule {
+	if s.EaseFactor == 0 {
+		s.EaseFactor = InitialEaseFactor
+	}
+
+	if grade < passingGrade {
+		s.Repetitions = 0
+		s.IntervalDays = 1
+		s.Lapses++
+	} else {
+		switch s.Repetitions {
+		case 0:
+			s.IntervalDays = 1
+		case 1:
+			s.IntervalDays = 6
+		default:
+			s.IntervalDays = int(math.Round(float64(s.IntervalDays) * s.EaseFactor))
+		}
+		s.Repetitions++
+	}
+
+	miss := float64(5 - grade)
+	s.EaseFactor = math.Max(minEaseFactor, s.EaseFactor+0.1-miss*(0.08+miss*0.02))
+	return s
+}
+
+// DueAt is when a card reviewed at reviewedAt with schedule s is due again
+func (s ReviewSchedule) DueAt(reviewedAt time.Time) time.Time {
+	return reviewedAt.AddDate(0, 0, s.IntervalDays)
+}
+
+// GenerateFlashcards writes count flashcards in language from a material's
+// summary, its key points and concepts written in sourceLanguage
+func (o *OpenRouterService) GenerateFlashcards(call CallContext, subject, bulletPoints, concepts, sourceLanguage, language string, count int) ([]GeneratedFlashcard, PromptRef, error) {
+	templateLanguage, bilingual := promptLanguage(language)
+
+	rendered, prompt, err := o.Prompts.Render(PromptFlashcards, templateLanguage, FlashcardPromptData{
+		Subject:        subject,
+		Count:          count,
+		BulletPoints:   bulletPoints,
+		Concepts:       concepts,
+		SourceLanguage: sourceLanguage,
+		Bilingual:      bilingual,
+	})
+	if err != nil {
+		return nil, PromptRef{}, err
+	}
+
+	response, err := o.callAPI(call, prompt, "anthropic/claude-3-haiku", rendered)
+	if err != nil {
+		return nil, PromptRef{}, err
+	}
+
+	cards, err := parseFlashcards(response)
+	if err != nil {
+		return nil, PromptRef{}, err
+	}
+
+	return cards, prompt, nil
+}
+
+// parseFlashcards extracts the JSON array of cards from the model's
+// response, dropping cards missing a side
+func parseFlashcards(response string) ([]GeneratedFlashcard, error) {
+	start, end := strings.Index(response, "["), strings.LastIndex(response, "]")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no flashcards found in response")
+	}
+
+	var cards []GeneratedFlashcard
+	if err := json.Unmarshal([]byte(response[start:end+1]), &cards); err != nil {
+		return nil, fmt.Errorf("invalid flashcards: %w", err)
+	}
+
+	return CleanFlashcards(cards), nil
+}
+
+// CleanFlashcards trims cards and drops those missing a side or repeating
+// the front of an earlier card
+func CleanFlashcards(cards []GeneratedFlashcard) []GeneratedFlashcard {
+	seen := map[string]bool{}
+	cleaned := []GeneratedFlashcard{}
+	for _, card := range cards {
+		card.Front = strings.TrimSpace(card.Front)
+		card.Back = strings.TrimSpace(card.Back)
+		card.Concept = strings.TrimSpace(card.Concept)
+		if card.Front == "" || card.Back == "" || seen[strings.ToLower(card.Front)] {
+			continue
+		}
+		if len(card.Concept) > maxConceptLength {
+			card.Concept = ""
+		}
+		seen[strings.ToLower(card.Front)] = true
+		cleaned = append(cleaned, card)
+	}
+	return cleaned
+}
+
+// ConceptFlashcards builds one card per concept of a summary's concepts
+// section that comes with an explanation: the concept on the front and the
+// explanation on the back. It is used when the AI can't write cards.
+func ConceptFlashcards(concepts string) []GeneratedFlashcard {
+	cards := []GeneratedFlashcard{}
+	for _, entry := range conceptEntries(concepts) {
+		if entry.Explanation == "" {
+			continue
+		}
+		cards = append(cards, GeneratedFlashcard{Front: entry.Name, Back: entry.Explanation, Concept: entry.Name})
+	}
+	return cards
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScheduleReview(t *testing.T) {
+	s := NewReviewSchedule()
+	var intervals []int
+	for i := 0; i < 4; i++ {
+		s = ScheduleReview(s, 4)
+		intervals = append(intervals, s.IntervalDays)
+	}
+	if want := []int{1, 6, 15, 38}; !reflect.DeepEqual(intervals, want) {
+		t.Errorf("intervals after good recalls are %v, want %v", intervals, want)
+	}
+	if s.EaseFactor != InitialEaseFactor || s.Repetitions != 4 {
+		t.Errorf("grade 4 changed the ease factor to %.2f, repetitions are %d", s.EaseFactor, s.Repetitions)
+	}
+
+	forgotten := ScheduleReview(s, 1)
+	if forgotten.IntervalDays != 1 || forgotten.Repetitions != 0 || forgotten.Lapses != 1 {
+		t.Errorf("a forgotten card is scheduled as %+v", forgotten)
+	}
+	if forgotten.EaseFactor >= s.EaseFactor {
+		t.Errorf("forgetting kept the ease factor at %.2f", forgotten.EaseFactor)
+	}
+
+	if perfect := ScheduleReview(NewReviewSchedule(), 5); perfect.EaseFactor <= InitialEaseFactor {
+		t.Errorf("a perfect recall gave ease factor %.2f", perfect.EaseFactor)
+	}
+
+	for i := 0; i < 10; i++ {
+		s = ScheduleReview(s, 0)
+	}
+	if s.EaseFactor != minEaseFactor {
+		t.Errorf("ease factor fell to %.2f, want the minimum %.2f", s.EaseFactor, minEaseFactor)
+	}
+}
+
+func TestParseFlashcards(t *testing.T) {
+	response := `Here you go: [{"front": " Fotosintesis ", "back": "Proses membuat makanan", "concept": "Fotosintesis"},
+		{"front": "fotosintesis", "back": "duplikat"}, {"front": "Tanpa jawaban", "back": ""}]`
+
+	cards, err := parseFlashcards(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GeneratedFlashcard{{Front: "Fotosintesis", Back: "Proses membuat makanan", Concept: "Fotosintesis"}}
+	if !reflect.DeepEqual(cards, want) {
+		t.Errorf("got %+v, want %+v", cards, want)
+	}
+
+	if _, err := parseFlashcards("no cards"); err == nil {
+		t.Error("a response without cards parsed")
+	}
+}
+
+func TestConceptFlashcards(t *testing.T) {
+	cards := ConceptFlashcards("- **Fotosintesis**: proses membuat makanan\n• Klorofil")
+	want := []GeneratedFlashcard{{Front: "Fotosintesis", Back: "proses membuat makanan", Concept: "Fotosintesis"}}
+	if !reflect.DeepEqual(cards, want) {
+		t.Errorf("got %+v, want %+v", cards, want)
+	}
+
+	cards = ConceptFlashcards(`[{"title": "Respirasi", "description": "Pemecahan glukosa"}]`)
+	if len(cards) != 1 || cards[0].Back != "Pemecahan glukosa" {
+		t.Errorf("got %+v from JSON concepts", cards)
+	}
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"quicacademy-backend/models"
+)
+
+// giftSpecial are the characters GIFT gives a meaning to, which are
+// escaped with a backslash in texts
+const giftSpecial = "~=#{}:"
+
+// GIFT writes questions in Moodle's GIFT text format, in a category named
+// after title. Concepts and difficulty are written as [tag:...] comments.
+// Ordering questions have no GIFT equivalent; their IDs are returned as
+// skipped.
+func GIFT(title string, questions []models.Question) ([]byte, []int) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "$CATEGORY: %s%s\n", moodleCategoryPrefix, strings.ReplaceAll(title, "/", "-"))
+
+	skipped := []int{}
+	for _, question := range questions {
+		answers, ok := giftAnswers(question)
+		if !ok {
+			skipped = append(skipped, question.ID)
+			continue
+		}
+
+		buf.WriteString("\n")
+		if tags := questionTags(question); len(tags) > 0 {
+			buf.WriteString("//")
+			for _, tag := range tags {
+				fmt.Fprintf(&buf, " [tag:%s]", strings.ReplaceAll(tag, "]", ""))
+			}
+			buf.WriteString("\n")
+		}
+
+		text := giftEscape(question.Question)
+		if question.Type == models.QuestionFillBlank {
+			if before, after, ok := splitBlank(question.Question); ok {
+				text = giftEscape(before) + answers + giftEscape(after)
+				answers = ""
+			}
+		}
+		if answers != "" {
+			text += " " + answers
+		}
+		fmt.Fprintf(&buf, "::%s::%s\n", giftEscape(questionName(question)), text)
+	}
+
+	return buf.Bytes(), skipped
+}
+
+// giftAnswers is the answer block of a question, with its explanation as
+// general feedback
+func giftAnswers(question models.Question) (string, bool) {
+	var answers []string
+
+	switch question.Type {
+	case models.QuestionMultipleChoice:
+		for i, option := range question.Options {
+			marker := "~"
+			if OptionID(i) == question.CorrectAnswer {
+				marker = "="
+			}
+			answers = append(answers, marker+giftEscape(option))
+		}
+
+	case models.QuestionMultiSelect:
+		correct := map[string]bool{}
+		for _, id := range question.CorrectAnswers {
+			correct[id] = true
+		}
+		share := "0"
+		if len(correct) > 0 {
+			share = moodleFraction(100 / float64(len(correct)))
+		}
+		for i, option := range question.Options {
+			weight := "-" + share
+			if correct[OptionID(i)] {
+				weight = share
+			}
+			answers = append(answers, "~%"+weight+"%"+giftEscape(option))
+		}
+
+	case models.QuestionTrueFalse:
+		answers = append(answers, "F")
+		if question.CorrectAnswer == "true" {
+			answers[0] = "T"
+		}
+
+	case models.QuestionShortAnswer, models.QuestionFillBlank:
+		for _, accepted := range append([]string{question.CorrectAnswer}, question.AcceptedAnswers...) {
+			answers = append(answers, "="+giftEscape(accepted))
+		}
+
+	case models.QuestionNumeric:
+		answer := "#" + question.CorrectAnswer
+		if question.Tolerance > 0 {
+			answer += ":" + formatNumber(question.Tolerance)
+		}
+		answers = append(answers, answer)
+
+	case models.QuestionMatching:
+		used := map[string]bool{}
+		for i, prompt := range question.Prompts {
+			match := ""
+			if i < len(question.CorrectAnswers) {
+				match = optionText(question, question.CorrectAnswers[i])
+				used[question.CorrectAnswers[i]] = true
+			}
+			answers = append(answers, "="+giftEscape(prompt)+" -> "+giftEscape(match))
+		}
+		// Options no prompt matches are distractors, written with an empty
+		// prompt
+		for i, option := range question.Options {
+			if !used[OptionID(i)] {
+				answers = append(answers, "= -> "+giftEscape(option))
+			}
+		}
+
+	case models.QuestionEssay:
+
+	default:
+		return "", false
+	}
+
+	if question.Explanation != "" {
+		answers = append(answers, "####"+giftEscape(question.Explanation))
+	}
+	return "{" + strings.Join(answers, " ") + "}", true
+}
+
+// giftEscape escapes the special characters and line breaks of a text
+func giftEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+		case strings.ContainsRune(giftSpecial, r):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// giftUnescape resolves the escapes of a GIFT text
+func giftUnescape(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+			if text[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(text[i])
+			}
+			continue
+		}
+		b.WriteByte(text[i])
+	}
+	return strings.TrimSpace(trimLines(b.String()))
+}
+
+// trimLines trims the spaces around each line of a text
+func trimLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// giftIndex is the position of the first unescaped occurrence of sep in
+// text, or -1
+func giftIndex(text, sep string) int {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(text[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// giftSplit splits text before each unescaped marker character, keeping the
+// markers. Text before the first marker is returned first.
+func giftSplit(text, markers string) []string {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(markers, text[i]) >= 0 {
+			parts = append(parts, text[start:i])
+			start = i
+		}
+	}
+	return append(parts, text[start:])
+}
+
+var (
+	giftTag    = regexp.MustCompile(`\[tag:([^\]]*)\]`)
+	giftFormat = regexp.MustCompile(`^\[(html|moodle|plain|markdown)\]`)
+	giftWeight = regexp.MustCompile(`^%(-?[0-9]+(?:\.[0-9]+)?)%`)
+)
+
+// parseGIFT reads the questions of a GIFT file. Questions are separated by
+// blank lines; comments before a question may hold its tags.
+func parseGIFT(data []byte) ([]importedItem, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	items := []importedItem{}
+	var lines, tags []string
+	flush := func() {
+		if len(lines) > 0 {
+			item := importedItem{}
+			item.Name, item.Question, item.Err = giftImport(strings.Join(lines, "\n"))
+			applyTags(&item.Question, tags)
+			items = append(items, item)
+		}
+		lines, tags = nil, nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			for _, match := range giftTag.FindAllStringSubmatch(trimmed, -1) {
+				tags = append(tags, match[1])
+			}
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			flush()
+			items = append(items, importedItem{Err: errSkipItem})
+		default:
+			lines = append(lines, line)
+		}
+	}
+	flush()
+
+	if len(items) == 0 {
+		return nil, errors.New("not a GIFT file: no questions found")
+	}
+	return items, nil
+}
+
+// giftImport reads one GIFT question: an optional ::name::, an optional
+// [format], the text and an answer block in braces. Text after the block
+// makes it a fill in the blank question.
+func giftImport(text string) (string, models.Question, error) {
+	question := models.Question{}
+	text = strings.TrimSpace(text)
+
+	name := ""
+	if strings.HasPrefix(text, "::") {
+		end := giftIndex(text[2:], "::")
+		if end < 0 {
+			return "", question, errors.New("the question name is not closed with ::")
+		}
+		name = giftUnescape(text[2 : 2+end])
+		text = strings.TrimSpace(text[4+end:])
+	}
+
+	isHTML := false
+	if format := giftFormat.FindStringSubmatch(text); format != nil {
+		isHTML = format[1] == "html"
+		text = text[len(format[0]):]
+	}
+	field := func(text string) string {
+		text = giftUnescape(text)
+		if isHTML {
+			return htmlText(text)
+		}
+		return text
+	}
+
+	open := giftIndex(text, "{")
+	if open < 0 {
+		return name, question, errors.New("no answer block in braces")
+	}
+	end := giftIndex(text[open:], "}")
+	if end < 0 {
+		return name, question, errors.New("the answer block is not closed with }")
+	}
+	block, after := text[open+1:open+end], text[open+end+1:]
+
+	question.Question = field(text[:open])
+	if strings.TrimSpace(after) != "" {
+		question.Question = field(text[:open] + fillBlankPlaceholder + after)
+	}
+
+	if feedback := giftIndex(block, "####"); feedback >= 0 {
+		question.Explanation = field(block[feedback+4:])
+		block = block[:feedback]
+	}
+	block = strings.TrimSpace(block)
+
+	switch {
+	case block == "":
+		question.Type = models.QuestionEssay
+
+	case strings.HasPrefix(block, "#"):
+		question.Type = models.QuestionNumeric
+		if err := giftNumeric(&question, block[1:]); err != nil {
+			return name, question, err
+		}
+
+	case giftTrueFalse(block) != "":
+		question.Type = models.QuestionTrueFalse
+		question.CorrectAnswer = giftTrueFalse(block)
+
+	default:
+		if err := giftChoices(&question, block, field); err != nil {
+			return name, question, err
+		}
+	}
+
+	if strings.Contains(question.Question, fillBlankPlaceholder) && question.Type == models.QuestionShortAnswer {
+		question.Type = models.QuestionFillBlank
+	}
+	return name, question, nil
+}
+
+// giftTrueFalse is the answer of a true/false answer block, or "" when
+// block is not one
+func giftTrueFalse(block string) string {
+	if i := giftIndex(block, "#"); i >= 0 {
+		block = block[:i]
+	}
+	switch strings.ToUpper(strings.TrimSpace(block)) {
+	case "T", "TRUE":
+		return "true"
+	case "F", "FALSE":
+		return "false"
+	}
+	return ""
+}
+
+// giftChoices reads an answer block of = and ~ answers: multiple choice
+// when it has wrong answers, matching when its answers are pairs and short
+// answer otherwise
+func giftChoices(question *models.Question, block string, field func(string) string) error {
+	parts := giftSplit(block, "=~")
+	if strings.TrimSpace(parts[0]) != "" {
+		return fmt.Errorf("unexpected %q before the first answer", strings.TrimSpace(parts[0]))
+	}
+
+	type giftAnswer struct {
+		right  bool
+		weight float64
+		text   string
+	}
+	var answers []giftAnswer
+	hasWrong, hasPairs := false, false
+	for i, part := range parts[1:] {
+		answer := giftAnswer{right: part[0] == '=', text: part[1:]}
+		if answer.right {
+			answer.weight = 100
+		}
+		if weight := giftWeight.FindStringSubmatch(answer.text); weight != nil {
+			value, err := strconv.ParseFloat(weight[1], 64)
+			if err != nil {
+				return fmt.Errorf("answer %d has an invalid weight", i+1)
+			}
+			answer.weight = value
+			answer.text = answer.text[len(weight[0]):]
+		}
+		// Feedback of single answers has no place in the question model
+		if feedback := giftIndex(answer.text, "#"); feedback >= 0 {
+			answer.text = answer.text[:feedback]
+		}
+		if !answer.right {
+			hasWrong = true
+		}
+		if giftIndex(answer.text, "->") >= 0 {
+			hasPairs = true
+		}
+		answers = append(answers, answer)
+	}
+
+	switch {
+	case hasPairs:
+		question.Type = models.QuestionMatching
+		optionIDs := map[string]string{}
+		for i, answer := range answers {
+			arrow := giftIndex(answer.text, "->")
+			if !answer.right || arrow < 0 {
+				return fmt.Errorf("answer %d is not a pair written as =prompt -> match", i+1)
+			}
+			prompt, match := field(answer.text[:arrow]), field(answer.text[arrow+2:])
+			if _, ok := optionIDs[match]; !ok && match != "" {
+				optionIDs[match] = OptionID(len(question.Options))
+				question.Options = append(question.Options, match)
+			}
+			if prompt == "" {
+				continue // a distractor
+			}
+			question.Prompts = append(question.Prompts, prompt)
+			question.CorrectAnswers = append(question.CorrectAnswers, optionIDs[match])
+		}
+
+	case hasWrong:
+		// An answer marked = is the one right option; without one, every
+		// option with a positive weight is right
+		question.Type = models.QuestionMultiSelect
+		for i, answer := range answers {
+			question.Options = append(question.Options, field(answer.text))
+			if answer.right && question.Type == models.QuestionMultiSelect {
+				question.Type = models.QuestionMultipleChoice
+				question.CorrectAnswer = OptionID(i)
+			}
+			if answer.weight > 0 {
+				question.CorrectAnswers = append(question.CorrectAnswers, OptionID(i))
+			}
+		}
+		if question.Type == models.QuestionMultipleChoice {
+			question.CorrectAnswers = nil
+		}
+
+	default:
+		question.Type = models.QuestionShortAnswer
+		for _, answer := range answers {
+			if answer.weight == 100 {
+				question.AcceptedAnswers = append(question.AcceptedAnswers, field(answer.text))
+			}
+		}
+	}
+
+	return nil
+}
+
+// giftNumeric reads a numeric answer block without its leading #: a value
+// with an optional :tolerance, a min..max range, or = answers of those
+func giftNumeric(question *models.Question, block string) error {
+	answers := giftSplit(block, "=")
+	if len(answers) > 1 {
+		answers = answers[1:]
+	}
+
+	for _, answer := range answers {
+		answer = strings.TrimSpace(strings.TrimPrefix(answer, "="))
+		weight := 100.0
+		if match := giftWeight.FindStringSubmatch(answer); match != nil {
+			weight, _ = strconv.ParseFloat(match[1], 64)
+			answer = answer[len(match[0]):]
+		}
+		if feedback := giftIndex(answer, "#"); feedback >= 0 {
+			answer = answer[:feedback]
+		}
+		if weight != 100 {
+			continue
+		}
+
+		answer = strings.TrimSpace(answer)
+		if low, high, ok := strings.Cut(answer, ".."); ok {
+			min, minOK := parseNumber(low)
+			max, maxOK := parseNumber(high)
+			if !minOK || !maxOK || min > max {
+				return fmt.Errorf("invalid range %q", answer)
+			}
+			question.CorrectAnswer = formatNumber((min + max) / 2)
+			question.Tolerance = (max - min) / 2
+			return nil
+		}
+
+		value, tolerance, hasTolerance := strings.Cut(giftUnescape(answer), ":")
+		question.CorrectAnswer = strings.TrimSpace(value)
+		if hasTolerance {
+			t, ok := parseNumber(tolerance)
+			if !ok {
+				return fmt.Errorf("invalid tolerance %q", tolerance)
+			}
+			question.Tolerance = t
+		}
+		return nil
+	}
+
+	return errors.New("no fully correct numeric answer")
+}
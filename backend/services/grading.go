@@ -0,0 +1,651 @@
+package services
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"quicacademy-backend/models"
+)
+
+// QuestionResult is the graded outcome of a single question
+type QuestionResult struct {
+	QuestionID    int                     `json:"question_id"`
+	Answer        models.Answer           `json:"answer"` // normalized, null when unanswered
+	CorrectAnswer models.Answer           `json:"correct_answer"`
+	Credit        float64                 `json:"credit"` // share of the question earned, 0-1
+	Correct       bool                    `json:"correct"`
+	Pending       bool                    `json:"pending,omitempty"` // essay waiting to be graded
+	Criteria      []models.CriterionScore `json:"criteria,omitempty"`
+	Feedback      string                  `json:"feedback,omitempty"`
+	Overridden    bool                    `json:"overridden,omitempty"` // scored by a teacher
+}
+
+// GradeResult is the graded outcome of a whole quiz
+type GradeResult struct {
+	Correct int              `json:"correct"` // questions answered fully correctly
+	Points  float64          `json:"points"`  // sum of credit, partial answers included
+	Total   int              `json:"total"`
+	Pending int              `json:"pending"` // essays not graded yet, counted as 0
+	Score   int              `json:"score"`   // percentage of points, 0-100
+	Passed  bool             `json:"passed"`  // false while essays are pending
+	Results []QuestionResult `json:"results"`
+}
+
+// optionPrefix matches a leading option letter such as "A. ", "b) " or "(C) "
+var optionPrefix = regexp.MustCompile(`^\(?([A-Za-z])[.)]\s+`)
+
+var trueFalseAnswers = map[string]string{
+	"true": "true", "t": "true", "benar": "true", "b": "true", "ya": "true", "yes": "true",
+	"false": "false", "f": "false", "salah": "false", "s": "false", "tidak": "false", "no": "false",
+}
+
+// defaultRubric is used for essays generated without a rubric
+var defaultRubric = []models.RubricCriterion{{Criterion: "overall", Points: 10}}
+
+// numericTolerance absorbs float rounding when comparing numeric answers
+const numericTolerance = 1e-9
+
+// OptionID returns the canonical ID of the option at index: A, B, C, ...
+func OptionID(index int) string {
+	return string(rune('A' + index))
+}
+
+// NormalizeQuestions brings questions into canonical form: unique positive
+// IDs, options without letter prefixes and answer keys as option IDs, texts
+// or numbers as described on models.Question. It is idempotent, so it is safe
+// to run on quizzes that were already normalized.
+func NormalizeQuestions(questions []models.Question) []models.Question {
+	normalized := make([]models.Question, len(questions))
+	seen := map[int]bool{}
+	nextID := 1
+	for _, question := range questions {
+		if question.ID >= nextID {
+			nextID = question.ID + 1
+		}
+	}
+
+	for i, question := range questions {
+		if question.ID <= 0 || seen[question.ID] {
+			question.ID = nextID
+			nextID++
+		}
+		seen[question.ID] = true
+
+		normalized[i] = normalizeQuestion(question)
+	}
+
+	return normalized
+}
+
+func normalizeQuestion(question models.Question) models.Question {
+	if question.Type == "" {
+		switch {
+		case len(question.Pairs) > 0:
+			question.Type = models.QuestionMatching
+		case len(question.Items) > 0:
+			question.Type = models.QuestionOrdering
+		case len(question.Options) > 0:
+			question.Type = models.QuestionMultipleChoice
+		default:
+			question.Type = models.QuestionTrueFalse
+		}
+	}
+
+	// Keep the raw options around so an answer key given as the full option
+	// text ("A. Pilihan 1") still resolves
+	rawOptions := question.Options
+	question.Options = stripOptionPrefixes(question.Options)
+	question.Concept, question.Concepts = normalizeConcepts(question.Concept, question.Concepts)
+
+	resolve := func(answer string) string {
+		if id := matchOption(question.Options, answer); id != "" {
+			return id
+		}
+		if id := matchOption(rawOptions, answer); id != "" {
+			return id
+		}
+		return strings.TrimSpace(answer)
+	}
+
+	switch question.Type {
+	case models.QuestionMultipleChoice:
+		question.CorrectAnswer = resolve(question.CorrectAnswer)
+
+	case models.QuestionTrueFalse:
+		if correct := trueFalseAnswers[strings.ToLower(strings.TrimSpace(question.CorrectAnswer))]; correct != "" {
+			question.CorrectAnswer = correct
+		}
+
+	case models.QuestionMultiSelect:
+		correct := question.CorrectAnswers
+		if len(correct) == 0 && question.CorrectAnswer != "" {
+			correct = strings.Split(question.CorrectAnswer, ",")
+		}
+		question.CorrectAnswer = ""
+		question.CorrectAnswers = selection(correct, resolve)
+
+	case models.QuestionFillBlank, models.QuestionShortAnswer:
+		question.CorrectAnswer = strings.TrimSpace(question.CorrectAnswer)
+		accepted := []string{}
+		for _, answer := range question.AcceptedAnswers {
+			if answer = strings.TrimSpace(answer); answer != "" {
+				accepted = append(accepted, answer)
+			}
+		}
+		if question.CorrectAnswer == "" && len(accepted) > 0 {
+			question.CorrectAnswer, accepted = accepted[0], accepted[1:]
+		}
+		question.AcceptedAnswers = nil
+		if len(accepted) > 0 {
+			question.AcceptedAnswers = accepted
+		}
+
+	case models.QuestionMatching:
+		if len(question.Pairs) > 0 && len(question.Prompts) == 0 {
+			prompts := make([]string, len(question.Pairs))
+			rights := make([]string, len(question.Pairs))
+			for j, pair := range question.Pairs {
+				prompts[j] = strings.TrimSpace(pair.Left)
+				rights[j] = strings.TrimSpace(pair.Right)
+			}
+			question.Prompts = prompts
+			question.Options = scramble(distinct(rights), question.Question)
+			question.CorrectAnswers = rights
+		}
+		question.Pairs = nil
+		question.CorrectAnswers = mapAnswers(question.CorrectAnswers, resolve)
+
+	case models.QuestionOrdering:
+		if len(question.Items) > 0 && len(question.Options) == 0 {
+			items := make([]string, len(question.Items))
+			for j, item := range question.Items {
+				items[j] = strings.TrimSpace(item)
+			}
+			question.Options = scramble(items, question.Question)
+			question.CorrectAnswers = items
+		}
+		question.Items = nil
+		question.CorrectAnswers = mapAnswers(question.CorrectAnswers, resolve)
+
+	case models.QuestionNumeric:
+		if value, ok := parseNumber(question.CorrectAnswer); ok {
+			question.CorrectAnswer = formatNumber(value)
+		}
+		question.Tolerance = math.Abs(question.Tolerance)
+
+	case models.QuestionEssay:
+		rubric := []models.RubricCriterion{}
+		for _, criterion := range question.Rubric {
+			criterion.Criterion = strings.TrimSpace(criterion.Criterion)
+			if criterion.Criterion != "" && criterion.Points > 0 {
+				rubric = append(rubric, criterion)
+			}
+		}
+		if len(rubric) == 0 {
+			rubric = defaultRubric
+		}
+		question.Rubric = rubric
+		question.ModelAnswer = strings.TrimSpace(question.ModelAnswer)
+	}
+
+	return question
+}
+
+// NormalizeAnswer maps a student's answer to the canonical form of question:
+// option IDs for choice, matching and ordering questions, "true"/"false" for
+// true/false and a plain number for numeric questions. Letters and option
+// texts are both accepted, case and surrounding whitespace are ignored.
+// Answers that match nothing are kept trimmed; empty answers become nil.
+func NormalizeAnswer(question models.Question, answer models.Answer) models.Answer {
+	values := make([]string, 0, len(answer))
+	for _, value := range answer {
+		values = append(values, strings.TrimSpace(value))
+	}
+	if strings.Join(values, "") == "" {
+		return nil
+	}
+
+	resolve := func(value string) string {
+		if id := matchOption(question.Options, value); id != "" {
+			return id
+		}
+		return value
+	}
+
+	switch question.Type {
+	case models.QuestionTrueFalse:
+		value := values[0]
+		if normalized := trueFalseAnswers[strings.ToLower(strings.TrimRight(value, "."))]; normalized != "" {
+			return models.Answer{normalized}
+		}
+		return models.Answer{value}
+
+	case models.QuestionMultiSelect:
+		// "A, C" is accepted as well as ["A", "C"]
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		return selection(values, resolve)
+
+	case models.QuestionMatching, models.QuestionOrdering:
+		return mapAnswers(values, resolve)
+
+	case models.QuestionNumeric:
+		if value, ok := parseNumber(values[0]); ok {
+			return models.Answer{formatNumber(value)}
+		}
+		return models.Answer{values[0]}
+
+	case models.QuestionFillBlank, models.QuestionShortAnswer, models.QuestionEssay:
+		return models.Answer{values[0]}
+
+	default:
+		return models.Answer{resolve(values[0])}
+	}
+}
+
+// AnswerKey returns the correct answer of a normalized question in the same
+// form NormalizeAnswer produces. Essays have no key, only a model answer.
+func AnswerKey(question models.Question) models.Answer {
+	switch question.Type {
+	case models.QuestionMultiSelect, models.QuestionMatching, models.QuestionOrdering:
+		return models.Answer(question.CorrectAnswers)
+	case models.QuestionEssay:
+		if question.ModelAnswer == "" {
+			return nil
+		}
+		return models.Answer{question.ModelAnswer}
+	default:
+		return models.Answer{question.CorrectAnswer}
+	}
+}
+
+// GradeQuestion returns the share of the question earned by a normalized
+// answer, from 0 to 1. Multi-select and matching questions earn partial
+// credit, every other type is all or nothing. Essays can't be graded here and
+// earn 0 until ApplyEssayScores is called.
+func GradeQuestion(question models.Question, answer models.Answer) float64 {
+	if len(answer) == 0 {
+		return 0
+	}
+
+	switch question.Type {
+	case models.QuestionEssay:
+		return 0
+
+	case models.QuestionMultiSelect:
+		// Each wrong selection cancels a right one, so selecting every
+		// option doesn't pay off
+		if len(question.CorrectAnswers) == 0 {
+			return 0
+		}
+		correct := map[string]bool{}
+		for _, id := range question.CorrectAnswers {
+			correct[id] = true
+		}
+		hits := 0
+		for _, id := range answer {
+			if correct[id] {
+				hits++
+			} else {
+				hits--
+			}
+		}
+		return math.Max(0, float64(hits)/float64(len(correct)))
+
+	case models.QuestionMatching:
+		if len(question.CorrectAnswers) == 0 {
+			return 0
+		}
+		hits := 0
+		for i, id := range question.CorrectAnswers {
+			if i < len(answer) && answer[i] == id {
+				hits++
+			}
+		}
+		return float64(hits) / float64(len(question.CorrectAnswers))
+
+	case models.QuestionOrdering:
+		return credit(equalAnswers(answer, question.CorrectAnswers))
+
+	case models.QuestionFillBlank, models.QuestionShortAnswer:
+		given := canonicalText(answer[0])
+		for _, accepted := range append([]string{question.CorrectAnswer}, question.AcceptedAnswers...) {
+			if accepted != "" && canonicalText(accepted) == given {
+				return 1
+			}
+		}
+		return 0
+
+	case models.QuestionNumeric:
+		given, ok := parseNumber(answer[0])
+		expected, expectedOK := parseNumber(question.CorrectAnswer)
+		return credit(ok && expectedOK && math.Abs(given-expected) <= question.Tolerance+numericTolerance)
+
+	default:
+		return credit(len(answer) == 1 && answer[0] == question.CorrectAnswer)
+	}
+}
+
+// GradeQuiz grades answers, keyed by question ID ("1", "2", ...), against
+// normalized questions. Every question is worth one point. Answered essays
+// are left pending. A quiz without questions scores 0 and never passes.
+func GradeQuiz(questions []models.Question, answers map[string]models.Answer, passingScore int) GradeResult {
+	results := make([]QuestionResult, 0, len(questions))
+
+	for _, question := range questions {
+		answer := NormalizeAnswer(question, answers[strconv.Itoa(question.ID)])
+		earned := GradeQuestion(question, answer)
+
+		results = append(results, QuestionResult{
+			QuestionID:    question.ID,
+			Answer:        answer,
+			CorrectAnswer: AnswerKey(question),
+			Credit:        earned,
+			Correct:       earned == 1,
+			Pending:       question.Type == models.QuestionEssay && len(answer) > 0,
+		})
+	}
+
+	return SummarizeGrade(results, passingScore)
+}
+
+// SummarizeGrade totals per-question results into a quiz grade. It is used
+// again whenever a result changes after submission.
+func SummarizeGrade(results []QuestionResult, passingScore int) GradeResult {
+	grade := GradeResult{
+		Total:   len(results),
+		Results: results,
+	}
+
+	for _, result := range results {
+		if result.Pending {
+			grade.Pending++
+			continue
+		}
+		if result.Correct {
+			grade.Correct++
+		}
+		grade.Points += result.Credit
+	}
+
+	if grade.Total > 0 {
+		grade.Score = int(math.Floor(grade.Points*100/float64(grade.Total) + numericTolerance))
+		grade.Passed = grade.Pending == 0 && grade.Score >= passingScore
+	}
+
+	return grade
+}
+
+// QuestionMaxPoints is what a question is scored out of: the rubric total for
+// essays, 1 for everything else
+func QuestionMaxPoints(question models.Question) float64 {
+	if question.Type != models.QuestionEssay {
+		return 1
+	}
+	total := 0
+	for _, criterion := range question.Rubric {
+		total += criterion.Points
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(total)
+}
+
+// ApplyEssayScores records per-criterion scores on an essay result, matching
+// them to the rubric by criterion name. Points are clamped to each
+// criterion's maximum and criteria without a score earn 0.
+func ApplyEssayScores(result *QuestionResult, question models.Question, scores []models.CriterionScore, feedback string) {
+	byName := map[string]models.CriterionScore{}
+	for _, score := range scores {
+		byName[strings.ToLower(strings.TrimSpace(score.Criterion))] = score
+	}
+
+	criteria := make([]models.CriterionScore, len(question.Rubric))
+	earned := 0.0
+	for i, criterion := range question.Rubric {
+		score := byName[strings.ToLower(criterion.Criterion)]
+		points := math.Max(0, math.Min(score.Points, float64(criterion.Points)))
+		earned += points
+
+		criteria[i] = models.CriterionScore{
+			Criterion: criterion.Criterion,
+			Points:    points,
+			MaxPoints: criterion.Points,
+			Feedback:  score.Feedback,
+		}
+	}
+
+	result.Criteria = criteria
+	result.Feedback = feedback
+	result.Credit = earned / QuestionMaxPoints(question)
+	result.Correct = result.Credit >= 1-numericTolerance
+	result.Pending = false
+}
+
+// OverrideScore sets a question's score to points out of QuestionMaxPoints,
+// as decided by a teacher
+func OverrideScore(result *QuestionResult, question models.Question, points float64, feedback string) {
+	result.Credit = math.Max(0, math.Min(points/QuestionMaxPoints(question), 1))
+	result.Correct = result.Credit >= 1-numericTolerance
+	result.Pending = false
+	result.Overridden = true
+	if feedback != "" {
+		result.Feedback = feedback
+	}
+}
+
+// ShuffleOptions returns a copy of a normalized question with its options in
+// random order and the answer key remapped to the new option IDs. Questions
+// without options are returned unchanged.
+func ShuffleOptions(question models.Question, random *rand.Rand) models.Question {
+	if len(question.Options) < 2 {
+		return question
+	}
+
+	perm := random.Perm(len(question.Options))
+	options := make([]string, len(perm))
+	moved := make(map[string]string, len(perm))
+	for i, j := range perm {
+		options[i] = question.Options[j]
+		moved[OptionID(j)] = OptionID(i)
+	}
+
+	remap := func(id string) string {
+		if to, ok := moved[id]; ok {
+			return to
+		}
+		return id
+	}
+
+	question.Options = options
+	switch question.Type {
+	case models.QuestionMultipleChoice:
+		question.CorrectAnswer = remap(question.CorrectAnswer)
+	case models.QuestionMultiSelect:
+		question.CorrectAnswers = selection(question.CorrectAnswers, remap)
+	case models.QuestionMatching, models.QuestionOrdering:
+		question.CorrectAnswers = mapAnswers(question.CorrectAnswers, remap)
+	}
+
+	return question
+}
+
+// matchOption resolves answer against options, as a bare letter ("b"), a
+// prefixed option ("B. Teks") or the option text itself
+func matchOption(options []string, answer string) string {
+	answer = strings.TrimSpace(answer)
+	if answer == "" || len(options) == 0 {
+		return ""
+	}
+
+	letter := strings.ToUpper(strings.TrimRight(strings.Trim(answer, "()"), ".)"))
+	if len(letter) == 1 && letter[0] >= 'A' && int(letter[0]-'A') < len(options) {
+		return letter
+	}
+
+	if match := optionPrefix.FindStringSubmatch(answer); match != nil {
+		if index := int(strings.ToUpper(match[1])[0] - 'A'); index < len(options) {
+			return OptionID(index)
+		}
+	}
+
+	for i, option := range options {
+		if strings.EqualFold(strings.TrimSpace(optionPrefix.ReplaceAllString(option, "")), answer) {
+			return OptionID(i)
+		}
+	}
+
+	return ""
+}
+
+func stripOptionPrefixes(options []string) []string {
+	if len(options) == 0 {
+		return options
+	}
+	stripped := make([]string, len(options))
+	for i, option := range options {
+		stripped[i] = strings.TrimSpace(optionPrefix.ReplaceAllString(strings.TrimSpace(option), ""))
+	}
+	return stripped
+}
+
+// selection resolves a set of chosen options into sorted, distinct IDs
+func selection(values []string, resolve func(string) string) models.Answer {
+	seen := map[string]bool{}
+	ids := models.Answer{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		if id := resolve(value); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// mapAnswers resolves every value of an ordered answer, keeping its order
+func mapAnswers(values []string, resolve func(string) string) models.Answer {
+	if len(values) == 0 {
+		return nil
+	}
+	ids := make(models.Answer, len(values))
+	for i, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			ids[i] = resolve(value)
+		}
+	}
+	return ids
+}
+
+func distinct(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// scramble shuffles items deterministically by seed, so the same question
+// always shows its items in the same order, and never in the given order
+func scramble(items []string, seed string) []string {
+	hash := fnv.New64a()
+	hash.Write([]byte(seed))
+	random := rand.New(rand.NewSource(int64(hash.Sum64())))
+
+	scrambled := make([]string, len(items))
+	for i, j := range random.Perm(len(items)) {
+		scrambled[i] = items[j]
+	}
+
+	if len(scrambled) > 1 && equalAnswers(scrambled, items) {
+		scrambled = append(scrambled[1:], scrambled[0])
+	}
+	return scrambled
+}
+
+// canonicalText folds case, spacing and surrounding punctuation so free-text
+// answers can be compared
+func canonicalText(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	return strings.Trim(text, ".,;:!?\"'()")
+}
+
+// parseNumber parses a decimal number written either way: "3.14" or the
+// Indonesian "3,14", with optional thousands separators ("1.000,5")
+func parseNumber(text string) (float64, bool) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), " ", "")
+	lastDot, lastComma := strings.LastIndex(text, "."), strings.LastIndex(text, ",")
+
+	switch {
+	case lastComma > lastDot:
+		text = strings.ReplaceAll(text, ".", "")
+		text = strings.Replace(text, ",", ".", 1)
+	case lastComma != -1:
+		text = strings.ReplaceAll(text, ",", "")
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func equalAnswers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func credit(correct bool) float64 {
+	if correct {
+		return 1
+	}
+	return 0
+}
+
+// normalizeConcepts trims the concepts of a question and drops duplicates.
+// The main concept is always listed, and defaults to the first one listed.
+func normalizeConcepts(concept string, concepts []string) (string, []string) {
+	concept = strings.TrimSpace(concept)
+
+	var normalized []string
+	seen := map[string]bool{}
+	for _, name := range append([]string{concept}, concepts...) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		normalized = append(normalized, name)
+	}
+
+	if concept == "" && len(normalized) > 0 {
+		concept = normalized[0]
+	}
+	return concept, normalized
+}
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"quicacademy-backend/models"
+)
+
+func multipleChoice(id int, correct string, options ...string) models.Question {
+	return models.Question{
+		ID:            id,
+		Type:          models.QuestionMultipleChoice,
+		Question:      "Pertanyaan",
+		Options:       options,
+		CorrectAnswer: correct,
+	}
+}
+
+func trueFalse(id int, correct string) models.Question {
+	return models.Question{
+		ID:            id,
+		Type:          models.QuestionTrueFalse,
+		Question:      "Benar atau salah?",
+		CorrectAnswer: correct,
+	}
+}
+
+// answers builds an answer map from question ID and answer pairs
+func answers(pairs ...string) map[string]models.Answer {
+	result := map[string]models.Answer{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		result[pairs[i]] = models.Answer{pairs[i+1]}
+	}
+	return result
+}
+
+func TestNormalizeQuestions(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       models.Question
+		options  []string
+		expected string
+	}{
+		{
+			name:     "letter answer with prefixed options",
+			in:       multipleChoice(1, "B", "A. Satu", "B. Dua", "C. Tiga"),
+			options:  []string{"Satu", "Dua", "Tiga"},
+			expected: "B",
+		},
+		{
+			name:     "lowercase letter with period",
+			in:       multipleChoice(1, "c.", "Satu", "Dua", "Tiga"),
+			options:  []string{"Satu", "Dua", "Tiga"},
+			expected: "C",
+		},
+		{
+			name:     "full option text",
+			in:       multipleChoice(1, "Dinamis dan dapat berkembang", "Statis", "Dinamis dan dapat berkembang"),
+			options:  []string{"Statis", "Dinamis dan dapat berkembang"},
+			expected: "B",
+		},
+		{
+			name:     "full option text with prefix",
+			in:       multipleChoice(1, "D. Semua benar", "A. Konsep dasar", "B. Aplikasi", "C. Teori", "D. Semua benar"),
+			options:  []string{"Konsep dasar", "Aplikasi", "Teori", "Semua benar"},
+			expected: "D",
+		},
+		{
+			name:     "parenthesized prefixes",
+			in:       multipleChoice(1, "(a)", "(a) Satu", "(b) Dua"),
+			options:  []string{"Satu", "Dua"},
+			expected: "A",
+		},
+		{
+			name:     "option text that looks like a sentence is kept",
+			in:       multipleChoice(1, "A", "Konsep A yang mendasar", "Konsep B"),
+			options:  []string{"Konsep A yang mendasar", "Konsep B"},
+			expected: "A",
+		},
+		{
+			name:     "letter out of range is left alone",
+			in:       multipleChoice(1, "E", "Satu", "Dua"),
+			options:  []string{"Satu", "Dua"},
+			expected: "E",
+		},
+		{
+			name:     "true false in Indonesian",
+			in:       trueFalse(1, "Benar"),
+			expected: "true",
+		},
+		{
+			name:     "true false uppercase",
+			in:       trueFalse(1, "FALSE"),
+			expected: "false",
+		},
+		{
+			name:     "missing type without options is true false",
+			in:       models.Question{ID: 1, CorrectAnswer: "salah"},
+			expected: "false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeQuestions([]models.Question{tt.in})[0]
+			if got.CorrectAnswer != tt.expected {
+				t.Errorf("correct answer = %q, want %q", got.CorrectAnswer, tt.expected)
+			}
+			if !reflect.DeepEqual(got.Options, tt.options) {
+				t.Errorf("options = %q, want %q", got.Options, tt.options)
+			}
+
+			// Normalizing again must not change anything
+			again := NormalizeQuestions([]models.Question{got})[0]
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("not idempotent: %+v became %+v", got, again)
+			}
+		})
+	}
+}
+
+func TestNormalizeQuestionsIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		ids      []int
+		expected []int
+	}{
+		{name: "already unique", ids: []int{1, 2, 3}, expected: []int{1, 2, 3}},
+		{name: "missing ids", ids: []int{0, 0, 0}, expected: []int{1, 2, 3}},
+		{name: "duplicates", ids: []int{1, 1, 2}, expected: []int{1, 3, 2}},
+		{name: "negative", ids: []int{-1, 5}, expected: []int{6, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions := make([]models.Question, len(tt.ids))
+			for i, id := range tt.ids {
+				questions[i] = trueFalse(id, "true")
+			}
+
+			got := NormalizeQuestions(questions)
+			for i, question := range got {
+				if question.ID != tt.expected[i] {
+					t.Errorf("question %d id = %d, want %d", i, question.ID, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	mc := NormalizeQuestions([]models.Question{multipleChoice(1, "B", "A. Merah", "B. Hijau", "C. Biru")})[0]
+	tf := trueFalse(2, "true")
+
+	tests := []struct {
+		name     string
+		question models.Question
+		answer   string
+		expected string
+	}{
+		{name: "letter", question: mc, answer: "B", expected: "B"},
+		{name: "lowercase letter", question: mc, answer: " b ", expected: "B"},
+		{name: "letter with parenthesis", question: mc, answer: "b)", expected: "B"},
+		{name: "option text", question: mc, answer: "Hijau", expected: "B"},
+		{name: "option text any case", question: mc, answer: "hijau", expected: "B"},
+		{name: "prefixed option text", question: mc, answer: "C. Biru", expected: "C"},
+		{name: "unknown answer is kept", question: mc, answer: "Ungu", expected: "Ungu"},
+		{name: "letter out of range is kept", question: mc, answer: "D", expected: "D"},
+		{name: "empty", question: mc, answer: "", expected: ""},
+		{name: "true", question: tf, answer: "True", expected: "true"},
+		{name: "benar", question: tf, answer: "benar", expected: "true"},
+		{name: "salah", question: tf, answer: "Salah.", expected: "false"},
+		{name: "no", question: tf, answer: "no", expected: "false"},
+		{name: "garbage true false", question: tf, answer: "mungkin", expected: "mungkin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeAnswer(tt.question, models.Answer{tt.answer})
+			var want models.Answer
+			if tt.expected != "" {
+				want = models.Answer{tt.expected}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("NormalizeAnswer(%q) = %q, want %q", tt.answer, got, want)
+			}
+		})
+	}
+}
+
+func TestGradeQuiz(t *testing.T) {
+	questions := NormalizeQuestions([]models.Question{
+		multipleChoice(1, "A", "A. Satu", "B. Dua", "C. Tiga"),
+		multipleChoice(2, "Tiga", "Satu", "Dua", "Tiga"),
+		trueFalse(3, "true"),
+		trueFalse(10, "false"),
+	})
+
+	tests := []struct {
+		name         string
+		questions    []models.Question
+		answers      map[string]models.Answer
+		passingScore int
+		correct      int
+		score        int
+		passed       bool
+	}{
+		{
+			name:         "all correct with letters",
+			questions:    questions,
+			answers:      answers("1", "A", "2", "C", "3", "true", "10", "false"),
+			passingScore: 70,
+			correct:      4,
+			score:        100,
+			passed:       true,
+		},
+		{
+			name:         "all correct with option texts",
+			questions:    questions,
+			answers:      answers("1", "Satu", "2", "tiga", "3", "Benar", "10", "Salah"),
+			passingScore: 70,
+			correct:      4,
+			score:        100,
+			passed:       true,
+		},
+		{
+			name:         "ids above nine are looked up by decimal key",
+			questions:    questions,
+			answers:      answers("10", "false"),
+			passingScore: 70,
+			correct:      1,
+			score:        25,
+			passed:       false,
+		},
+		{
+			name:         "wrong answers",
+			questions:    questions,
+			answers:      answers("1", "B", "2", "A", "3", "false", "10", "true"),
+			passingScore: 0,
+			correct:      0,
+			score:        0,
+			passed:       true,
+		},
+		{
+			name:         "unanswered",
+			questions:    questions,
+			answers:      nil,
+			passingScore: 70,
+			correct:      0,
+			score:        0,
+			passed:       false,
+		},
+		{
+			name:         "score is rounded down",
+			questions:    questions[:3],
+			answers:      answers("1", "A", "2", "C"),
+			passingScore: 66,
+			correct:      2,
+			score:        66,
+			passed:       true,
+		},
+		{
+			name:         "no questions",
+			questions:    nil,
+			answers:      answers("1", "A"),
+			passingScore: 0,
+			correct:      0,
+			score:        0,
+			passed:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GradeQuiz(tt.questions, tt.answers, tt.passingScore)
+			if got.Correct != tt.correct || got.Score != tt.score || got.Passed != tt.passed {
+				t.Errorf("got correct=%d score=%d passed=%v, want correct=%d score=%d passed=%v",
+					got.Correct, got.Score, got.Passed, tt.correct, tt.score, tt.passed)
+			}
+			if got.Total != len(tt.questions) || len(got.Results) != len(tt.questions) {
+				t.Errorf("got total=%d with %d results, want %d", got.Total, len(got.Results), len(tt.questions))
+			}
+		})
+	}
+}
+
+func TestNormalizeQuestionTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      models.Question
+		options []string
+		prompts []string
+		key     models.Answer
+	}{
+		{
+			name:    "multi select from comma separated letters",
+			in:      models.Question{Type: models.QuestionMultiSelect, Options: []string{"A. Merah", "B. Hijau", "C. Biru"}, CorrectAnswer: "C, a"},
+			options: []string{"Merah", "Hijau", "Biru"},
+			key:     models.Answer{"A", "C"},
+		},
+		{
+			name:    "multi select from option texts",
+			in:      models.Question{Type: models.QuestionMultiSelect, Options: []string{"Merah", "Hijau", "Biru"}, CorrectAnswers: []string{"Biru", "Hijau", "Biru"}},
+			options: []string{"Merah", "Hijau", "Biru"},
+			key:     models.Answer{"B", "C"},
+		},
+		{
+			name: "matching from pairs",
+			in: models.Question{Type: models.QuestionMatching, Question: "Pasangkan", Pairs: []models.MatchPair{
+				{Left: "Jakarta", Right: "Indonesia"},
+				{Left: "Tokyo", Right: "Jepang"},
+				{Left: "Bangkok", Right: "Thailand"},
+			}},
+			prompts: []string{"Jakarta", "Tokyo", "Bangkok"},
+		},
+		{
+			name:    "ordering from items",
+			in:      models.Question{Type: models.QuestionOrdering, Question: "Urutkan", Items: []string{"Satu", "Dua", "Tiga", "Empat"}},
+			options: nil,
+		},
+		{
+			name: "fill blank promotes the first accepted answer",
+			in:   models.Question{Type: models.QuestionFillBlank, AcceptedAnswers: []string{" fotosintesis ", "", "photosynthesis"}},
+			key:  models.Answer{"fotosintesis"},
+		},
+		{
+			name: "numeric with decimal comma",
+			in:   models.Question{Type: models.QuestionNumeric, CorrectAnswer: "3,50", Tolerance: -0.1},
+			key:  models.Answer{"3.5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeQuestions([]models.Question{tt.in})[0]
+
+			if tt.options != nil && !reflect.DeepEqual(got.Options, tt.options) {
+				t.Errorf("options = %q, want %q", got.Options, tt.options)
+			}
+			if tt.prompts != nil && !reflect.DeepEqual(got.Prompts, tt.prompts) {
+				t.Errorf("prompts = %q, want %q", got.Prompts, tt.prompts)
+			}
+			if tt.key != nil && !reflect.DeepEqual(AnswerKey(got), tt.key) {
+				t.Errorf("answer key = %q, want %q", AnswerKey(got), tt.key)
+			}
+			if len(got.Pairs) > 0 || len(got.Items) > 0 {
+				t.Errorf("pairs and items should be converted, got %+v", got)
+			}
+			if got.Tolerance < 0 {
+				t.Errorf("tolerance = %v, want it non-negative", got.Tolerance)
+			}
+
+			again := NormalizeQuestions([]models.Question{got})[0]
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("not idempotent: %+v became %+v", got, again)
+			}
+		})
+	}
+}
+
+func TestNormalizeQuestionsScramblesOrdering(t *testing.T) {
+	items := []string{"Satu", "Dua", "Tiga", "Empat"}
+	got := NormalizeQuestions([]models.Question{{Type: models.QuestionOrdering, Question: "Urutkan", Items: items}})[0]
+
+	if reflect.DeepEqual(got.Options, items) {
+		t.Errorf("options %q give the answer away", got.Options)
+	}
+
+	// The key resolves back to the items in their original order
+	for i, id := range got.CorrectAnswers {
+		if option := got.Options[id[0]-'A']; option != items[i] {
+			t.Errorf("position %d = %q, want %q", i, option, items[i])
+		}
+	}
+}
+
+func TestGradeQuestion(t *testing.T) {
+	questions := NormalizeQuestions([]models.Question{
+		{ID: 1, Type: models.QuestionMultiSelect, Options: []string{"Merah", "Hijau", "Biru", "Kuning"}, CorrectAnswers: []string{"A", "C"}},
+		{ID: 2, Type: models.QuestionFillBlank, CorrectAnswer: "Fotosintesis", AcceptedAnswers: []string{"photosynthesis"}},
+		{ID: 3, Type: models.QuestionMatching, Prompts: []string{"Jakarta", "Tokyo", "Bangkok"}, Options: []string{"Jepang", "Thailand", "Indonesia"}, CorrectAnswers: []string{"C", "A", "B"}},
+		{ID: 4, Type: models.QuestionOrdering, Options: []string{"Dua", "Satu", "Tiga"}, CorrectAnswers: []string{"B", "A", "C"}},
+		{ID: 5, Type: models.QuestionNumeric, CorrectAnswer: "9.8", Tolerance: 0.05},
+		{ID: 6, Type: models.QuestionShortAnswer, CorrectAnswer: "Soekarno"},
+	})
+	multiSelect, fillBlank, matching, ordering, numeric, shortAnswer :=
+		questions[0], questions[1], questions[2], questions[3], questions[4], questions[5]
+
+	tests := []struct {
+		name     string
+		question models.Question
+		answer   models.Answer
+		credit   float64
+	}{
+		{name: "multi select exact", question: multiSelect, answer: models.Answer{"C", "A"}, credit: 1},
+		{name: "multi select as comma list", question: multiSelect, answer: models.Answer{"a, Biru"}, credit: 1},
+		{name: "multi select half", question: multiSelect, answer: models.Answer{"A"}, credit: 0.5},
+		{name: "multi select wrong pick cancels a right one", question: multiSelect, answer: models.Answer{"A", "C", "D"}, credit: 0.5},
+		{name: "multi select everything", question: multiSelect, answer: models.Answer{"A", "B", "C", "D"}, credit: 0},
+		{name: "multi select nothing", question: multiSelect, answer: nil, credit: 0},
+
+		{name: "fill blank exact", question: fillBlank, answer: models.Answer{"Fotosintesis"}, credit: 1},
+		{name: "fill blank case and punctuation", question: fillBlank, answer: models.Answer{"  fotosintesis. "}, credit: 1},
+		{name: "fill blank accepted variant", question: fillBlank, answer: models.Answer{"Photosynthesis"}, credit: 1},
+		{name: "fill blank wrong", question: fillBlank, answer: models.Answer{"respirasi"}, credit: 0},
+		{name: "short answer spacing", question: shortAnswer, answer: models.Answer{"soekarno"}, credit: 1},
+
+		{name: "matching all", question: matching, answer: models.Answer{"Indonesia", "Jepang", "Thailand"}, credit: 1},
+		{name: "matching by letter", question: matching, answer: models.Answer{"c", "a", "b"}, credit: 1},
+		{name: "matching partial", question: matching, answer: models.Answer{"C", "B", "A"}, credit: 1.0 / 3},
+		{name: "matching short list", question: matching, answer: models.Answer{"C"}, credit: 1.0 / 3},
+
+		{name: "ordering correct", question: ordering, answer: models.Answer{"Satu", "Dua", "Tiga"}, credit: 1},
+		{name: "ordering by letter", question: ordering, answer: models.Answer{"B", "A", "C"}, credit: 1},
+		{name: "ordering wrong", question: ordering, answer: models.Answer{"A", "B", "C"}, credit: 0},
+		{name: "ordering incomplete", question: ordering, answer: models.Answer{"B", "A"}, credit: 0},
+
+		{name: "numeric exact", question: numeric, answer: models.Answer{"9.8"}, credit: 1},
+		{name: "numeric within tolerance", question: numeric, answer: models.Answer{"9,85"}, credit: 1},
+		{name: "numeric outside tolerance", question: numeric, answer: models.Answer{"9.9"}, credit: 0},
+		{name: "numeric not a number", question: numeric, answer: models.Answer{"sembilan"}, credit: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GradeQuestion(tt.question, NormalizeAnswer(tt.question, tt.answer))
+			if diff := got - tt.credit; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("credit = %v, want %v", got, tt.credit)
+			}
+		})
+	}
+}
+
+func TestGradeQuizPartialCredit(t *testing.T) {
+	questions := NormalizeQuestions([]models.Question{
+		{ID: 1, Type: models.QuestionMultiSelect, Options: []string{"Merah", "Hijau", "Biru"}, CorrectAnswers: []string{"A", "B"}},
+		multipleChoice(2, "A", "Satu", "Dua"),
+	})
+
+	got := GradeQuiz(questions, map[string]models.Answer{"1": {"A"}, "2": {"A"}}, 75)
+	if got.Correct != 1 || got.Points != 1.5 || got.Score != 75 || !got.Passed {
+		t.Errorf("got correct=%d points=%v score=%d passed=%v, want correct=1 points=1.5 score=75 passed=true",
+			got.Correct, got.Points, got.Score, got.Passed)
+	}
+	if got.Results[0].Credit != 0.5 || got.Results[0].Correct {
+		t.Errorf("multi select result = %+v, want half credit and not correct", got.Results[0])
+	}
+}
+
+func TestGradeQuizEssays(t *testing.T) {
+	essay := models.Question{
+		ID:       1,
+		Type:     models.QuestionEssay,
+		Question: "Jelaskan fotosintesis",
+		Rubric: []models.RubricCriterion{
+			{Criterion: "Konsep", Points: 6},
+			{Criterion: "Contoh", Points: 4},
+		},
+	}
+	questions := NormalizeQuestions([]models.Question{essay, multipleChoice(2, "A", "Satu", "Dua")})
+
+	got := GradeQuiz(questions, answers("1", "Tumbuhan membuat makanan dari cahaya", "2", "A"), 50)
+	if got.Pending != 1 || !got.Results[0].Pending || got.Passed {
+		t.Fatalf("got pending=%d passed=%v, want one pending essay and not passed", got.Pending, got.Passed)
+	}
+
+	ApplyEssayScores(&got.Results[0], questions[0], []models.CriterionScore{
+		{Criterion: " konsep ", Points: 9, Feedback: "Tepat"},
+		{Criterion: "Lainnya", Points: 3},
+	}, "Bagus")
+	if got.Results[0].Pending || got.Results[0].Credit != 0.6 || got.Results[0].Feedback != "Bagus" {
+		t.Errorf("essay result = %+v, want graded with credit 0.6", got.Results[0])
+	}
+	if c := got.Results[0].Criteria; len(c) != 2 || c[0].Points != 6 || c[0].MaxPoints != 6 || c[1].Points != 0 {
+		t.Errorf("criteria = %+v, want Konsep clamped to 6 and Contoh 0", c)
+	}
+
+	summary := SummarizeGrade(got.Results, 50)
+	if summary.Pending != 0 || summary.Score != 80 || !summary.Passed {
+		t.Errorf("got pending=%d score=%d passed=%v, want pending=0 score=80 passed=true",
+			summary.Pending, summary.Score, summary.Passed)
+	}
+
+	OverrideScore(&got.Results[0], questions[0], 10, "")
+	if !got.Results[0].Correct || !got.Results[0].Overridden || got.Results[0].Feedback != "Bagus" {
+		t.Errorf("overridden result = %+v, want full credit keeping the feedback", got.Results[0])
+	}
+
+	unanswered := GradeQuiz(questions, answers("2", "A"), 50)
+	if unanswered.Pending != 0 || unanswered.Score != 50 {
+		t.Errorf("got pending=%d score=%d, want an unanswered essay graded 0", unanswered.Pending, unanswered.Score)
+	}
+}
+
+func TestShuffleOptions(t *testing.T) {
+	questions := NormalizeQuestions([]models.Question{
+		multipleChoice(1, "C", "Satu", "Dua", "Tiga", "Empat"),
+		{ID: 2, Type: models.QuestionMultiSelect, Options: []string{"Merah", "Hijau", "Biru", "Kuning"}, CorrectAnswers: []string{"A", "C"}},
+		{ID: 3, Type: models.QuestionMatching, Prompts: []string{"Jakarta", "Tokyo", "Bangkok"}, Options: []string{"Jepang", "Thailand", "Indonesia"}, CorrectAnswers: []string{"C", "A", "B"}},
+		{ID: 4, Type: models.QuestionOrdering, Options: []string{"Dua", "Satu", "Tiga"}, CorrectAnswers: []string{"B", "A", "C"}},
+		trueFalse(5, "true"),
+	})
+	// The correct answers written as option texts, which survive shuffling
+	byText := []models.Answer{
+		{"Tiga"},
+		{"Merah", "Biru"},
+		{"Indonesia", "Jepang", "Thailand"},
+		{"Satu", "Dua", "Tiga"},
+		{"true"},
+	}
+
+	for seed := int64(1); seed <= 20; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		for i, question := range questions {
+			shuffled := ShuffleOptions(question, random)
+			if credit := GradeQuestion(shuffled, NormalizeAnswer(shuffled, byText[i])); credit != 1 {
+				t.Fatalf("seed %d, question %d: credit = %v with options %v and key %v, want 1",
+					seed, question.ID, credit, shuffled.Options, AnswerKey(shuffled))
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(questions[0].Options, []string{"Satu", "Dua", "Tiga", "Empat"}) {
+		t.Errorf("original options changed to %v", questions[0].Options)
+	}
+}
+
+func TestAssembleQuiz(t *testing.T) {
+	pool := NormalizeQuestions([]models.Question{
+		multipleChoice(1, "A", "Satu", "Dua", "Tiga"),
+		multipleChoice(2, "B", "Satu", "Dua", "Tiga"),
+		multipleChoice(3, "C", "Satu", "Dua", "Tiga"),
+		trueFalse(4, "true"),
+		trueFalse(5, "false"),
+	})
+
+	first := AssembleQuiz(pool, 3, 42)
+	if len(first) != 3 {
+		t.Fatalf("assembled %d questions, want 3", len(first))
+	}
+	for i, question := range first {
+		if question.ID != i+1 {
+			t.Errorf("question %d has ID %d, want %d", i, question.ID, i+1)
+		}
+	}
+
+	if again := AssembleQuiz(pool, 3, 42); !reflect.DeepEqual(first, again) {
+		t.Errorf("the same seed assembled %+v, then %+v", first, again)
+	}
+
+	if all := AssembleQuiz(pool, 0, 7); len(all) != len(pool) {
+		t.Errorf("count 0 assembled %d questions, want all %d", len(all), len(pool))
+	}
+	if all := AssembleQuiz(pool, 10, 7); len(all) != len(pool) {
+		t.Errorf("count above the pool assembled %d questions, want %d", len(all), len(pool))
+	}
+}
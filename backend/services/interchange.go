@@ -0,0 +1,285 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"quicacademy-backend/models"
+)
+
+// Question interchange formats
+const (
+	InterchangeMoodle = "moodle" // Moodle XML
+	InterchangeGIFT   = "gift"   // Moodle's GIFT text format
+	InterchangeQTI    = "qti"    // IMS QTI 2.1 content package
+)
+
+// Limits of imported questions
+const (
+	maxImportedQuestionLength = 5000
+	maxImportedOptions        = 26 // options are identified by a letter
+)
+
+// defaultImportDifficulty is the difficulty of imported questions that don't
+// state one
+const defaultImportDifficulty = "medium"
+
+// ImportError is why one item of an imported file was not imported. Item is
+// its position in the file, counting from 1, and Name its name when it has one.
+type ImportError struct {
+	Item  int    `json:"item"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// importedItem is a question read from an interchange file, before it is
+// normalized and validated
+type importedItem struct {
+	Name     string
+	Question models.Question
+	Err      error
+}
+
+// errSkipItem marks items that are not questions, such as Moodle categories,
+// and are left out without an error
+var errSkipItem = errors.New("not a question")
+
+// ExportQuestions writes questions in an interchange format under title.
+// It returns the IDs of the questions the format cannot represent, which are
+// left out.
+func ExportQuestions(format, title string, questions []models.Question) ([]byte, []int, error) {
+	switch format {
+	case InterchangeMoodle:
+		return MoodleXML(title, questions)
+	case InterchangeGIFT:
+		data, skipped := GIFT(title, questions)
+		return data, skipped, nil
+	case InterchangeQTI:
+		return QTIPackage(title, questions)
+	}
+	return nil, nil, fmt.Errorf("unknown format %q", format)
+}
+
+// ImportQuestions reads the questions of an interchange file. Items that
+// can't be imported are reported with why; the error is for files that
+// can't be read at all.
+func ImportQuestions(format string, data []byte) ([]models.Question, []ImportError, error) {
+	var items []importedItem
+	var err error
+	switch format {
+	case InterchangeMoodle:
+		items, err = parseMoodleXML(data)
+	case InterchangeGIFT:
+		items, err = parseGIFT(data)
+	case InterchangeQTI:
+		items, err = parseQTI(data)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	questions := []models.Question{}
+	importErrors := []ImportError{}
+	for i, item := range items {
+		if item.Err == errSkipItem {
+			continue
+		}
+
+		err := item.Err
+		if err == nil {
+			item.Question = normalizeQuestion(item.Question)
+			err = ValidateQuestion(item.Question)
+		}
+		if err != nil {
+			importErrors = append(importErrors, ImportError{Item: i + 1, Name: item.Name, Error: err.Error()})
+			continue
+		}
+
+		if item.Question.Difficulty == "" {
+			item.Question.Difficulty = defaultImportDifficulty
+		}
+		item.Question.ID = len(questions) + 1
+		questions = append(questions, item.Question)
+	}
+
+	return questions, importErrors, nil
+}
+
+// ValidateQuestion checks that a normalized question can be answered and
+// graded: it has a text, the options its type needs and an answer key that
+// refers to them
+func ValidateQuestion(question models.Question) error {
+	if strings.TrimSpace(question.Question) == "" {
+		return errors.New("question text is empty")
+	}
+	if len(question.Question) > maxImportedQuestionLength {
+		return fmt.Errorf("question text is longer than %d characters", maxImportedQuestionLength)
+	}
+
+	options := map[string]bool{}
+	for i, option := range question.Options {
+		if strings.TrimSpace(option) == "" {
+			return fmt.Errorf("option %s is empty", OptionID(i))
+		}
+		options[OptionID(i)] = true
+	}
+
+	needOptions := func(min int) error {
+		if len(question.Options) < min {
+			return fmt.Errorf("%s questions need at least %d options", question.Type, min)
+		}
+		if len(question.Options) > maxImportedOptions {
+			return fmt.Errorf("%s questions can have at most %d options", question.Type, maxImportedOptions)
+		}
+		return nil
+	}
+
+	switch question.Type {
+	case models.QuestionMultipleChoice:
+		if err := needOptions(2); err != nil {
+			return err
+		}
+		if !options[question.CorrectAnswer] {
+			return errors.New("the correct answer is not one of the options")
+		}
+
+	case models.QuestionTrueFalse:
+		if question.CorrectAnswer != "true" && question.CorrectAnswer != "false" {
+			return errors.New("the correct answer must be true or false")
+		}
+
+	case models.QuestionMultiSelect:
+		if err := needOptions(2); err != nil {
+			return err
+		}
+		if len(question.CorrectAnswers) == 0 {
+			return errors.New("no option is marked correct")
+		}
+		for _, answer := range question.CorrectAnswers {
+			if !options[answer] {
+				return errors.New("a correct answer is not one of the options")
+			}
+		}
+
+	case models.QuestionFillBlank, models.QuestionShortAnswer:
+		if question.CorrectAnswer == "" {
+			return errors.New("no accepted answer")
+		}
+
+	case models.QuestionMatching:
+		if len(question.Prompts) < 2 {
+			return errors.New("matching questions need at least 2 pairs")
+		}
+		if err := needOptions(2); err != nil {
+			return err
+		}
+		if len(question.CorrectAnswers) != len(question.Prompts) {
+			return errors.New("every prompt needs a match")
+		}
+		for i, prompt := range question.Prompts {
+			if strings.TrimSpace(prompt) == "" {
+				return fmt.Errorf("prompt %d is empty", i+1)
+			}
+			if !options[question.CorrectAnswers[i]] {
+				return fmt.Errorf("the match of prompt %d is not one of the options", i+1)
+			}
+		}
+
+	case models.QuestionOrdering:
+		if err := needOptions(2); err != nil {
+			return err
+		}
+		if len(question.CorrectAnswers) != len(question.Options) {
+			return errors.New("the correct order must list every item once")
+		}
+		seen := map[string]bool{}
+		for _, answer := range question.CorrectAnswers {
+			if !options[answer] || seen[answer] {
+				return errors.New("the correct order must list every item once")
+			}
+			seen[answer] = true
+		}
+
+	case models.QuestionNumeric:
+		if _, ok := parseNumber(question.CorrectAnswer); !ok {
+			return errors.New("the correct answer is not a number")
+		}
+
+	case models.QuestionEssay:
+
+	default:
+		return fmt.Errorf("unknown question type %q", question.Type)
+	}
+
+	return nil
+}
+
+// optionText is the text of the option of question with ID id, or the ID
+// itself when there's no such option
+func optionText(question models.Question, id string) string {
+	if len(id) == 1 {
+		if i := int(id[0] - 'A'); i >= 0 && i < len(question.Options) {
+			return question.Options[i]
+		}
+	}
+	return id
+}
+
+// questionName is a short name of a question for formats that name each
+// item: its number and the start of its text
+func questionName(question models.Question) string {
+	text := strings.Join(strings.Fields(question.Question), " ")
+	if runes := []rune(text); len(runes) > 50 {
+		text = strings.TrimSpace(string(runes[:50])) + "…"
+	}
+	return fmt.Sprintf("Q%d %s", question.ID, text)
+}
+
+// questionTags are the tags of a question in formats that have them: its
+// concepts and its difficulty
+func questionTags(question models.Question) []string {
+	tags := append([]string{}, question.Concepts...)
+	if len(tags) == 0 && question.Concept != "" {
+		tags = append(tags, question.Concept)
+	}
+	if question.Difficulty != "" {
+		tags = append(tags, difficultyTagPrefix+question.Difficulty)
+	}
+	return tags
+}
+
+const difficultyTagPrefix = "difficulty:"
+
+// applyTags sets the concepts and difficulty of an imported question from
+// its tags, the inverse of questionTags
+func applyTags(question *models.Question, tags []string) {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "":
+		case strings.HasPrefix(tag, difficultyTagPrefix):
+			difficulty := strings.ToLower(strings.TrimPrefix(tag, difficultyTagPrefix))
+			if _, ok := labelDifficulty[difficulty]; ok {
+				question.Difficulty = difficulty
+			}
+		default:
+			question.Concepts = append(question.Concepts, tag)
+		}
+	}
+}
+
+// fillBlankPlaceholder marks the blank in fill_blank questions
+const fillBlankPlaceholder = "___"
+
+// splitBlank splits a fill_blank question around its blank, and returns
+// false when it has none
+func splitBlank(text string) (string, string, bool) {
+	i := strings.Index(text, fillBlankPlaceholder)
+	if i < 0 {
+		return text, "", false
+	}
+	return text[:i], strings.TrimLeft(text[i:], "_"), true
+}
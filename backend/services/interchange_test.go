@@ -0,0 +1,180 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"quicacademy-backend/models"
+)
+
+func interchangeQuestions() []models.Question {
+	questions := []models.Question{
+		{Type: models.QuestionMultipleChoice, Question: "Manakah yang benar: {a} = b: #1 ~ c\\d?", Options: []string{"Jakarta", "Bandung {kota}", "Surabaya"}, CorrectAnswer: "B", Explanation: "Lihat peta: #2", Difficulty: "easy", Concepts: []string{"Geografi"}},
+		{Type: models.QuestionTrueFalse, Question: "Matahari mengelilingi bumi.", CorrectAnswer: "false", Difficulty: "medium"},
+		{Type: models.QuestionMultiSelect, Question: "Pilih bilangan prima.", Options: []string{"2", "4", "5", "9"}, CorrectAnswers: []string{"A", "C"}, Difficulty: "hard", Concepts: []string{"Bilangan prima"}},
+		{Type: models.QuestionShortAnswer, Question: "Proses tumbuhan membuat makanan?\nJawab satu kata.", CorrectAnswer: "fotosintesis", AcceptedAnswers: []string{"photosynthesis"}, Difficulty: "medium"},
+		{Type: models.QuestionFillBlank, Question: "Air mendidih pada ___ derajat Celsius.", CorrectAnswer: "100", Difficulty: "easy"},
+		{Type: models.QuestionNumeric, Question: "Berapa nilai pi?", CorrectAnswer: "3.14", Tolerance: 0.01, Difficulty: "medium"},
+		{Type: models.QuestionMatching, Question: "Pasangkan ibu kota dengan negaranya.", Prompts: []string{"Jakarta", "Tokyo"}, Options: []string{"Jepang", "Indonesia", "Korea"}, CorrectAnswers: []string{"B", "A"}, Difficulty: "medium"},
+		{Type: models.QuestionEssay, Question: "Jelaskan siklus air.", ModelAnswer: "Penguapan, kondensasi, presipitasi.", Difficulty: "hard"},
+		{Type: models.QuestionOrdering, Question: "Urutkan dari kecil ke besar.", Options: []string{"3", "1", "2"}, CorrectAnswers: []string{"B", "C", "A"}, Difficulty: "medium"},
+	}
+	for i := range questions {
+		questions[i].ID = i + 1
+		questions[i] = normalizeQuestion(questions[i])
+	}
+	return questions
+}
+
+// interchangeKey is what a question must keep through an export and import:
+// matching answers are compared by text since importers number options in
+// the order they meet them
+func interchangeKey(question models.Question) models.Question {
+	key := models.Question{
+		Type:            question.Type,
+		Question:        question.Question,
+		Options:         question.Options,
+		CorrectAnswer:   question.CorrectAnswer,
+		CorrectAnswers:  question.CorrectAnswers,
+		AcceptedAnswers: question.AcceptedAnswers,
+		Tolerance:       question.Tolerance,
+		Prompts:         question.Prompts,
+		Explanation:     question.Explanation,
+		Difficulty:      question.Difficulty,
+		Concepts:        question.Concepts,
+	}
+	if question.Type == models.QuestionMatching {
+		key.CorrectAnswers = nil
+		for _, id := range question.CorrectAnswers {
+			key.CorrectAnswers = append(key.CorrectAnswers, optionText(question, id))
+		}
+		key.Options = append([]string{}, question.Options...)
+		sort.Strings(key.Options)
+	}
+	if question.Type == models.QuestionEssay {
+		key.Options, key.Explanation = nil, ""
+	}
+	return key
+}
+
+func TestQuestionInterchangeRoundTrip(t *testing.T) {
+	questions := interchangeQuestions()
+
+	for _, format := range []string{InterchangeMoodle, InterchangeGIFT, InterchangeQTI} {
+		data, skipped, err := ExportQuestions(format, "Biologi/Kelas 7", questions)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		wantSkipped := []int{9}
+		if format == InterchangeQTI {
+			wantSkipped = []int{}
+		}
+		if !reflect.DeepEqual(skipped, wantSkipped) {
+			t.Errorf("%s: skipped %v, want %v", format, skipped, wantSkipped)
+		}
+
+		imported, importErrors, err := ImportQuestions(format, data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(importErrors) > 0 {
+			t.Errorf("%s: import errors %+v", format, importErrors)
+		}
+		if len(imported) != len(questions)-len(wantSkipped) {
+			t.Fatalf("%s: imported %d questions", format, len(imported))
+		}
+
+		for i, question := range imported {
+			if question.ID != i+1 {
+				t.Errorf("%s: question %d has ID %d", format, i+1, question.ID)
+			}
+			if got, want := interchangeKey(question), interchangeKey(questions[i]); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: question %d is\n%+v\nwant\n%+v", format, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestQTIPackageManifest(t *testing.T) {
+	data, _, err := QTIPackage("Biologi", interchangeQuestions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, file := range archive.File {
+		names[file.Name] = true
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		if err := xml.Unmarshal(content, new(interface{})); err != nil {
+			t.Errorf("%s is not well formed: %v", file.Name, err)
+		}
+	}
+	for _, name := range []string{qtiManifest, qtiTest, "items/item-1.xml", "items/item-9.xml"} {
+		if !names[name] {
+			t.Errorf("the package has no %s", name)
+		}
+	}
+}
+
+func TestImportQuestionErrors(t *testing.T) {
+	gift := "// [tag:Sel]\n::Q1::Sel terkecil? {=sel ~atom}\n\n::Q2::Tanpa jawaban\n\n::Q3::Pilih {~a ~b}\n\n::Q4::Benar? {T}\n"
+	questions, importErrors, err := ImportQuestions(InterchangeGIFT, []byte(gift))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 2 || questions[0].Concepts[0] != "Sel" || questions[1].ID != 2 {
+		t.Errorf("imported %+v", questions)
+	}
+	if len(importErrors) != 2 || importErrors[0].Item != 2 || importErrors[0].Name != "Q2" || importErrors[1].Item != 3 {
+		t.Errorf("import errors are %+v", importErrors)
+	}
+
+	moodle := `<quiz>
+  <question type="category"><category><text>$course$/top</text></category></question>
+  <question type="multichoice"><name><text>Tanpa kunci</text></name><questiontext format="html"><text>Pilih</text></questiontext>
+    <answer fraction="0"><text>a</text></answer><answer fraction="0"><text>b</text></answer></question>
+  <question type="calculated"><name><text>Rumus</text></name><questiontext><text>Hitung</text></questiontext></question>
+  <question type="truefalse"><questiontext><text>Bumi bulat</text></questiontext>
+    <answer fraction="100"><text>true</text></answer><answer fraction="0"><text>false</text></answer></question>
+</quiz>`
+	questions, importErrors, err = ImportQuestions(InterchangeMoodle, []byte(moodle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 1 || questions[0].Type != models.QuestionTrueFalse || questions[0].CorrectAnswer != "true" {
+		t.Errorf("imported %+v", questions)
+	}
+	if len(importErrors) != 2 || importErrors[0].Item != 2 || importErrors[1].Item != 3 || importErrors[1].Name != "Rumus" {
+		t.Errorf("import errors are %+v", importErrors)
+	}
+
+	qti := `<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="x" title="Dua">
+  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="string"/>
+  <itemBody><p>A <textEntryInteraction responseIdentifier="RESPONSE"/> B <textEntryInteraction responseIdentifier="R2"/></p></itemBody>
+</assessmentItem>`
+	_, importErrors, err = ImportQuestions(InterchangeQTI, []byte(qti))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(importErrors) != 1 || importErrors[0].Name != "Dua" {
+		t.Errorf("import errors are %+v", importErrors)
+	}
+
+	if _, _, err := ImportQuestions(InterchangeMoodle, []byte("not xml")); err == nil {
+		t.Error("a file that is not Moodle XML was read")
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"quicacademy-backend/models"
+)
+
+// ItemParams are the two-parameter logistic (2PL) parameters of a question:
+// the ability at which a student has even odds of answering it correctly, and
+// how sharply it separates abilities around that point. Rasch items have a
+// discrimination of 1.
+type ItemParams struct {
+	Difficulty     float64 `json:"difficulty"`
+	Discrimination float64 `json:"discrimination"`
+}
+
+// ItemResponse is the credit a student earned on an item, 0-1
+type ItemResponse struct {
+	Item   ItemParams
+	Credit float64
+}
+
+// CalibrationResponse is the credit one person earned on one item, both
+// given as indexes
+type CalibrationResponse struct {
+	Person int
+	Item   int
+	Credit float64
+}
+
+// IRT estimation settings
+const (
+	// MinResponsesFor2PL is how many responses an item needs before its
+	// discrimination is estimated; until then it is a Rasch item
+	MinResponsesFor2PL = 30
+
+	abilityMin  = -4.0
+	abilityMax  = 4.0
+	abilityStep = 0.05
+
+	nextItemChoices = 3
+
+	calibrationRounds = 30
+	newtonSteps       = 5
+	quadratureStep    = 0.2
+
+	difficultyPriorVariance     = 1.0
+	discriminationPriorVariance = 0.25
+	minDiscrimination           = 0.25
+	maxDiscrimination           = 3.0
+)
+
+// labelDifficulty places the generator's difficulty labels on the ability scale
+var labelDifficulty = map[string]float64{
+	"easy":   -1,
+	"medium": 0,
+	"hard":   1,
+}
+
+// PriorItemParams are the parameters assumed for a question that hasn't been
+// calibrated yet, from its difficulty label
+func PriorItemParams(question models.Question) ItemParams {
+	return ItemParams{
+		Difficulty:     labelDifficulty[strings.ToLower(strings.TrimSpace(question.Difficulty))],
+		Discrimination: 1,
+	}
+}
+
+// Probability is the chance that a student of ability theta answers item
+// correctly
+func Probability(theta float64, item ItemParams) float64 {
+	p := 1 / (1 + math.Exp(-item.Discrimination*(theta-item.Difficulty)))
+	// Keep logarithms of p and 1-p finite
+	return math.Min(math.Max(p, 1e-9), 1-1e-9)
+}
+
+// Information is the Fisher information item gives about an ability of theta
+func Information(theta float64, item ItemParams) float64 {
+	p := Probability(theta, item)
+	return item.Discrimination * item.Discrimination * p * (1 - p)
+}
+
+// EstimateAbility returns the expected a posteriori ability given responses,
+// under a standard normal prior, and the posterior standard deviation as its
+// standard error. Without responses that is the prior itself: 0 and 1.
+// Partial credit counts as a fractional correct answer.
+func EstimateAbility(responses []ItemResponse) (theta, standardError float64) {
+	var grid, logPosterior []float64
+	maxLog := math.Inf(-1)
+	for x := abilityMin; x <= abilityMax+abilityStep/2; x += abilityStep {
+		logP := -x * x / 2
+		for _, response := range responses {
+			p := Probability(x, response.Item)
+			logP += response.Credit*math.Log(p) + (1-response.Credit)*math.Log(1-p)
+		}
+		grid = append(grid, x)
+		logPosterior = append(logPosterior, logP)
+		maxLog = math.Max(maxLog, logP)
+	}
+
+	// Scale by the largest term so long response patterns don't underflow
+	var total, mean float64
+	weights := make([]float64, len(grid))
+	for i, logP := range logPosterior {
+		weights[i] = math.Exp(logP - maxLog)
+		total += weights[i]
+		mean += weights[i] * grid[i]
+	}
+	mean /= total
+
+	var variance float64
+	for i, x := range grid {
+		variance += weights[i] * (x - mean) * (x - mean)
+	}
+
+	return mean, math.Sqrt(variance / total)
+}
+
+// NextItem picks the item to ask a student of ability theta next: one of the
+// nextItemChoices candidates that tell the most about that ability, chosen at
+// random so that not every student sees the same items. It returns -1 when
+// there are no candidates.
+func NextItem(theta float64, candidates []ItemParams, random *rand.Rand) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+
+	ranked := make([]int, len(candidates))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return Information(theta, candidates[ranked[i]]) > Information(theta, candidates[ranked[j]])
+	})
+
+	choices := nextItemChoices
+	if choices > len(ranked) {
+		choices = len(ranked)
+	}
+	return ranked[random.Intn(choices)]
+}
+
+// ExpectedScore is the percentage of items a student of ability theta is
+// expected to answer correctly, 0-100
+func ExpectedScore(theta float64, items []ItemParams) int {
+	if len(items) == 0 {
+		return 0
+	}
+	var expected float64
+	for _, item := range items {
+		expected += Probability(theta, item)
+	}
+	return int(math.Floor(expected * 100 / float64(len(items))))
+}
+
+// Calibrate estimates item parameters from responses by marginal maximum
+// likelihood: abilities are integrated over a standard normal population with
+// EM, starting from priors (one per item). Each item estimate is shrunk
+// towards its prior, so items with few responses stay close to it. Items are
+// fitted as Rasch items until they have MinResponsesFor2PL responses, then
+// as 2PL items.
+func Calibrate(priors []ItemParams, responses []CalibrationResponse, persons int) []ItemParams {
+	items := make([]ItemParams, len(priors))
+	copy(items, priors)
+
+	byPerson := make([][]CalibrationResponse, persons)
+	counts := make([]int, len(items))
+	for _, response := range responses {
+		byPerson[response.Person] = append(byPerson[response.Person], response)
+		counts[response.Item]++
+	}
+
+	var nodes, population []float64
+	for x := abilityMin; x <= abilityMax+quadratureStep/2; x += quadratureStep {
+		nodes = append(nodes, x)
+		population = append(population, -x*x/2)
+	}
+
+	for round := 0; round < calibrationRounds; round++ {
+		// E step: expected responses and correct answers per item at each
+		// ability node
+		expected := make([][]float64, len(items))
+		correct := make([][]float64, len(items))
+		for i := range items {
+			expected[i] = make([]float64, len(nodes))
+			correct[i] = make([]float64, len(nodes))
+		}
+
+		for _, answered := range byPerson {
+			if len(answered) == 0 {
+				continue
+			}
+
+			posterior := make([]float64, len(nodes))
+			maxLog := math.Inf(-1)
+			for k, x := range nodes {
+				logP := population[k]
+				for _, response := range answered {
+					p := Probability(x, items[response.Item])
+					logP += response.Credit*math.Log(p) + (1-response.Credit)*math.Log(1-p)
+				}
+				posterior[k] = logP
+				maxLog = math.Max(maxLog, logP)
+			}
+
+			total := 0.0
+			for k := range posterior {
+				posterior[k] = math.Exp(posterior[k] - maxLog)
+				total += posterior[k]
+			}
+
+			for _, response := range answered {
+				for k := range nodes {
+					weight := posterior[k] / total
+					expected[response.Item][k] += weight
+					correct[response.Item][k] += weight * response.Credit
+				}
+			}
+		}
+
+		// M step
+		for i := range items {
+			if counts[i] > 0 {
+				items[i] = fitItem(items[i], priors[i], nodes, expected[i], correct[i], counts[i] >= MinResponsesFor2PL)
+			}
+		}
+	}
+
+	return items
+}
+
+// fitItem takes Newton steps on an item's penalized expected log-likelihood,
+// given the expected number of responses and correct answers at each ability
+// node: first for its difficulty, then its discrimination when fitting 2PL
+func fitItem(item, prior ItemParams, nodes, expected, correct []float64, twoParameter bool) ItemParams {
+	for step := 0; step < newtonSteps; step++ {
+		gradient := -(item.Difficulty - prior.Difficulty) / difficultyPriorVariance
+		hessian := -1 / difficultyPriorVariance
+		for k, x := range nodes {
+			p := Probability(x, item)
+			gradient -= item.Discrimination * (correct[k] - expected[k]*p)
+			hessian -= item.Discrimination * item.Discrimination * expected[k] * p * (1 - p)
+		}
+		item.Difficulty = math.Min(math.Max(item.Difficulty-gradient/hessian, abilityMin), abilityMax)
+	}
+
+	if !twoParameter {
+		return item
+	}
+
+	for step := 0; step < newtonSteps; step++ {
+		gradient := -(item.Discrimination - prior.Discrimination) / discriminationPriorVariance
+		hessian := -1 / discriminationPriorVariance
+		for k, x := range nodes {
+			distance := x - item.Difficulty
+			p := Probability(x, item)
+			gradient += distance * (correct[k] - expected[k]*p)
+			hessian -= distance * distance * expected[k] * p * (1 - p)
+		}
+		item.Discrimination = math.Min(math.Max(item.Discrimination-gradient/hessian, minDiscrimination), maxDiscrimination)
+	}
+
+	return item
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEstimateAbility(t *testing.T) {
+	if theta, se := EstimateAbility(nil); math.Abs(theta) > 1e-6 || math.Abs(se-1) > 0.01 {
+		t.Errorf("without responses got %.3f ± %.3f, want the prior 0 ± 1", theta, se)
+	}
+
+	items := []ItemParams{{-1, 1}, {0, 1}, {1, 1}, {2, 1}}
+	var right, wrong []ItemResponse
+	for _, item := range items {
+		right = append(right, ItemResponse{Item: item, Credit: 1})
+		wrong = append(wrong, ItemResponse{Item: item, Credit: 0})
+	}
+
+	high, highSE := EstimateAbility(right)
+	low, _ := EstimateAbility(wrong)
+	if high <= 0 || low >= 0 {
+		t.Errorf("all right estimated %.3f and all wrong %.3f, want positive and negative", high, low)
+	}
+	if highSE >= 1 {
+		t.Errorf("standard error after 4 responses is %.3f, want below the prior's 1", highSE)
+	}
+}
+
+func TestNextItem(t *testing.T) {
+	candidates := []ItemParams{{-3, 1}, {0, 1}, {3, 1}, {0.2, 1}, {-0.2, 1}, {2.5, 1}}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		switch index := NextItem(0, candidates, random); index {
+		case 1, 3, 4:
+		default:
+			t.Fatalf("picked item %d, want one of the 3 closest to the ability", index)
+		}
+	}
+
+	if index := NextItem(0, nil, random); index != -1 {
+		t.Errorf("without candidates picked %d, want -1", index)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	truth := []ItemParams{{-1.5, 1}, {-0.5, 1.5}, {0.5, 0.8}, {1.5, 1.2}}
+	priors := make([]ItemParams, len(truth))
+	for i := range priors {
+		priors[i] = ItemParams{Difficulty: 0, Discrimination: 1}
+	}
+
+	// Simulate 500 students of normally distributed ability
+	random := rand.New(rand.NewSource(3))
+	var responses []CalibrationResponse
+	persons := 500
+	for person := 0; person < persons; person++ {
+		theta := random.NormFloat64()
+		for item, params := range truth {
+			credit := 0.0
+			if random.Float64() < Probability(theta, params) {
+				credit = 1
+			}
+			responses = append(responses, CalibrationResponse{Person: person, Item: item, Credit: credit})
+		}
+	}
+
+	items := Calibrate(priors, responses, persons)
+	for i, item := range items {
+		if math.Abs(item.Difficulty-truth[i].Difficulty) > 0.35 {
+			t.Errorf("item %d difficulty is %.2f, want about %.2f", i, item.Difficulty, truth[i].Difficulty)
+		}
+	}
+	if items[0].Difficulty >= items[3].Difficulty {
+		t.Errorf("easiest item calibrated at %.2f, hardest at %.2f", items[0].Difficulty, items[3].Difficulty)
+	}
+
+	// Items without responses keep their prior
+	untouched := Calibrate([]ItemParams{{1, 1}}, nil, 0)
+	if untouched[0] != (ItemParams{1, 1}) {
+		t.Errorf("item without responses calibrated to %+v", untouched[0])
+	}
+}
+
+func TestExpectedScore(t *testing.T) {
+	items := []ItemParams{{0, 1}, {0, 1}}
+	if score := ExpectedScore(0, items); score != 50 {
+		t.Errorf("ability at the items' difficulty scored %d, want 50", score)
+	}
+	if ExpectedScore(3, items) <= ExpectedScore(-3, items) {
+		t.Error("a higher ability should score higher")
+	}
+	if score := ExpectedScore(1, nil); score != 0 {
+		t.Errorf("empty bank scored %d, want 0", score)
+	}
+}
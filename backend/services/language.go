@@ -0,0 +1,54 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Supported output languages
+const (
+	LanguageIndonesian = "id"
+	LanguageEnglish    = "en"
+	LanguageBilingual  = "id-en" // Indonesian with an English glossary
+)
+
+var indonesianStopwords = map[string]bool{
+	"yang": true, "dan": true, "di": true, "ini": true, "itu": true, "dengan": true,
+	"untuk": true, "dari": true, "dalam": true, "adalah": true, "pada": true, "tidak": true,
+	"akan": true, "ke": true, "juga": true, "atau": true, "oleh": true, "sebagai": true,
+	"karena": true, "dapat": true, "merupakan": true, "tersebut": true, "bahwa": true,
+}
+
+var englishStopwords = map[string]bool{
+	"the": true, "and": true, "of": true, "to": true, "is": true, "in": true,
+	"that": true, "it": true, "for": true, "with": true, "as": true, "are": true,
+	"this": true, "be": true, "by": true, "on": true, "from": true, "which": true,
+	"was": true, "or": true, "an": true, "not": true, "can": true,
+}
+
+// DetectLanguage guesses whether text is Indonesian or English by counting
+// common stopwords. It returns an empty string when there is nothing to go on.
+func DetectLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	indonesian, english := 0, 0
+	for _, word := range words {
+		if indonesianStopwords[word] {
+			indonesian++
+		}
+		if englishStopwords[word] {
+			english++
+		}
+	}
+
+	switch {
+	case indonesian == 0 && english == 0:
+		return ""
+	case english > indonesian:
+		return LanguageEnglish
+	default:
+		return LanguageIndonesian
+	}
+}
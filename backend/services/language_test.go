@@ -0,0 +1,29 @@
+package services
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "indonesian", text: "Fotosintesis adalah proses yang dilakukan oleh tumbuhan untuk membuat makanan.", expected: LanguageIndonesian},
+		{name: "english", text: "Photosynthesis is the process by which plants make food from light and water.", expected: LanguageEnglish},
+		{name: "case and punctuation", text: "THE cell; IS the unit OF life.", expected: LanguageEnglish},
+		{name: "tie goes to indonesian", text: "the dan", expected: LanguageIndonesian},
+		{name: "mostly indonesian with english terms", text: "Sel adalah unit terkecil dari makhluk hidup dan disebut the building block.", expected: LanguageIndonesian},
+		{name: "words glued by digits", text: "the2and3of", expected: LanguageEnglish},
+		{name: "no stopwords", text: "Fotosintesis klorofil stomata", expected: ""},
+		{name: "empty", text: "", expected: ""},
+		{name: "only numbers", text: "1 2 3 4.5", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectLanguage(tt.text); got != tt.expected {
+				t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.expected)
+			}
+		})
+	}
+}
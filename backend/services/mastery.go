@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"quicacademy-backend/models"
+)
+
+// BKTParams are the parameters of Bayesian knowledge tracing: the chance a
+// concept is known before practicing it, of learning it on each practice
+// opportunity, of guessing right without knowing it and of slipping up
+// while knowing it
+type BKTParams struct {
+	Init  float64
+	Learn float64
+	Guess float64
+	Slip  float64
+}
+
+// DefaultBKT is used for every concept, there isn't enough data per concept
+// to fit parameters
+var DefaultBKT = BKTParams{Init: 0.3, Learn: 0.15, Guess: 0.2, Slip: 0.1}
+
+// Mastery levels of a concept
+const (
+	MasteryNotStarted  = "not_started"
+	MasteryNeedsReview = "needs_review"
+	MasteryLearning    = "learning"
+	MasteryMastered    = "mastered"
+)
+
+// Mastery estimates from which a concept counts as learned or mastered
+const (
+	learningThreshold = 0.6
+	masteryThreshold  = 0.95
+)
+
+// Update returns the chance the concept is known after an answer earning
+// credit (0-1) given a prior chance of mastery. Partial credit mixes the
+// updates for a right and a wrong answer.
+func (p BKTParams) Update(mastery, credit float64) float64 {
+	right := mastery * (1 - p.Slip) / (mastery*(1-p.Slip) + (1-mastery)*p.Guess)
+	wrong := mastery * p.Slip / (mastery*p.Slip + (1-mastery)*(1-p.Guess))
+	known := credit*right + (1-credit)*wrong
+	return known + (1-known)*p.Learn
+}
+
+// Trace runs Update over credits in the order they were earned, starting
+// from Init
+func (p BKTParams) Trace(credits []float64) float64 {
+	mastery := p.Init
+	for _, credit := range credits {
+		mastery = p.Update(mastery, credit)
+	}
+	return mastery
+}
+
+// MasteryLevel classifies a mastery estimate based on responses answers
+func MasteryLevel(mastery float64, responses int) string {
+	switch {
+	case responses == 0:
+		return MasteryNotStarted
+	case mastery >= masteryThreshold:
+		return MasteryMastered
+	case mastery >= learningThreshold:
+		return MasteryLearning
+	default:
+		return MasteryNeedsReview
+	}
+}
+
+// QuestionConcepts are the concepts a question tests: its Concepts, or its
+// Concept for questions tagged before concept lists
+func QuestionConcepts(question models.Question) []string {
+	if len(question.Concepts) > 0 {
+		return question.Concepts
+	}
+	if question.Concept != "" {
+		return []string{question.Concept}
+	}
+	return nil
+}
+
+// conceptPrefix matches list markers and emphasis before a concept name
+var conceptPrefix = regexp.MustCompile(`^(?:[-•*]|\d+[.)])\s*|\*\*|__`)
+
+// maxConceptLength keeps a concept name within its column
+const maxConceptLength = 200
+
+// ParseConcepts extracts the concept names from the concepts section of a
+// summary: a JSON array of objects with a title, or one concept per line
+// written as "Name: explanation" or "Name - explanation"
+func ParseConcepts(concepts string) []string {
+	names := []string{}
+	for _, entry := range conceptEntries(concepts) {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+// conceptEntry is a concept of a summary with its explanation
+type conceptEntry struct {
+	Name        string
+	Explanation string
+}
+
+// conceptEntries parses the concepts section of a summary as ParseConcepts
+// does, keeping the explanation of each concept
+func conceptEntries(concepts string) []conceptEntry {
+	var items []struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	var entries []conceptEntry
+	if err := json.Unmarshal([]byte(concepts), &items); err == nil {
+		for _, item := range items {
+			entries = append(entries, conceptEntry{Name: item.Title, Explanation: item.Description})
+		}
+	} else {
+		for _, line := range strings.Split(concepts, "\n") {
+			line = conceptPrefix.ReplaceAllString(strings.TrimSpace(line), "")
+			entry := conceptEntry{Name: line}
+			if i := strings.Index(line, ":"); i >= 0 {
+				entry = conceptEntry{Name: line[:i], Explanation: line[i+1:]}
+			} else if i := strings.Index(line, " - "); i >= 0 {
+				entry = conceptEntry{Name: line[:i], Explanation: line[i+3:]}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	seen := map[string]bool{}
+	parsed := []conceptEntry{}
+	for _, entry := range entries {
+		entry.Name = strings.Trim(strings.TrimSpace(entry.Name), "*_")
+		entry.Explanation = strings.TrimSpace(strings.Trim(strings.TrimSpace(entry.Explanation), "*_"))
+		if entry.Name == "" || len(entry.Name) > maxConceptLength || seen[strings.ToLower(entry.Name)] {
+			continue
+		}
+		seen[strings.ToLower(entry.Name)] = true
+		parsed = append(parsed, entry)
+	}
+	return parsed
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"quicacademy-backend/models"
+)
+
+func TestBKTTrace(t *testing.T) {
+	if mastery := DefaultBKT.Trace(nil); mastery != DefaultBKT.Init {
+		t.Errorf("without answers mastery is %.3f, want the prior %.3f", mastery, DefaultBKT.Init)
+	}
+
+	right := DefaultBKT.Trace([]float64{1, 1, 1})
+	wrong := DefaultBKT.Trace([]float64{0, 0, 0})
+	partial := DefaultBKT.Trace([]float64{0.5, 0.5, 0.5})
+	if !(wrong < partial && partial < right) {
+		t.Errorf("mastery after wrong, partial and right answers is %.3f, %.3f, %.3f", wrong, partial, right)
+	}
+	if level := MasteryLevel(right, 3); level != MasteryMastered {
+		t.Errorf("three right answers are %s, want %s", level, MasteryMastered)
+	}
+	if level := MasteryLevel(wrong, 3); level != MasteryNeedsReview {
+		t.Errorf("three wrong answers are %s, want %s", level, MasteryNeedsReview)
+	}
+	if level := MasteryLevel(DefaultBKT.Init, 0); level != MasteryNotStarted {
+		t.Errorf("no answers are %s, want %s", level, MasteryNotStarted)
+	}
+
+	// A recent mistake weighs more than an old one
+	if recent, old := DefaultBKT.Trace([]float64{1, 1, 0}), DefaultBKT.Trace([]float64{0, 1, 1}); recent >= old {
+		t.Errorf("a recent mistake gave %.3f, an old one %.3f", recent, old)
+	}
+}
+
+func TestParseConcepts(t *testing.T) {
+	tests := []struct {
+		name     string
+		concepts string
+		want     []string
+	}{
+		{"json", `[{"title": "Fotosintesis", "description": "..."}, {"title": "Respirasi"}]`, []string{"Fotosintesis", "Respirasi"}},
+		{"lines", "- **Fotosintesis**: proses membuat makanan\n2. Respirasi - pemecahan glukosa\n\n• Klorofil", []string{"Fotosintesis", "Respirasi", "Klorofil"}},
+		{"duplicates", "Fotosintesis: satu\nfotosintesis: dua", []string{"Fotosintesis"}},
+		{"empty", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseConcepts(tt.concepts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeQuestionsConcepts(t *testing.T) {
+	question := trueFalse(1, "true")
+	question.Concepts = []string{" Respirasi ", "respirasi", "Klorofil"}
+
+	normalized := NormalizeQuestions([]models.Question{question})[0]
+	if normalized.Concept != "Respirasi" || !reflect.DeepEqual(normalized.Concepts, []string{"Respirasi", "Klorofil"}) {
+		t.Errorf("got concept %q and concepts %q", normalized.Concept, normalized.Concepts)
+	}
+
+	question.Concept = "Fotosintesis"
+	question.Concepts = nil
+	if concepts := QuestionConcepts(NormalizeQuestions([]models.Question{question})[0]); !reflect.DeepEqual(concepts, []string{"Fotosintesis"}) {
+		t.Errorf("a question with only a main concept tests %q", concepts)
+	}
+}
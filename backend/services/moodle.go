@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"quicacademy-backend/models"
+)
+
+// Moodle XML question types
+const (
+	moodleCategory    = "category"
+	moodleDescription = "description"
+	moodleMultichoice = "multichoice"
+	moodleTrueFalse   = "truefalse"
+	moodleShortAnswer = "shortanswer"
+	moodleNumerical   = "numerical"
+	moodleMatching    = "matching"
+	moodleEssay       = "essay"
+)
+
+// moodleCategoryPrefix places exported questions under one category in the
+// course's question bank
+const moodleCategoryPrefix = "$course$/top/Quicacademy/"
+
+type moodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []moodleQuestion `xml:"question"`
+}
+
+// moodleText is an element holding its text in a text child, with the
+// format the text is written in
+type moodleText struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type moodleAnswer struct {
+	Fraction  string      `xml:"fraction,attr"`
+	Format    string      `xml:"format,attr,omitempty"`
+	Text      string      `xml:"text"`
+	Feedback  *moodleText `xml:"feedback,omitempty"`
+	Tolerance string      `xml:"tolerance,omitempty"`
+}
+
+type moodleSubquestion struct {
+	Format string     `xml:"format,attr,omitempty"`
+	Text   string     `xml:"text"`
+	Answer moodleText `xml:"answer"`
+}
+
+type moodleQuestion struct {
+	Type               string              `xml:"type,attr"`
+	Category           *moodleText         `xml:"category,omitempty"`
+	Name               *moodleText         `xml:"name,omitempty"`
+	QuestionText       *moodleText         `xml:"questiontext,omitempty"`
+	GeneralFeedback    *moodleText         `xml:"generalfeedback,omitempty"`
+	DefaultGrade       string              `xml:"defaultgrade,omitempty"`
+	Penalty            string              `xml:"penalty,omitempty"`
+	Hidden             string              `xml:"hidden,omitempty"`
+	Single             string              `xml:"single,omitempty"`
+	ShuffleAnswers     string              `xml:"shuffleanswers,omitempty"`
+	AnswerNumbering    string              `xml:"answernumbering,omitempty"`
+	UseCase            string              `xml:"usecase,omitempty"`
+	ResponseFormat     string              `xml:"responseformat,omitempty"`
+	ResponseFieldLines string              `xml:"responsefieldlines,omitempty"`
+	GraderInfo         *moodleText         `xml:"graderinfo,omitempty"`
+	Answers            []moodleAnswer      `xml:"answer"`
+	Subquestions       []moodleSubquestion `xml:"subquestion"`
+	Tags               []moodleText        `xml:"tags>tag"`
+}
+
+// MoodleXML writes questions as a Moodle XML file, in a category named after
+// title. Ordering questions have no core Moodle type; their IDs are returned
+// as skipped.
+func MoodleXML(title string, questions []models.Question) ([]byte, []int, error) {
+	quiz := moodleQuiz{Questions: []moodleQuestion{{
+		Type:     moodleCategory,
+		Category: &moodleText{Text: moodleCategoryPrefix + strings.ReplaceAll(title, "/", "-")},
+	}}}
+
+	skipped := []int{}
+	for _, question := range questions {
+		exported, ok := moodleExport(question)
+		if !ok {
+			skipped = append(skipped, question.ID)
+			continue
+		}
+		quiz.Questions = append(quiz.Questions, exported)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(quiz); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), skipped, nil
+}
+
+func moodleExport(question models.Question) (moodleQuestion, bool) {
+	exported := moodleQuestion{
+		Name:            &moodleText{Text: questionName(question)},
+		QuestionText:    &moodleText{Format: "html", Text: textHTML(question.Question)},
+		GeneralFeedback: &moodleText{Format: "html", Text: textHTML(question.Explanation)},
+		DefaultGrade:    "1",
+		Penalty:         "0.3333333",
+		Hidden:          "0",
+	}
+	for _, tag := range questionTags(question) {
+		exported.Tags = append(exported.Tags, moodleText{Text: tag})
+	}
+
+	answer := func(fraction, text string) moodleAnswer {
+		return moodleAnswer{Fraction: fraction, Format: "html", Text: textHTML(text), Feedback: &moodleText{Format: "html"}}
+	}
+
+	switch question.Type {
+	case models.QuestionMultipleChoice, models.QuestionMultiSelect:
+		exported.Type = moodleMultichoice
+		exported.Single = "true"
+		exported.ShuffleAnswers = "true"
+		exported.AnswerNumbering = "abc"
+
+		correct := map[string]bool{question.CorrectAnswer: true}
+		if question.Type == models.QuestionMultiSelect {
+			exported.Single = "false"
+			correct = map[string]bool{}
+			for _, id := range question.CorrectAnswers {
+				correct[id] = true
+			}
+		}
+
+		// Selecting every option of a multiple answer question must not earn
+		// full marks, so wrong options take off as much as right ones give
+		right, wrong := "100", "0"
+		if question.Type == models.QuestionMultiSelect && len(correct) > 0 {
+			share := moodleFraction(100 / float64(len(correct)))
+			right, wrong = share, "-"+share
+		}
+
+		for i, option := range question.Options {
+			fraction := wrong
+			if correct[OptionID(i)] {
+				fraction = right
+			}
+			exported.Answers = append(exported.Answers, answer(fraction, option))
+		}
+
+	case models.QuestionTrueFalse:
+		exported.Type = moodleTrueFalse
+		for _, value := range []string{"true", "false"} {
+			fraction := "0"
+			if question.CorrectAnswer == value {
+				fraction = "100"
+			}
+			exported.Answers = append(exported.Answers, moodleAnswer{Fraction: fraction, Format: "moodle_auto_format", Text: value, Feedback: &moodleText{Format: "html"}})
+		}
+
+	case models.QuestionShortAnswer, models.QuestionFillBlank:
+		exported.Type = moodleShortAnswer
+		exported.UseCase = "0"
+		for _, accepted := range append([]string{question.CorrectAnswer}, question.AcceptedAnswers...) {
+			exported.Answers = append(exported.Answers, moodleAnswer{Fraction: "100", Format: "moodle_auto_format", Text: accepted, Feedback: &moodleText{Format: "html"}})
+		}
+
+	case models.QuestionNumeric:
+		exported.Type = moodleNumerical
+		exported.Answers = []moodleAnswer{{
+			Fraction:  "100",
+			Format:    "moodle_auto_format",
+			Text:      question.CorrectAnswer,
+			Feedback:  &moodleText{Format: "html"},
+			Tolerance: strconv.FormatFloat(question.Tolerance, 'f', -1, 64),
+		}}
+
+	case models.QuestionMatching:
+		exported.Type = moodleMatching
+		exported.ShuffleAnswers = "true"
+		used := map[string]bool{}
+		for i, prompt := range question.Prompts {
+			match := ""
+			if i < len(question.CorrectAnswers) {
+				match = optionText(question, question.CorrectAnswers[i])
+				used[question.CorrectAnswers[i]] = true
+			}
+			exported.Subquestions = append(exported.Subquestions, moodleSubquestion{
+				Format: "html",
+				Text:   textHTML(prompt),
+				Answer: moodleText{Text: match},
+			})
+		}
+		// Options no prompt matches are distractors, which Moodle writes as
+		// subquestions without a text
+		for i, option := range question.Options {
+			if !used[OptionID(i)] {
+				exported.Subquestions = append(exported.Subquestions, moodleSubquestion{Format: "html", Answer: moodleText{Text: option}})
+			}
+		}
+
+	case models.QuestionEssay:
+		exported.Type = moodleEssay
+		exported.ResponseFormat = "editor"
+		exported.ResponseFieldLines = "15"
+		exported.GraderInfo = &moodleText{Format: "html", Text: textHTML(essayGraderInfo(question))}
+
+	default:
+		return exported, false
+	}
+
+	return exported, true
+}
+
+// moodleFraction formats a grade fraction the way Moodle lists them, with
+// at most 5 decimals
+func moodleFraction(fraction float64) string {
+	return strconv.FormatFloat(float64(int(fraction*100000+0.5))/100000, 'f', -1, 64)
+}
+
+// essayGraderInfo is the model answer and rubric of an essay, for graders
+func essayGraderInfo(question models.Question) string {
+	var lines []string
+	if question.ModelAnswer != "" {
+		lines = append(lines, question.ModelAnswer)
+	}
+	for _, criterion := range question.Rubric {
+		line := fmt.Sprintf("- %s (%d)", criterion.Criterion, criterion.Points)
+		if criterion.Description != "" {
+			line += ": " + criterion.Description
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseMoodleXML reads the questions of a Moodle XML file
+func parseMoodleXML(data []byte) ([]importedItem, error) {
+	var quiz moodleQuiz
+	if err := xml.Unmarshal(data, &quiz); err != nil {
+		return nil, fmt.Errorf("not a Moodle XML file: %v", err)
+	}
+
+	items := make([]importedItem, len(quiz.Questions))
+	for i, imported := range quiz.Questions {
+		item := importedItem{}
+		if imported.Name != nil {
+			item.Name = strings.TrimSpace(imported.Name.Text)
+		}
+		item.Question, item.Err = moodleImport(imported)
+		items[i] = item
+	}
+	return items, nil
+}
+
+func moodleImport(imported moodleQuestion) (models.Question, error) {
+	if imported.Type == moodleCategory || imported.Type == moodleDescription {
+		return models.Question{}, errSkipItem
+	}
+
+	question := models.Question{}
+	if imported.QuestionText != nil {
+		question.Question = moodleFieldText(imported.QuestionText.Format, imported.QuestionText.Text)
+	}
+	if imported.GeneralFeedback != nil {
+		question.Explanation = moodleFieldText(imported.GeneralFeedback.Format, imported.GeneralFeedback.Text)
+	}
+	tags := make([]string, len(imported.Tags))
+	for i, tag := range imported.Tags {
+		tags[i] = tag.Text
+	}
+	applyTags(&question, tags)
+
+	fractions := make([]float64, len(imported.Answers))
+	for i, answer := range imported.Answers {
+		fraction, err := strconv.ParseFloat(strings.TrimSpace(answer.Fraction), 64)
+		if err != nil {
+			return question, fmt.Errorf("answer %d has an invalid fraction %q", i+1, answer.Fraction)
+		}
+		fractions[i] = fraction
+	}
+	answerText := func(i int) string {
+		return moodleFieldText(imported.Answers[i].Format, imported.Answers[i].Text)
+	}
+
+	switch imported.Type {
+	case moodleMultichoice:
+		single := strings.TrimSpace(strings.ToLower(imported.Single))
+		question.Type = models.QuestionMultipleChoice
+		if single == "false" || single == "0" {
+			question.Type = models.QuestionMultiSelect
+		}
+
+		best := -1
+		for i := range imported.Answers {
+			question.Options = append(question.Options, answerText(i))
+			if fractions[i] > 0 {
+				question.CorrectAnswers = append(question.CorrectAnswers, OptionID(i))
+				if best < 0 || fractions[i] > fractions[best] {
+					best = i
+				}
+			}
+		}
+
+		if question.Type == models.QuestionMultipleChoice {
+			if best < 0 {
+				return question, errors.New("no answer has a positive grade")
+			}
+			question.CorrectAnswer = OptionID(best)
+			question.CorrectAnswers = nil
+		}
+
+	case moodleTrueFalse:
+		question.Type = models.QuestionTrueFalse
+		for i := range imported.Answers {
+			if fractions[i] == 100 {
+				question.CorrectAnswer = strings.ToLower(answerText(i))
+			}
+		}
+
+	case moodleShortAnswer:
+		question.Type = models.QuestionShortAnswer
+		if strings.Contains(question.Question, fillBlankPlaceholder) {
+			question.Type = models.QuestionFillBlank
+		}
+		// Only fully correct answers are accepted, partial credit has no
+		// equivalent
+		for i := range imported.Answers {
+			if fractions[i] == 100 {
+				question.AcceptedAnswers = append(question.AcceptedAnswers, answerText(i))
+			}
+		}
+
+	case moodleNumerical:
+		question.Type = models.QuestionNumeric
+		for i, answer := range imported.Answers {
+			if fractions[i] == 100 {
+				question.CorrectAnswer = answerText(i)
+				if answer.Tolerance != "" {
+					tolerance, err := strconv.ParseFloat(strings.TrimSpace(answer.Tolerance), 64)
+					if err != nil {
+						return question, fmt.Errorf("answer %d has an invalid tolerance %q", i+1, answer.Tolerance)
+					}
+					question.Tolerance = tolerance
+				}
+				break
+			}
+		}
+
+	case moodleMatching:
+		question.Type = models.QuestionMatching
+		optionIDs := map[string]string{}
+		for _, sub := range imported.Subquestions {
+			match := strings.TrimSpace(sub.Answer.Text)
+			if _, ok := optionIDs[match]; !ok && match != "" {
+				optionIDs[match] = OptionID(len(question.Options))
+				question.Options = append(question.Options, match)
+			}
+
+			prompt := moodleFieldText(sub.Format, sub.Text)
+			if prompt == "" {
+				continue // a distractor
+			}
+			question.Prompts = append(question.Prompts, prompt)
+			question.CorrectAnswers = append(question.CorrectAnswers, optionIDs[match])
+		}
+
+	case moodleEssay:
+		question.Type = models.QuestionEssay
+		if imported.GraderInfo != nil {
+			question.ModelAnswer = moodleFieldText(imported.GraderInfo.Format, imported.GraderInfo.Text)
+		}
+
+	default:
+		return question, fmt.Errorf("question type %q is not supported", imported.Type)
+	}
+
+	return question, nil
+}
+
+// moodleFieldText is the plain text of a Moodle text field
+func moodleFieldText(format, text string) string {
+	if format == "" || format == "html" {
+		return htmlText(text)
+	}
+	return strings.TrimSpace(text)
+}
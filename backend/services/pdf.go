@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A4 page layout of exported PDFs, in points
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 56
+	pdfTextWidth    = pdfPageWidth - 2*pdfMargin
+	pdfBulletIndent = 16
+)
+
+// pdfFont is one of the standard PDF fonts, which every reader has built in
+// so they need not be embedded
+type pdfFont struct {
+	Resource string
+	BaseFont string
+	Widths   [95]int // glyph widths of the printable ASCII characters, per 1000 points
+}
+
+// Helvetica metrics from the Adobe standard font AFM files
+var (
+	pdfRegular = pdfFont{Resource: "F1", BaseFont: "Helvetica", Widths: [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}}
+	pdfBold = pdfFont{Resource: "F2", BaseFont: "Helvetica-Bold", Widths: [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}}
+)
+
+// winAnsiSpecials are the characters of WinAnsiEncoding outside Latin-1
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// winAnsiText encodes text in WinAnsiEncoding, replacing characters the
+// standard fonts do not have with '?'
+func winAnsiText(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			encoded = append(encoded, ' ')
+		case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+			encoded = append(encoded, byte(r))
+		case winAnsiSpecials[r] != 0:
+			encoded = append(encoded, winAnsiSpecials[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// width is the width of WinAnsi encoded text at size points. Characters
+// outside ASCII are taken as wide as a digit, which is close enough to wrap.
+func (f pdfFont) width(text []byte, size float64) float64 {
+	total := 0
+	for _, b := range text {
+		switch {
+		case b >= 0x20 && b < 0x7F:
+			total += f.Widths[b-0x20]
+		case b == 0x95:
+			total += 350
+		case b == 0x97:
+			total += 1000
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// wrap breaks text into lines no wider than width at size points, breaking
+// words that do not fit a line on their own
+func (f pdfFont) wrap(text string, size, width float64) [][]byte {
+	var lines [][]byte
+	var line []byte
+	for _, word := range strings.Fields(text) {
+		encoded := winAnsiText(word)
+		for f.width(encoded, size) > width {
+			if len(line) > 0 {
+				lines = append(lines, line)
+				line = nil
+			}
+			n := len(encoded) - 1
+			for n > 1 && f.width(encoded[:n], size) > width {
+				n--
+			}
+			lines = append(lines, encoded[:n])
+			encoded = encoded[n:]
+		}
+
+		candidate := append(append(append([]byte{}, line...), ' '), encoded...)
+		if len(line) == 0 {
+			candidate = encoded
+		}
+		if len(line) > 0 && f.width(candidate, size) > width {
+			lines = append(lines, line)
+			candidate = encoded
+		}
+		line = candidate
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfLayout places lines of text onto pages, starting a new page when one
+// is full
+type pdfLayout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (l *pdfLayout) page() *bytes.Buffer {
+	return l.pages[len(l.pages)-1]
+}
+
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// space moves down by points, starting a new page at the bottom margin
+func (l *pdfLayout) space(points float64) {
+	l.y -= points
+	if l.y < pdfMargin {
+		l.newPage()
+	}
+}
+
+// text writes a line of WinAnsi text at x, moving down a line first
+func (l *pdfLayout) text(font pdfFont, size, x float64, line []byte, gray float64) {
+	leading := size * 1.4
+	if l.y-leading < pdfMargin {
+		l.newPage()
+	}
+	l.y -= leading
+	fmt.Fprintf(l.page(), "BT %.2f g /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", gray, font.Resource, size, x, l.y, pdfEscape(line))
+}
+
+// paragraph writes wrapped text indented by indent
+func (l *pdfLayout) paragraph(font pdfFont, size, indent float64, text string, gray float64) {
+	for _, line := range font.wrap(text, size, pdfTextWidth-indent) {
+		l.text(font, size, pdfMargin+indent, line, gray)
+	}
+}
+
+// keepWithNext starts a new page unless lines lines of size points fit on
+// the current one, so headings are not left alone at the bottom of a page
+func (l *pdfLayout) keepWithNext(size float64, lines int) {
+	if l.y-size*1.4*float64(lines) < pdfMargin {
+		l.newPage()
+	}
+}
+
+// bullet writes a bulleted item wrapped under its first line, with an
+// optional bold lead, such as a concept name, on lines of its own
+func (l *pdfLayout) bullet(size float64, lead, text string) {
+	l.keepWithNext(size, 1)
+	fmt.Fprintf(l.page(), "BT 0.00 g /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", pdfRegular.Resource, size, float64(pdfMargin+4), l.y-size*1.4, pdfEscape([]byte{0x95}))
+
+	if lead != "" {
+		l.paragraph(pdfBold, size, pdfBulletIndent, lead, 0)
+	}
+	l.paragraph(pdfRegular, size, pdfBulletIndent, text, 0)
+}
+
+// pdfEscape escapes WinAnsi text for a PDF string literal
+func pdfEscape(text []byte) string {
+	var buf strings.Builder
+	for _, b := range text {
+		switch {
+		case b == '(' || b == ')' || b == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(b)
+		case b < 0x20 || b > 0x7E:
+			fmt.Fprintf(&buf, "\\%03o", b)
+		default:
+			buf.WriteByte(b)
+		}
+	}
+	return buf.String()
+}
+
+// pdfInfoString encodes text for the document information dictionary
+func pdfInfoString(text string) string {
+	return "(" + pdfEscape(winAnsiText(text)) + ")"
+}
+
+// RenderSummaryPDF renders a summary document as an A4 PDF, set in the
+// standard Helvetica fonts
+func RenderSummaryPDF(doc SummaryDocument, now time.Time) []byte {
+	const bodySize = 11
+
+	layout := &pdfLayout{}
+	layout.newPage()
+
+	layout.paragraph(pdfBold, 20, 0, doc.Title, 0)
+	if metadata := doc.Metadata(); metadata != "" {
+		layout.space(2)
+		layout.paragraph(pdfRegular, 9, 0, metadata, 0.4)
+	}
+
+	heading := func(text string) {
+		layout.space(12)
+		layout.keepWithNext(bodySize, 3)
+		layout.paragraph(pdfBold, 14, 0, text, 0)
+		layout.space(4)
+	}
+
+	if len(doc.BulletPoints) > 0 {
+		heading(doc.Labels.BulletPoints)
+		for _, point := range doc.BulletPoints {
+			layout.bullet(bodySize, "", point)
+			layout.space(3)
+		}
+	}
+
+	if len(doc.Paragraphs) > 0 {
+		heading(doc.Labels.Paragraphs)
+		for _, paragraph := range doc.Paragraphs {
+			layout.paragraph(pdfRegular, bodySize, 0, paragraph, 0)
+			layout.space(6)
+		}
+	}
+
+	if len(doc.Concepts) > 0 {
+		heading(doc.Labels.Concepts)
+		for _, concept := range doc.Concepts {
+			layout.bullet(bodySize, concept.Name, concept.Explanation)
+			layout.space(3)
+		}
+	}
+
+	// Objects are numbered: catalog, page tree, the two fonts, the info
+	// dictionary, then a page and its content stream for each page
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	kids := make([]string, len(layout.pages))
+	for i := range layout.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(layout.pages)))
+
+	for _, font := range []pdfFont{pdfRegular, pdfBold} {
+		objects = append(objects, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.BaseFont))
+	}
+
+	objects = append(objects, fmt.Sprintf("<< /Title %s /Producer %s /CreationDate (D:%s) >>",
+		pdfInfoString(doc.Title), pdfInfoString(doc.Labels.Footer), now.UTC().Format("20060102150405Z")))
+
+	for i, page := range layout.pages {
+		footer := winAnsiText(fmt.Sprintf("%s · %d / %d", doc.Labels.Footer, i+1, len(layout.pages)))
+		x := pdfPageWidth - pdfMargin - pdfRegular.width(footer, 8)
+		fmt.Fprintf(page, "BT 0.6 g /%s 8.0 Tf %.2f %.2f Td (%s) Tj ET\n", pdfRegular.Resource, x, float64(pdfMargin)/2, pdfEscape(footer))
+
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+2*i))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
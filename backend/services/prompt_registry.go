@@ -0,0 +1,312 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"text/template"
+
+	"quicacademy-backend/models"
+)
+
+// Prompt template names
+const (
+	PromptSummary = "summary"
+	PromptQuiz    = "quiz"
+	PromptChat    = "chat"
+
+	PromptEssayGrading = "essay_grading"
+	PromptFlashcards   = "flashcards"
+)
+
+// SummaryPromptData is the data passed to summary templates
+type SummaryPromptData struct {
+	Text           string
+	Length         string // brief, standard, detailed
+	Audience       string // smp, sma, university
+	Style          string // default, exam_cram, eli5, outline
+	SourceLanguage string // language the material is written in
+	Bilingual      bool   // add English terms to Indonesian output
+}
+
+// QuizPromptData is the data passed to quiz templates
+type QuizPromptData struct {
+	Text           string
+	Subject        string
+	Count          int // number of questions
+	Easy           int // questions per difficulty, all 0 for any mix
+	Medium         int
+	Hard           int
+	Types          []string // question types to mix, see models.Question
+	Focus          []string // concepts to concentrate on
+	Concepts       []string // key concepts of the material's summary, to tag questions with
+	SourceLanguage string
+	Bilingual      bool
+}
+
+// ChatPromptData is the data passed to chat templates
+type ChatPromptData struct {
+	Message        string
+	Context        string
+	SourceLanguage string
+	Bilingual      bool
+}
+
+// EssayGradingPromptData is the data passed to essay grading templates
+type EssayGradingPromptData struct {
+	Question    string
+	Answer      string
+	ModelAnswer string
+	Rubric      []models.RubricCriterion
+	Sources     []string // material chunks relevant to the question
+	Bilingual   bool
+}
+
+// FlashcardPromptData is the data passed to flashcard templates
+type FlashcardPromptData struct {
+	Subject        string
+	Count          int    // number of cards
+	BulletPoints   string // key points of the material's summary
+	Concepts       string // concepts section of the summary
+	SourceLanguage string // language the summary is written in
+	Bilingual      bool
+}
+
+// promptDataTypes pins every template name to the data type it is rendered
+// with. Templates are test-rendered against it when loaded, so a template that
+// references an unknown field is rejected up front instead of at request time.
+var promptDataTypes = map[string]interface{}{
+	PromptSummary: SummaryPromptData{},
+	PromptQuiz:    QuizPromptData{},
+	PromptChat:    ChatPromptData{},
+
+	PromptEssayGrading: EssayGradingPromptData{},
+	PromptFlashcards:   FlashcardPromptData{},
+}
+
+// PromptRef identifies the template revision that produced a piece of content
+type PromptRef struct {
+	Name    string `json:"name"` // template name and language, e.g. summary.en
+	Version int    `json:"version"`
+}
+
+type PromptTemplate struct {
+	Name     string
+	Language string
+	Version  int
+	Weight   int // relative share of traffic when several revisions are active
+	tmpl     *template.Template
+}
+
+// PromptRegistry holds the active prompt templates per name and language.
+// Templates ship embedded in the binary and can be overridden at runtime by
+// rows in the prompt_templates table.
+type PromptRegistry struct {
+	mu        sync.RWMutex
+	embedded  map[string][]*PromptTemplate
+	templates map[string][]*PromptTemplate
+}
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// Embedded template files are named <name>.<language>.v<version>.tmpl
+var promptFileName = regexp.MustCompile(`^([a-z_]+)\.([a-z-]+)\.v(\d+)\.tmpl$`)
+
+// DefaultPrompts is the registry used by OpenRouterService
+var DefaultPrompts = mustLoadEmbeddedPrompts()
+
+func mustLoadEmbeddedPrompts() *PromptRegistry {
+	registry, err := NewPromptRegistry()
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// NewPromptRegistry builds a registry from the embedded templates, keeping
+// the highest version of each name and language
+func NewPromptRegistry() (*PromptRegistry, error) {
+	embedded := map[string][]*PromptTemplate{}
+
+	files, err := fs.Glob(embeddedPrompts, "prompts/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		match := promptFileName.FindStringSubmatch(file[len("prompts/"):])
+		if match == nil {
+			return nil, fmt.Errorf("invalid prompt template file name: %s", file)
+		}
+
+		body, err := embeddedPrompts.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		version, _ := strconv.Atoi(match[3])
+		pt, err := parsePromptTemplate(match[1], match[2], version, 1, string(body))
+		if err != nil {
+			return nil, err
+		}
+
+		key := promptKey(pt.Name, pt.Language)
+		if current := embedded[key]; len(current) == 0 || current[0].Version < pt.Version {
+			embedded[key] = []*PromptTemplate{pt}
+		}
+	}
+
+	return &PromptRegistry{embedded: embedded, templates: embedded}, nil
+}
+
+// LoadFromDB replaces the embedded templates with the active revisions stored
+// in prompt_templates. Names and languages without an active row keep using
+// the embedded template.
+func (r *PromptRegistry) LoadFromDB(db *sql.DB) error {
+	query := `SELECT name, language, version, body, weight FROM prompt_templates WHERE is_active`
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var overrides []*PromptTemplate
+	for rows.Next() {
+		var name, language, body string
+		var version, weight int
+		if err := rows.Scan(&name, &language, &version, &body, &weight); err != nil {
+			return err
+		}
+
+		pt, err := parsePromptTemplate(name, language, version, weight, body)
+		if err != nil {
+			return err
+		}
+
+		overrides = append(overrides, pt)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	r.override(overrides)
+	return nil
+}
+
+// override makes revisions the active templates of their name and language,
+// in place of the embedded ones
+func (r *PromptRegistry) override(revisions []*PromptTemplate) {
+	templates := map[string][]*PromptTemplate{}
+	for key, embedded := range r.embedded {
+		templates[key] = embedded
+	}
+
+	overridden := map[string]bool{}
+	for _, pt := range revisions {
+		key := promptKey(pt.Name, pt.Language)
+		if !overridden[key] {
+			overridden[key] = true
+			templates[key] = nil
+		}
+		templates[key] = append(templates[key], pt)
+	}
+
+	r.mu.Lock()
+	r.templates = templates
+	r.mu.Unlock()
+}
+
+// Render executes the template for name and language with data, which must
+// be the data type registered for name. When several revisions are active
+// one is picked at random by weight so they can be compared.
+func (r *PromptRegistry) Render(name, language string, data interface{}) (string, PromptRef, error) {
+	if expected, ok := promptDataTypes[name]; !ok || reflect.TypeOf(expected) != reflect.TypeOf(data) {
+		return "", PromptRef{}, fmt.Errorf("prompt template %s cannot be rendered with %T", name, data)
+	}
+
+	r.mu.RLock()
+	revisions := r.templates[promptKey(name, language)]
+	r.mu.RUnlock()
+
+	if len(revisions) == 0 {
+		return "", PromptRef{}, fmt.Errorf("no prompt template %s", promptKey(name, language))
+	}
+
+	pt := pickPromptRevision(revisions)
+
+	var buf bytes.Buffer
+	if err := pt.tmpl.Execute(&buf, data); err != nil {
+		return "", PromptRef{}, err
+	}
+
+	return buf.String(), PromptRef{Name: promptKey(pt.Name, pt.Language), Version: pt.Version}, nil
+}
+
+func parsePromptTemplate(name, language string, version, weight int, body string) (*PromptTemplate, error) {
+	sample, ok := promptDataTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt template name: %s", name)
+	}
+
+	key := fmt.Sprintf("%s.v%d", promptKey(name, language), version)
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", key, err)
+	}
+
+	// Catch references to fields the data type doesn't have
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", key, err)
+	}
+
+	if weight < 1 {
+		weight = 1
+	}
+
+	return &PromptTemplate{Name: name, Language: language, Version: version, Weight: weight, tmpl: tmpl}, nil
+}
+
+func pickPromptRevision(revisions []*PromptTemplate) *PromptTemplate {
+	if len(revisions) == 1 {
+		return revisions[0]
+	}
+
+	total := 0
+	for _, pt := range revisions {
+		total += pt.Weight
+	}
+
+	n := rand.Intn(total)
+	for _, pt := range revisions {
+		if n < pt.Weight {
+			return pt
+		}
+		n -= pt.Weight
+	}
+	return revisions[len(revisions)-1]
+}
+
+func promptKey(name, language string) string {
+	return name + "." + language
+}
+
+// promptLanguage maps an output language to the template language. Bilingual
+// output renders the Indonesian templates with Bilingual set.
+func promptLanguage(language string) (templateLanguage string, bilingual bool) {
+	switch language {
+	case LanguageEnglish:
+		return LanguageEnglish, false
+	case LanguageBilingual:
+		return LanguageIndonesian, true
+	default:
+		return LanguageIndonesian, false
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNewPromptRegistry(t *testing.T) {
+	registry, err := NewPromptRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name := range promptDataTypes {
+		for _, language := range []string{LanguageIndonesian, LanguageEnglish} {
+			revisions := registry.templates[promptKey(name, language)]
+			if len(revisions) != 1 {
+				t.Errorf("%s has %d embedded revisions, want 1", promptKey(name, language), len(revisions))
+			}
+		}
+	}
+
+	prompt, ref, err := registry.Render(PromptQuiz, LanguageEnglish, QuizPromptData{Count: 7, Subject: "Biologi", Text: "Sel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Name != "quiz.en" || ref.Version != 6 {
+		t.Errorf("rendered %+v, want quiz.en v6", ref)
+	}
+	if !strings.Contains(prompt, "7 questions") || !strings.Contains(prompt, "Biologi") {
+		t.Errorf("prompt does not use its data:\n%s", prompt)
+	}
+
+	if _, _, err := registry.Render(PromptQuiz, LanguageEnglish, SummaryPromptData{}); err == nil {
+		t.Error("a quiz template was rendered with summary data")
+	}
+	if _, _, err := registry.Render(PromptQuiz, "fr", QuizPromptData{}); err == nil {
+		t.Error("a template was rendered for a language without templates")
+	}
+}
+
+func TestPromptFileName(t *testing.T) {
+	tests := []struct {
+		file  string
+		match []string
+	}{
+		{file: "quiz.en.v6.tmpl", match: []string{"quiz", "en", "6"}},
+		{file: "essay_grading.id.v12.tmpl", match: []string{"essay_grading", "id", "12"}},
+		{file: "summary.id-en.v1.tmpl", match: []string{"summary", "id-en", "1"}},
+		{file: "quiz.en.tmpl"},
+		{file: "quiz.en.v1.txt"},
+		{file: "Quiz.en.v1.tmpl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			match := promptFileName.FindStringSubmatch(tt.file)
+			if tt.match == nil {
+				if match != nil {
+					t.Errorf("matched %q", match)
+				}
+				return
+			}
+			if match == nil || strings.Join(match[1:], " ") != strings.Join(tt.match, " ") {
+				t.Errorf("match = %q, want %q", match, tt.match)
+			}
+		})
+	}
+}
+
+func TestParsePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		body    string
+		weight  int
+		wantErr bool
+	}{
+		{name: "valid", tmpl: PromptChat, body: "Context: {{.Context}}\nQuestion: {{.Message}}", weight: 3},
+		{name: "weight below 1 counts as 1", tmpl: PromptChat, body: "{{.Message}}", weight: 0},
+		{name: "unknown template name", tmpl: "poem", body: "{{.Message}}", wantErr: true},
+		{name: "unknown field", tmpl: PromptChat, body: "{{.Subject}}", wantErr: true},
+		{name: "syntax error", tmpl: PromptChat, body: "{{.Message", wantErr: true},
+		{name: "field of another data type", tmpl: PromptSummary, body: "{{.Count}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt, err := parsePromptTemplate(tt.tmpl, LanguageEnglish, 2, tt.weight, tt.body)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("template was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pt.Weight < 1 || (tt.weight >= 1 && pt.Weight != tt.weight) {
+				t.Errorf("weight = %d for %d", pt.Weight, tt.weight)
+			}
+		})
+	}
+}
+
+func TestPickPromptRevision(t *testing.T) {
+	revisions := []*PromptTemplate{{Version: 1, Weight: 3}, {Version: 2, Weight: 1}}
+
+	const picks = 20000
+	counts := map[int]int{}
+	for i := 0; i < picks; i++ {
+		counts[pickPromptRevision(revisions).Version]++
+	}
+
+	if share := float64(counts[1]) / picks; math.Abs(share-0.75) > 0.03 {
+		t.Errorf("version 1 got %.3f of the traffic, want 0.75", share)
+	}
+	if counts[1]+counts[2] != picks {
+		t.Errorf("picked revisions %v", counts)
+	}
+
+	single := []*PromptTemplate{{Version: 4, Weight: 1}}
+	if pickPromptRevision(single).Version != 4 {
+		t.Error("the only revision was not picked")
+	}
+}
+
+func TestPromptRegistryOverride(t *testing.T) {
+	registry, err := NewPromptRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	override, err := parsePromptTemplate(PromptChat, LanguageEnglish, 9, 1, "Override: {{.Message}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.override([]*PromptTemplate{override})
+
+	prompt, ref, err := registry.Render(PromptChat, LanguageEnglish, ChatPromptData{Message: "halo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt != "Override: halo" || ref.Version != 9 {
+		t.Errorf("rendered %q from %+v, want the database revision", prompt, ref)
+	}
+
+	// Names and languages without an override keep the embedded template
+	_, ref, err = registry.Render(PromptChat, LanguageIndonesian, ChatPromptData{Message: "halo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Version != 1 {
+		t.Errorf("chat.id rendered %+v, want the embedded v1", ref)
+	}
+
+	// Loading again without the override restores the embedded template
+	registry.override(nil)
+	if _, ref, _ := registry.Render(PromptChat, LanguageEnglish, ChatPromptData{}); ref.Version != 1 {
+		t.Errorf("chat.en rendered %+v after the override was removed, want v1", ref)
+	}
+	if got := registry.embedded[promptKey(PromptChat, LanguageEnglish)]; len(got) != 1 || got[0].Version != 1 {
+		t.Error("the override changed the embedded templates")
+	}
+}
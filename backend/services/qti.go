@@ -0,0 +1,865 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"quicacademy-backend/models"
+)
+
+// QTI and content package namespaces
+const (
+	qtiNamespace   = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	imscpNamespace = "http://www.imsglobal.org/xsd/imscp_v1p1"
+	lomNamespace   = "http://ltsc.ieee.org/xsd/LOM"
+	xsiNamespace   = "http://www.w3.org/2001/XMLSchema-instance"
+
+	qtiSchemaLocation   = qtiNamespace + " http://www.imsglobal.org/xsd/qti/qtiv2p1/imsqti_v2p1.xsd"
+	imscpSchemaLocation = imscpNamespace + " http://www.imsglobal.org/xsd/imscp_v1p1.xsd " +
+		lomNamespace + " http://www.imsglobal.org/xsd/imsmd_loose_v1p3p2.xsd"
+)
+
+// Resource types of QTI 2.1 packages
+const (
+	qtiTestResource = "imsqti_test_xmlv2p1"
+	qtiItemResource = "imsqti_item_xmlv2p1"
+)
+
+// Standard response processing templates
+const (
+	qtiMatchCorrect = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"
+	qtiMapResponse  = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/map_response"
+)
+
+const (
+	qtiManifest   = "imsmanifest.xml"
+	qtiTest       = "assessment.xml"
+	qtiResponse   = "RESPONSE"
+	qtiScore      = "SCORE"
+	qtiItemPrefix = "item-"
+)
+
+// maxQTIFileSize limits each file read from an imported package
+const maxQTIFileSize = 5 << 20
+
+// QTIPackage writes questions as an IMS QTI 2.1 content package: a zip with
+// a manifest, an assessment test named title and one assessment item per
+// question. Concepts and difficulty are keywords in the manifest's metadata
+// of each item.
+func QTIPackage(title string, questions []models.Question) ([]byte, []int, error) {
+	section := xmlElement("assessmentSection", "identifier", "section-1", "title", title, "visible", "true")
+	testResource := xmlElement("resource", "identifier", "test", "type", qtiTestResource, "href", qtiTest).
+		add(xmlElement("file", "href", qtiTest))
+	resources := xmlElement("resources").add(testResource)
+
+	type packageFile struct {
+		name string
+		data []byte
+	}
+	var items []packageFile
+
+	skipped := []int{}
+	for _, question := range questions {
+		item, ok := qtiItem(question)
+		if !ok {
+			skipped = append(skipped, question.ID)
+			continue
+		}
+
+		identifier := item.attr("identifier")
+		href := "items/" + identifier + ".xml"
+		section.add(xmlElement("assessmentItemRef", "identifier", identifier, "href", href))
+		testResource.add(xmlElement("dependency", "identifierref", identifier))
+
+		resource := xmlElement("resource", "identifier", identifier, "type", qtiItemResource, "href", href)
+		if tags := questionTags(question); len(tags) > 0 {
+			general := xmlElement("imsmd:general")
+			for _, tag := range tags {
+				general.add(xmlElement("imsmd:keyword").add(xmlElement("imsmd:string").add(xmlText(tag))))
+			}
+			resource.add(xmlElement("metadata").add(xmlElement("imsmd:lom").add(general)))
+		}
+		resources.add(resource.add(xmlElement("file", "href", href)))
+
+		items = append(items, packageFile{href, xmlDocument(item)})
+	}
+
+	test := xmlElement("assessmentTest",
+		"xmlns", qtiNamespace, "xmlns:xsi", xsiNamespace, "xsi:schemaLocation", qtiSchemaLocation,
+		"identifier", "test", "title", title,
+	).add(xmlElement("testPart", "identifier", "part-1", "navigationMode", "nonlinear", "submissionMode", "simultaneous").add(section))
+
+	manifest := xmlElement("manifest",
+		"xmlns", imscpNamespace, "xmlns:imsmd", lomNamespace, "xmlns:xsi", xsiNamespace,
+		"xsi:schemaLocation", imscpSchemaLocation, "identifier", "manifest",
+	).add(
+		xmlElement("metadata").add(
+			xmlElement("schema").add(xmlText("QTIv2.1 Package")),
+			xmlElement("schemaversion").add(xmlText("1.0.0")),
+		),
+		xmlElement("organizations"),
+		resources,
+	)
+
+	files := append([]packageFile{
+		{qtiManifest, xmlDocument(manifest)},
+		{qtiTest, xmlDocument(test)},
+	}, items...)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(file.data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), skipped, nil
+}
+
+// qtiItem is the assessment item of a question, or false when its type has
+// no QTI interaction
+func qtiItem(question models.Question) (*xmlNode, bool) {
+	item := xmlElement("assessmentItem",
+		"xmlns", qtiNamespace, "xmlns:xsi", xsiNamespace, "xsi:schemaLocation", qtiSchemaLocation,
+		"identifier", qtiItemPrefix+strconv.Itoa(question.ID), "title", questionName(question),
+		"adaptive", "false", "timeDependent", "false",
+	)
+	body := xmlElement("itemBody")
+	template := qtiMatchCorrect
+	var processing *xmlNode
+
+	declaration := func(cardinality, baseType string, correct ...string) *xmlNode {
+		declaration := xmlElement("responseDeclaration", "identifier", qtiResponse, "cardinality", cardinality, "baseType", baseType)
+		if len(correct) > 0 {
+			response := xmlElement("correctResponse")
+			for _, value := range correct {
+				response.add(xmlElement("value").add(xmlText(value)))
+			}
+			declaration.add(response)
+		}
+		return declaration
+	}
+	choices := func(name string, ids, texts []string) []*xmlNode {
+		nodes := make([]*xmlNode, len(ids))
+		for i := range ids {
+			nodes[i] = xmlElement(name, "identifier", ids[i]).add(xmlText(texts[i]))
+		}
+		return nodes
+	}
+	optionIDs := make([]string, len(question.Options))
+	for i := range question.Options {
+		optionIDs[i] = OptionID(i)
+	}
+
+	var response *xmlNode
+	switch question.Type {
+	case models.QuestionMultipleChoice, models.QuestionMultiSelect:
+		maxChoices := "1"
+		response = declaration("single", "identifier", question.CorrectAnswer)
+		if question.Type == models.QuestionMultiSelect {
+			maxChoices = "0"
+			response = declaration("multiple", "identifier", question.CorrectAnswers...)
+		}
+		// Options are already shuffled when the quiz is generated
+		interaction := xmlElement("choiceInteraction", "responseIdentifier", qtiResponse, "shuffle", "false", "maxChoices", maxChoices).
+			add(choices("simpleChoice", optionIDs, question.Options)...)
+		body.add(qtiParagraphs(question.Question, nil)...).add(interaction)
+
+	case models.QuestionTrueFalse:
+		response = declaration("single", "identifier", question.CorrectAnswer)
+		interaction := xmlElement("choiceInteraction", "responseIdentifier", qtiResponse, "shuffle", "false", "maxChoices", "1").
+			add(choices("simpleChoice", []string{"true", "false"}, []string{"True", "False"})...)
+		body.add(qtiParagraphs(question.Question, nil)...).add(interaction)
+
+	case models.QuestionShortAnswer, models.QuestionFillBlank:
+		response = declaration("single", "string", question.CorrectAnswer)
+		mapping := xmlElement("mapping", "defaultValue", "0")
+		for _, accepted := range append([]string{question.CorrectAnswer}, question.AcceptedAnswers...) {
+			mapping.add(xmlElement("mapEntry", "mapKey", accepted, "mappedValue", "1", "caseSensitive", "false"))
+		}
+		response.add(mapping)
+		template = qtiMapResponse
+		body.add(qtiParagraphs(question.Question, xmlElement("textEntryInteraction", "responseIdentifier", qtiResponse))...)
+
+	case models.QuestionNumeric:
+		response = declaration("single", "float", question.CorrectAnswer)
+		body.add(qtiParagraphs(question.Question, xmlElement("textEntryInteraction", "responseIdentifier", qtiResponse))...)
+		if question.Tolerance > 0 {
+			setScore := func(score string) *xmlNode {
+				return xmlElement("setOutcomeValue", "identifier", qtiScore).
+					add(xmlElement("baseValue", "baseType", "float").add(xmlText(score)))
+			}
+			template = ""
+			processing = xmlElement("responseProcessing").add(
+				xmlElement("responseCondition").add(
+					xmlElement("responseIf").add(
+						xmlElement("equal", "toleranceMode", "absolute", "tolerance", formatNumber(question.Tolerance)).add(
+							xmlElement("variable", "identifier", qtiResponse),
+							xmlElement("correct", "identifier", qtiResponse),
+						),
+						setScore("1"),
+					),
+					xmlElement("responseElse").add(setScore("0")),
+				),
+			)
+		}
+
+	case models.QuestionMatching:
+		promptIDs := make([]string, len(question.Prompts))
+		pairs := make([]string, len(question.Prompts))
+		for i := range question.Prompts {
+			promptIDs[i] = "P" + strconv.Itoa(i+1)
+			if i < len(question.CorrectAnswers) {
+				pairs[i] = promptIDs[i] + " " + question.CorrectAnswers[i]
+			}
+		}
+		response = declaration("multiple", "directedPair", pairs...)
+
+		prompts := choices("simpleAssociableChoice", promptIDs, question.Prompts)
+		for _, prompt := range prompts {
+			prompt.Attrs = append(prompt.Attrs, xmlAttr("matchMax", "1"))
+		}
+		options := choices("simpleAssociableChoice", optionIDs, question.Options)
+		for _, option := range options {
+			option.Attrs = append(option.Attrs, xmlAttr("matchMax", strconv.Itoa(len(question.Prompts))))
+		}
+		interaction := xmlElement("matchInteraction", "responseIdentifier", qtiResponse, "shuffle", "false", "maxAssociations", strconv.Itoa(len(question.Prompts))).add(
+			xmlElement("simpleMatchSet").add(prompts...),
+			xmlElement("simpleMatchSet").add(options...),
+		)
+		body.add(qtiParagraphs(question.Question, nil)...).add(interaction)
+
+	case models.QuestionOrdering:
+		response = declaration("ordered", "identifier", question.CorrectAnswers...)
+		interaction := xmlElement("orderInteraction", "responseIdentifier", qtiResponse, "shuffle", "false").
+			add(choices("simpleChoice", optionIDs, question.Options)...)
+		body.add(qtiParagraphs(question.Question, nil)...).add(interaction)
+
+	case models.QuestionEssay:
+		// Essays are scored by hand, with the model answer and rubric shown
+		// to scorers
+		response = declaration("single", "string")
+		template = ""
+		body.add(qtiParagraphs(question.Question, nil)...).
+			add(xmlElement("extendedTextInteraction", "responseIdentifier", qtiResponse, "expectedLines", "15"))
+		if graderInfo := essayGraderInfo(question); graderInfo != "" {
+			body.add(xmlElement("rubricBlock", "view", "scorer").add(qtiParagraphs(graderInfo, nil)...))
+		}
+
+	default:
+		return nil, false
+	}
+
+	if question.Explanation != "" {
+		body.add(xmlElement("rubricBlock", "view", "tutor").add(qtiParagraphs(question.Explanation, nil)...))
+	}
+
+	item.add(response, xmlElement("outcomeDeclaration", "identifier", qtiScore, "cardinality", "single", "baseType", "float"), body)
+	switch {
+	case processing != nil:
+		item.add(processing)
+	case template != "":
+		item.add(xmlElement("responseProcessing", "template", template))
+	}
+	return item, true
+}
+
+// qtiParagraphs are the paragraphs of a plain text, one per line. An inline
+// interaction takes the place of the fill in the blank placeholder, or gets
+// its own paragraph at the end when the text has none.
+func qtiParagraphs(text string, inline *xmlNode) []*xmlNode {
+	var paragraphs []*xmlNode
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		paragraph := xmlElement("p")
+		if before, after, ok := splitBlank(line); ok && inline != nil {
+			if before != "" {
+				paragraph.add(xmlText(before))
+			}
+			paragraph.add(inline)
+			if after != "" {
+				paragraph.add(xmlText(after))
+			}
+			inline = nil
+		} else {
+			paragraph.add(xmlText(line))
+		}
+		paragraphs = append(paragraphs, paragraph)
+	}
+	if inline != nil {
+		paragraphs = append(paragraphs, xmlElement("p").add(inline))
+	}
+	return paragraphs
+}
+
+// parseQTI reads the items of a QTI 2.1 content package, in the order of its
+// manifest, or of a single assessment item XML file. Packages without a
+// manifest are read in the order of their file names.
+func parseQTI(data []byte) ([]importedItem, error) {
+	if !bytes.HasPrefix(data, []byte("PK")) {
+		root, err := parseXML(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("not a QTI file: %v", err)
+		}
+		item := importedItem{}
+		item.Name, item.Question, item.Err = qtiImport(root, nil)
+		return []importedItem{item}, nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a QTI package: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[path.Clean(file.Name)] = file
+	}
+
+	type itemRef struct {
+		href string
+		tags []string
+	}
+	var refs []itemRef
+	manifestFile, hasManifest := files[qtiManifest]
+	if hasManifest {
+		manifest, err := readQTIFile(manifestFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", qtiManifest, err)
+		}
+		for _, resource := range manifest.findAll("resource") {
+			if !strings.HasPrefix(resource.attr("type"), "imsqti_item") {
+				continue
+			}
+			ref := itemRef{href: resource.attr("href")}
+			if file := resource.find("file"); ref.href == "" && file != nil {
+				ref.href = file.attr("href")
+			}
+			for _, keyword := range resource.findAll("keyword") {
+				ref.tags = append(ref.tags, qtiText(keyword.Children))
+			}
+			refs = append(refs, ref)
+		}
+	} else {
+		var names []string
+		for name := range files {
+			if strings.HasSuffix(strings.ToLower(name), ".xml") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			refs = append(refs, itemRef{href: name})
+		}
+	}
+
+	items := []importedItem{}
+	for _, ref := range refs {
+		item := importedItem{Name: ref.href}
+		file := files[path.Clean(ref.href)]
+		if file == nil {
+			item.Err = fmt.Errorf("%s is missing from the package", ref.href)
+			items = append(items, item)
+			continue
+		}
+
+		root, err := readQTIFile(file)
+		switch {
+		case err != nil:
+			item.Err = fmt.Errorf("invalid XML: %v", err)
+		case !hasManifest && root.Name != "assessmentItem":
+			item.Err = errSkipItem // the test or other files of the package
+		default:
+			var name string
+			name, item.Question, item.Err = qtiImport(root, ref.tags)
+			if name != "" {
+				item.Name = name
+			}
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("not a QTI package: no items found")
+	}
+	return items, nil
+}
+
+// readQTIFile parses an XML file of a package
+func readQTIFile(file *zip.File) (*xmlNode, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, maxQTIFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxQTIFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", file.Name, maxQTIFileSize>>20)
+	}
+	return parseXML(bytes.NewReader(data))
+}
+
+// qtiImport reads an assessment item with a single interaction, tagged
+// with the keywords of its manifest entry
+func qtiImport(item *xmlNode, tags []string) (string, models.Question, error) {
+	question := models.Question{}
+	if item.Name != "assessmentItem" {
+		return "", question, fmt.Errorf("not an assessment item but %s", item.Name)
+	}
+	name := strings.TrimSpace(item.attr("title"))
+	applyTags(&question, tags)
+
+	body := item.find("itemBody")
+	if body == nil {
+		return name, question, errors.New("the item has no itemBody")
+	}
+	var interactions []*xmlNode
+	body.walk(func(n *xmlNode) {
+		if strings.HasSuffix(n.Name, "Interaction") {
+			interactions = append(interactions, n)
+		}
+	})
+	switch {
+	case len(interactions) == 0:
+		return name, question, errors.New("the item has no interaction")
+	case len(interactions) > 1:
+		return name, question, errors.New("items with more than one interaction are not supported")
+	}
+	interaction := interactions[0]
+
+	var declaration *xmlNode
+	for _, candidate := range item.elements("responseDeclaration") {
+		if candidate.attr("identifier") == interaction.attr("responseIdentifier") {
+			declaration = candidate
+		}
+	}
+	if declaration == nil {
+		return name, question, fmt.Errorf("the item has no response declaration for %s", interaction.Name)
+	}
+
+	// The correct response, or the responses that score points when the
+	// item only has a mapping
+	var correct []string
+	if response := declaration.find("correctResponse"); response != nil {
+		for _, value := range response.elements("value") {
+			correct = append(correct, strings.TrimSpace(qtiText(value.Children)))
+		}
+	}
+	var mapped []string
+	if mapping := declaration.find("mapping"); mapping != nil {
+		for _, entry := range mapping.elements("mapEntry") {
+			if value, err := strconv.ParseFloat(entry.attr("mappedValue"), 64); err == nil && value > 0 {
+				mapped = append(mapped, strings.TrimSpace(entry.attr("mapKey")))
+			}
+		}
+	}
+	if len(correct) == 0 {
+		correct = mapped
+	}
+
+	question.Question = qtiText(body.Children)
+	for _, rubric := range body.findAll("rubricBlock") {
+		if strings.Contains(rubric.attr("view"), "tutor") {
+			question.Explanation = qtiText(rubric.Children)
+		}
+	}
+	if feedback := item.find("modalFeedback"); question.Explanation == "" && feedback != nil {
+		question.Explanation = qtiText(feedback.Children)
+	}
+
+	// Choices are identified by their position
+	readChoices := func(choices []*xmlNode) ([]string, map[string]string) {
+		texts := make([]string, len(choices))
+		ids := map[string]string{}
+		for i, choice := range choices {
+			texts[i] = qtiText(choice.Children)
+			ids[choice.attr("identifier")] = OptionID(i)
+		}
+		return texts, ids
+	}
+	resolve := func(ids map[string]string, values []string) ([]string, error) {
+		resolved := make([]string, len(values))
+		for i, value := range values {
+			id, ok := ids[value]
+			if !ok {
+				return nil, fmt.Errorf("the correct response %q is not a choice", value)
+			}
+			resolved[i] = id
+		}
+		return resolved, nil
+	}
+
+	switch interaction.Name {
+	case "choiceInteraction":
+		choices := interaction.findAll("simpleChoice")
+		if len(choices) == 2 && qtiTrueFalse(choices) {
+			question.Type = models.QuestionTrueFalse
+			if len(correct) > 0 {
+				question.CorrectAnswer = strings.ToLower(correct[0])
+			}
+			break
+		}
+
+		options, ids := readChoices(choices)
+		question.Options = options
+		answers, err := resolve(ids, correct)
+		if err != nil {
+			return name, question, err
+		}
+		if declaration.attr("cardinality") == "multiple" {
+			question.Type = models.QuestionMultiSelect
+			question.CorrectAnswers = answers
+			break
+		}
+		question.Type = models.QuestionMultipleChoice
+		if len(answers) == 0 {
+			return name, question, errors.New("the item has no correct response")
+		}
+		question.CorrectAnswer = answers[0]
+
+	case "textEntryInteraction":
+		question.Type = models.QuestionShortAnswer
+		if baseType := declaration.attr("baseType"); baseType == "float" || baseType == "integer" {
+			question.Type = models.QuestionNumeric
+		}
+		if before, after, ok := splitBlank(question.Question); ok && strings.TrimSpace(after) == "" {
+			question.Question = strings.TrimSpace(before)
+		} else if ok && question.Type == models.QuestionShortAnswer {
+			question.Type = models.QuestionFillBlank
+		}
+
+		if question.Type == models.QuestionNumeric {
+			if len(correct) > 0 {
+				question.CorrectAnswer = correct[0]
+			}
+			if equal := item.find("equal"); equal != nil && equal.attr("toleranceMode") == "absolute" {
+				if fields := strings.Fields(equal.attr("tolerance")); len(fields) > 0 {
+					tolerance, ok := parseNumber(fields[0])
+					if !ok {
+						return name, question, fmt.Errorf("invalid tolerance %q", equal.attr("tolerance"))
+					}
+					question.Tolerance = tolerance
+				}
+			}
+			break
+		}
+
+		seen := map[string]bool{}
+		for _, answer := range append(correct, mapped...) {
+			if answer != "" && !seen[strings.ToLower(answer)] {
+				seen[strings.ToLower(answer)] = true
+				question.AcceptedAnswers = append(question.AcceptedAnswers, answer)
+			}
+		}
+
+	case "matchInteraction":
+		question.Type = models.QuestionMatching
+		sets := interaction.elements("simpleMatchSet")
+		if len(sets) != 2 {
+			return name, question, errors.New("matchInteraction needs two simpleMatchSets")
+		}
+		prompts, promptIDs := readChoices(sets[0].elements("simpleAssociableChoice"))
+		options, optionIDs := readChoices(sets[1].elements("simpleAssociableChoice"))
+		question.Prompts, question.Options = prompts, options
+
+		matches := map[string]string{}
+		for _, pair := range correct {
+			fields := strings.Fields(pair)
+			if len(fields) != 2 {
+				return name, question, fmt.Errorf("invalid pair %q", pair)
+			}
+			source, target := fields[0], fields[1]
+			if _, ok := promptIDs[source]; !ok {
+				source, target = target, source
+			}
+			prompt, promptOK := promptIDs[source]
+			option, optionOK := optionIDs[target]
+			if !promptOK || !optionOK {
+				return name, question, fmt.Errorf("the pair %q does not match a prompt with an option", pair)
+			}
+			matches[prompt] = option
+		}
+		for i := range prompts {
+			match, ok := matches[OptionID(i)]
+			if !ok {
+				return name, question, fmt.Errorf("prompt %d has no correct match", i+1)
+			}
+			question.CorrectAnswers = append(question.CorrectAnswers, match)
+		}
+
+	case "orderInteraction":
+		question.Type = models.QuestionOrdering
+		options, ids := readChoices(interaction.findAll("simpleChoice"))
+		question.Options = options
+		answers, err := resolve(ids, correct)
+		if err != nil {
+			return name, question, err
+		}
+		question.CorrectAnswers = answers
+
+	case "extendedTextInteraction":
+		question.Type = models.QuestionEssay
+		for _, rubric := range body.findAll("rubricBlock") {
+			if strings.Contains(rubric.attr("view"), "scorer") {
+				question.ModelAnswer = qtiText(rubric.Children)
+			}
+		}
+
+	default:
+		return name, question, fmt.Errorf("%s is not supported", interaction.Name)
+	}
+
+	return name, question, nil
+}
+
+// qtiTrueFalse tells whether choices are the true and false choices of a
+// true/false item
+func qtiTrueFalse(choices []*xmlNode) bool {
+	ids := map[string]bool{}
+	for _, choice := range choices {
+		ids[strings.ToLower(choice.attr("identifier"))] = true
+	}
+	return ids["true"] && ids["false"]
+}
+
+// qtiHidden are elements of item bodies that are not part of the question
+// text
+var qtiHidden = map[string]bool{
+	"rubricBlock": true, "feedbackBlock": true, "feedbackInline": true, "modalFeedback": true,
+}
+
+// qtiBlocks are the elements that start a line of text
+var qtiBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "ul": true, "ol": true, "pre": true,
+	"blockquote": true, "table": true, "tr": true, "prompt": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// qtiText is the plain text of XML content: spaces are collapsed as in
+// HTML, blocks are put on lines of their own, a text entry interaction
+// becomes the fill in the blank placeholder, and other interactions only add
+// their prompt
+func qtiText(nodes []*xmlNode) string {
+	var b strings.Builder
+	var write func(nodes []*xmlNode)
+	write = func(nodes []*xmlNode) {
+		for _, n := range nodes {
+			switch {
+			case n.Name == "":
+				b.WriteString(strings.Map(func(r rune) rune {
+					if unicode.IsSpace(r) {
+						return ' '
+					}
+					return r
+				}, n.Text))
+			case n.Name == "textEntryInteraction":
+				b.WriteString(fillBlankPlaceholder)
+			case qtiHidden[n.Name]:
+			case strings.HasSuffix(n.Name, "Interaction"):
+				write(n.elements("prompt"))
+			case qtiBlocks[n.Name]:
+				b.WriteString("\n")
+				write(n.Children)
+				b.WriteString("\n")
+			default:
+				write(n.Children)
+			}
+		}
+	}
+	write(nodes)
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// xmlNode is an element of a small XML tree, or a text when Name is empty.
+// QTI item bodies mix text and elements, whose order encoding/xml's struct
+// mapping doesn't keep.
+type xmlNode struct {
+	Name     string
+	Attrs    []xml.Attr
+	Children []*xmlNode
+	Text     string
+}
+
+func xmlElement(name string, attrs ...string) *xmlNode {
+	n := &xmlNode{Name: name}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attrs = append(n.Attrs, xmlAttr(attrs[i], attrs[i+1]))
+	}
+	return n
+}
+
+func xmlAttr(name, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+}
+
+func xmlText(text string) *xmlNode {
+	return &xmlNode{Text: text}
+}
+
+func (n *xmlNode) add(children ...*xmlNode) *xmlNode {
+	n.Children = append(n.Children, children...)
+	return n
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// walk calls fn for every element below n, in document order
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+	for _, child := range n.Children {
+		if child.Name != "" {
+			fn(child)
+			child.walk(fn)
+		}
+	}
+}
+
+// find is the first element named name below n, or nil
+func (n *xmlNode) find(name string) *xmlNode {
+	if all := n.findAll(name); len(all) > 0 {
+		return all[0]
+	}
+	return nil
+}
+
+// findAll are the elements named name below n
+func (n *xmlNode) findAll(name string) []*xmlNode {
+	var found []*xmlNode
+	n.walk(func(child *xmlNode) {
+		if child.Name == name {
+			found = append(found, child)
+		}
+	})
+	return found
+}
+
+// elements are the child elements of n named name
+func (n *xmlNode) elements(name string) []*xmlNode {
+	var found []*xmlNode
+	for _, child := range n.Children {
+		if child.Name == name {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// write writes n as XML. Elements holding only elements are indented;
+// mixed content is written as is since its spaces are part of the text.
+func (n *xmlNode) write(buf *bytes.Buffer, depth int) {
+	if n.Name == "" {
+		xml.EscapeText(buf, []byte(n.Text))
+		return
+	}
+
+	buf.WriteString("<" + n.Name)
+	for _, attr := range n.Attrs {
+		buf.WriteString(" " + attr.Name.Local + `="`)
+		xml.EscapeText(buf, []byte(attr.Value))
+		buf.WriteString(`"`)
+	}
+	if len(n.Children) == 0 {
+		buf.WriteString("/>")
+		return
+	}
+	buf.WriteString(">")
+
+	indent := true
+	for _, child := range n.Children {
+		if child.Name == "" {
+			indent = false
+		}
+	}
+	for _, child := range n.Children {
+		if indent {
+			buf.WriteString("\n" + strings.Repeat("  ", depth+1))
+		}
+		child.write(buf, depth+1)
+	}
+	if indent {
+		buf.WriteString("\n" + strings.Repeat("  ", depth))
+	}
+	buf.WriteString("</" + n.Name + ">")
+}
+
+// xmlDocument writes root as an XML document
+func xmlDocument(root *xmlNode) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	root.write(&buf, 0)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// parseXML reads an XML document into a tree, and returns its root element
+func parseXML(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Entity = xml.HTMLEntity
+
+	document := &xmlNode{}
+	stack := []*xmlNode{document}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &xmlNode{Name: t.Name.Local, Attrs: t.Attr}
+			parent.add(element)
+			stack = append(stack, element)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			parent.add(xmlText(string(t)))
+		}
+	}
+
+	for _, child := range document.Children {
+		if child.Name != "" {
+			return child, nil
+		}
+	}
+	return nil, errors.New("the document has no root element")
+}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// This file writes small SQLite databases from scratch, without a driver, in
+// the documented file format (https://www.sqlite.org/fileformat.html). It
+// only supports what exports need: tables and indexes written once, with
+// integer and text keys.
+
+const sqlitePageSize = 4096
+
+// sqliteTable is a table and its rows. Values are nil, int64, float64,
+// string or []byte; the column aliasing the rowid, if any, must be nil.
+type sqliteTable struct {
+	Name string
+	SQL  string
+	Rows []sqliteRow
+}
+
+type sqliteRow struct {
+	RowID  int64
+	Values []interface{}
+}
+
+// sqliteIndex is an index on the columns at Columns of a table's rows
+type sqliteIndex struct {
+	Name    string
+	Table   string
+	SQL     string
+	Columns []int
+}
+
+// Page types of b-tree pages
+const (
+	sqliteInteriorIndex = 0x02
+	sqliteInteriorTable = 0x05
+	sqliteLeafIndex     = 0x0a
+	sqliteLeafTable     = 0x0d
+)
+
+type sqliteWriter struct {
+	pages [][]byte // page n is pages[n-1]
+}
+
+// writeSQLite builds a database file holding tables and indexes
+func writeSQLite(tables []sqliteTable, indexes []sqliteIndex) ([]byte, error) {
+	w := &sqliteWriter{}
+	w.allocate() // page 1 is the root of the schema table
+
+	byName := map[string]sqliteTable{}
+	var schema []sqliteRow
+	for _, table := range tables {
+		byName[table.Name] = table
+		root := w.allocate()
+		schema = append(schema, sqliteRow{
+			RowID:  int64(len(schema) + 1),
+			Values: []interface{}{"table", table.Name, table.Name, int64(root), table.SQL},
+		})
+
+		rows := append([]sqliteRow(nil), table.Rows...)
+		sort.Slice(rows, func(i, j int) bool { return rows[i].RowID < rows[j].RowID })
+		for i := 1; i < len(rows); i++ {
+			if rows[i].RowID == rows[i-1].RowID {
+				return nil, fmt.Errorf("duplicate rowid %d in %s", rows[i].RowID, table.Name)
+			}
+		}
+		w.writeTable(root, rows)
+	}
+
+	for _, index := range indexes {
+		table, ok := byName[index.Table]
+		if !ok {
+			return nil, fmt.Errorf("index %s is on unknown table %s", index.Name, index.Table)
+		}
+		root := w.allocate()
+		schema = append(schema, sqliteRow{
+			RowID:  int64(len(schema) + 1),
+			Values: []interface{}{"index", index.Name, index.Table, int64(root), index.SQL},
+		})
+
+		keys := make([][]interface{}, len(table.Rows))
+		for i, row := range table.Rows {
+			key := make([]interface{}, 0, len(index.Columns)+1)
+			for _, column := range index.Columns {
+				key = append(key, row.Values[column])
+			}
+			keys[i] = append(key, row.RowID)
+		}
+		sort.Slice(keys, func(i, j int) bool { return compareSQLiteKeys(keys[i], keys[j]) < 0 })
+
+		records := make([][]byte, len(keys))
+		for i, key := range keys {
+			records[i] = sqliteRecord(key)
+		}
+		w.writeIndex(root, records)
+	}
+
+	w.writeTable(1, schema)
+	w.writeHeader()
+
+	file := make([]byte, 0, len(w.pages)*sqlitePageSize)
+	for _, page := range w.pages {
+		file = append(file, page...)
+	}
+	return file, nil
+}
+
+func (w *sqliteWriter) allocate() int {
+	w.pages = append(w.pages, make([]byte, sqlitePageSize))
+	return len(w.pages)
+}
+
+func (w *sqliteWriter) page(number int) []byte {
+	return w.pages[number-1]
+}
+
+// headerOffset is where the b-tree header of a page starts, after the file
+// header on page 1
+func headerOffset(page int) int {
+	if page == 1 {
+		return 100
+	}
+	return 0
+}
+
+func (w *sqliteWriter) writeHeader() {
+	header := w.page(1)
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], sqlitePageSize)
+	header[18], header[19] = 1, 1 // legacy journal mode
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[24:], 1) // file change counter
+	binary.BigEndian.PutUint32(header[28:], uint32(len(w.pages)))
+	binary.BigEndian.PutUint32(header[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // version valid for the change counter
+	binary.BigEndian.PutUint32(header[96:], 3040001)
+}
+
+// btreeNode is a page of a b-tree level under construction with the largest
+// rowid in it, for table b-trees
+type btreeNode struct {
+	page   int
+	maxKey int64
+}
+
+// writeTable writes rows, sorted by rowid, as a table b-tree rooted at root
+func (w *sqliteWriter) writeTable(root int, rows []sqliteRow) {
+	cells := make([][]byte, len(rows))
+	for i, row := range rows {
+		cells[i] = w.tableLeafCell(row)
+	}
+
+	if fitsPage(cells, root, 8) {
+		w.writePage(root, sqliteLeafTable, cells, 0)
+		return
+	}
+
+	var nodes []btreeNode
+	for start := 0; start < len(cells); {
+		end := packCells(cells[start:], 0, 8) + start
+		page := w.allocate()
+		w.writePage(page, sqliteLeafTable, cells[start:end], 0)
+		nodes = append(nodes, btreeNode{page: page, maxKey: rows[end-1].RowID})
+		start = end
+	}
+
+	for {
+		interiorCells := make([][]byte, len(nodes)-1)
+		for i, node := range nodes[:len(nodes)-1] {
+			interiorCells[i] = tableInteriorCell(node)
+		}
+		if fitsPage(interiorCells, root, 12) {
+			w.writePage(root, sqliteInteriorTable, interiorCells, nodes[len(nodes)-1].page)
+			return
+		}
+
+		var parents []btreeNode
+		for start := 0; start < len(nodes); {
+			// A child's cell is left out when it becomes the right-most pointer
+			end := packCells(interiorCells[start:], 0, 12) + start + 1
+			if end > len(nodes) {
+				end = len(nodes)
+			}
+			// Leave the last page more than its right-most pointer
+			if len(nodes)-end == 1 {
+				end--
+			}
+			group := nodes[start:end]
+			page := w.allocate()
+			w.writePage(page, sqliteInteriorTable, interiorCells[start:end-1], group[len(group)-1].page)
+			parents = append(parents, btreeNode{page: page, maxKey: group[len(group)-1].maxKey})
+			start = end
+		}
+		nodes = parents
+	}
+}
+
+func tableInteriorCell(node btreeNode) []byte {
+	cell := make([]byte, 4, 13)
+	binary.BigEndian.PutUint32(cell, uint32(node.page))
+	return append(cell, sqliteVarint(uint64(node.maxKey))...)
+}
+
+// tableLeafCell encodes a row, spilling a payload too large for one page to
+// overflow pages
+func (w *sqliteWriter) tableLeafCell(row sqliteRow) []byte {
+	payload := sqliteRecord(row.Values)
+	cell := append(sqliteVarint(uint64(len(payload))), sqliteVarint(uint64(row.RowID))...)
+
+	local := localPayload(len(payload), sqlitePageSize-35)
+	if local == len(payload) {
+		return append(cell, payload...)
+	}
+
+	cell = append(cell, payload[:local]...)
+	return binary.BigEndian.AppendUint32(cell, uint32(w.writeOverflow(payload[local:])))
+}
+
+// localPayload is how much of a payload stays on its b-tree page when at
+// most maxLocal bytes fit there
+func localPayload(size, maxLocal int) int {
+	if size <= maxLocal {
+		return size
+	}
+	usable := sqlitePageSize
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	return local
+}
+
+// writeOverflow stores data in a chain of overflow pages and returns the
+// first one
+func (w *sqliteWriter) writeOverflow(data []byte) int {
+	first := 0
+	var previous []byte
+	for len(data) > 0 {
+		number := w.allocate()
+		page := w.page(number)
+		if previous == nil {
+			first = number
+		} else {
+			binary.BigEndian.PutUint32(previous, uint32(number))
+		}
+		n := copy(page[4:], data)
+		data = data[n:]
+		previous = page
+	}
+	return first
+}
+
+// writeIndex writes sorted index records as an index b-tree rooted at root.
+// Unlike table b-trees, the records separating two pages are stored in the
+// interior page above them only.
+func (w *sqliteWriter) writeIndex(root int, records [][]byte) {
+	cells := make([][]byte, len(records))
+	for i, record := range records {
+		cells[i] = append(sqliteVarint(uint64(len(record))), record...)
+	}
+
+	if fitsPage(cells, root, 8) {
+		w.writePage(root, sqliteLeafIndex, cells, 0)
+		return
+	}
+
+	// Leaves and the cells between them
+	var children []int
+	var dividers [][]byte
+	for start := 0; start < len(cells); {
+		end := packCells(cells[start:], 0, 8) + start
+		page := w.allocate()
+		w.writePage(page, sqliteLeafIndex, cells[start:end], 0)
+		children = append(children, page)
+		if end < len(cells) {
+			dividers = append(dividers, cells[end])
+			end++
+		}
+		start = end
+	}
+
+	for {
+		interiorCells := make([][]byte, len(dividers))
+		for i, divider := range dividers {
+			interiorCells[i] = binary.BigEndian.AppendUint32(nil, uint32(children[i]))
+			interiorCells[i] = append(interiorCells[i], divider...)
+		}
+		if fitsPage(interiorCells, root, 12) {
+			w.writePage(root, sqliteInteriorIndex, interiorCells, children[len(children)-1])
+			return
+		}
+
+		var parents []int
+		var parentDividers [][]byte
+		for start := 0; start < len(children); {
+			end := packCells(interiorCells[start:], 0, 12) + start
+			if end >= len(dividers) {
+				end = len(children) - 1
+			} else if end == len(dividers)-1 {
+				// Leave the last page more than its right-most child
+				end--
+			}
+			page := w.allocate()
+			w.writePage(page, sqliteInteriorIndex, interiorCells[start:end], children[end])
+			parents = append(parents, page)
+			if end < len(dividers) {
+				parentDividers = append(parentDividers, dividers[end])
+			}
+			start = end + 1
+		}
+		children, dividers = parents, parentDividers
+	}
+}
+
+// fitsPage reports whether cells fit on page with a b-tree header of
+// headerSize bytes
+func fitsPage(cells [][]byte, page, headerSize int) bool {
+	return packCells(cells, headerOffset(page), headerSize) == len(cells)
+}
+
+// packCells is how many of cells, at least one, fit on a page whose b-tree
+// header of headerSize bytes starts at offset
+func packCells(cells [][]byte, offset, headerSize int) int {
+	free := sqlitePageSize - offset - headerSize
+	for i, cell := range cells {
+		if free -= len(cell) + 2; free < 0 {
+			if i == 0 {
+				return 1
+			}
+			return i
+		}
+	}
+	return len(cells)
+}
+
+// writePage lays out a b-tree page: its header, the cell pointers in order
+// and the cells from the end of the page backwards
+func (w *sqliteWriter) writePage(number int, pageType byte, cells [][]byte, rightMost int) {
+	page := w.page(number)
+	offset := headerOffset(number)
+	headerSize := 8
+	if pageType == sqliteInteriorIndex || pageType == sqliteInteriorTable {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[offset+8:], uint32(rightMost))
+	}
+
+	page[offset] = pageType
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+
+	content := sqlitePageSize
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[offset+headerSize+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+}
+
+// sqliteRecord encodes values in the record format
+func sqliteRecord(values []interface{}) []byte {
+	var types, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			types = append(types, sqliteVarint(0)...)
+		case int64:
+			serialType, size := sqliteIntType(v)
+			types = append(types, sqliteVarint(serialType)...)
+			for i := size - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+		case float64:
+			types = append(types, sqliteVarint(7)...)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = append(types, sqliteVarint(uint64(2*len(v)+13))...)
+			body = append(body, v...)
+		case []byte:
+			types = append(types, sqliteVarint(uint64(2*len(v)+12))...)
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("sqlite: unsupported value %T", value))
+		}
+	}
+
+	// The header size counts its own varint
+	headerSize := len(types) + 1
+	for len(sqliteVarint(uint64(headerSize)))+len(types) != headerSize {
+		headerSize++
+	}
+
+	record := append(sqliteVarint(uint64(headerSize)), types...)
+	return append(record, body...)
+}
+
+// sqliteIntType is the serial type and size in bytes of an integer
+func sqliteIntType(v int64) (uint64, int) {
+	switch {
+	case v == 0:
+		return 8, 0
+	case v == 1:
+		return 9, 0
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, 1
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	default:
+		return 6, 8
+	}
+}
+
+// sqliteVarint encodes v as a big-endian varint of 1 to 9 bytes
+func sqliteVarint(v uint64) []byte {
+	if v > 1<<56-1 {
+		out := make([]byte, 9)
+		out[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			out[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return out
+	}
+
+	var groups []byte
+	for {
+		groups = append(groups, byte(v&0x7f))
+		if v >>= 7; v == 0 {
+			break
+		}
+	}
+	out := make([]byte, len(groups))
+	for i := range groups {
+		out[i] = groups[len(groups)-1-i]
+		if i < len(groups)-1 {
+			out[i] |= 0x80
+		}
+	}
+	return out
+}
+
+// compareSQLiteKeys orders index keys as SQLite does with the BINARY
+// collation: NULLs first, then numbers, then text
+func compareSQLiteKeys(a, b []interface{}) int {
+	for i := range a {
+		if c := compareSQLiteValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareSQLiteValues(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case int64, float64:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case int64, float64:
+		af, bf := sqliteNumber(av), sqliteNumber(b)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+	case string:
+		bv := b.(string)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	}
+	return 0
+}
+
+func sqliteNumber(v interface{}) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
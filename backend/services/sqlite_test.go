@@ -0,0 +1,29 @@
+package services
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestSQLiteEncoding(t *testing.T) {
+	varints := map[uint64][]byte{
+		0:       {0x00},
+		127:     {0x7f},
+		128:     {0x81, 0x00},
+		1 << 14: {0x81, 0x80, 0x00},
+	}
+	for value, want := range varints {
+		if got := sqliteVarint(value); !bytes.Equal(got, want) {
+			t.Errorf("varint %d is % x, want % x", value, got, want)
+		}
+	}
+	if got := sqliteVarint(math.MaxUint64); len(got) != 9 {
+		t.Errorf("the largest varint takes %d bytes, want 9", len(got))
+	}
+
+	record := sqliteRecord([]interface{}{nil, int64(1), int64(-1), "ab"})
+	if want := []byte{5, 0, 9, 1, 17, 0xff, 'a', 'b'}; !bytes.Equal(record, want) {
+		t.Errorf("record is % x, want % x", record, want)
+	}
+}
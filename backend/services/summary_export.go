@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"quicacademy-backend/models"
+)
+
+// SummaryDocument is a summary laid out for export: the same sections, in
+// the same order, whichever format it is rendered to
+type SummaryDocument struct {
+	Title        string
+	Subject      string
+	Version      int
+	CreatedAt    time.Time
+	BulletPoints []string
+	Paragraphs   []string
+	Concepts     []SummaryConcept
+	Labels       SummaryLabels
+}
+
+// SummaryConcept is a key concept with its explanation, which may be empty
+type SummaryConcept struct {
+	Name        string
+	Explanation string
+}
+
+// SummaryLabels are the headings and metadata labels of an exported summary
+type SummaryLabels struct {
+	Subject      string
+	Version      string
+	Created      string
+	BulletPoints string
+	Paragraphs   string
+	Concepts     string
+	Footer       string
+}
+
+var summaryLabels = map[string]SummaryLabels{
+	LanguageEnglish: {
+		Subject:      "Subject",
+		Version:      "Version",
+		Created:      "Generated",
+		BulletPoints: "Key Points",
+		Paragraphs:   "Summary",
+		Concepts:     "Key Concepts",
+		Footer:       "Quicacademy",
+	},
+	LanguageIndonesian: {
+		Subject:      "Mata pelajaran",
+		Version:      "Versi",
+		Created:      "Dibuat",
+		BulletPoints: "Poin Utama",
+		Paragraphs:   "Ringkasan",
+		Concepts:     "Konsep Kunci",
+		Footer:       "Quicacademy",
+	},
+}
+
+// bulletPrefix matches the list marker of a bullet point
+var bulletPrefix = regexp.MustCompile(`^(?:[-•*·]|\d+[.)])\s*`)
+
+// NewSummaryDocument lays out a summary of a material, labelled in the
+// summary's language
+func NewSummaryDocument(title, subject string, summary models.Summary) SummaryDocument {
+	labels, ok := summaryLabels[summary.Language]
+	if !ok {
+		labels = summaryLabels[LanguageIndonesian]
+	}
+
+	doc := SummaryDocument{
+		Title:     title,
+		Subject:   subject,
+		Version:   summary.Version,
+		CreatedAt: summary.CreatedAt,
+		Labels:    labels,
+	}
+
+	for _, line := range strings.Split(summary.BulletPoints, "\n") {
+		if line = strings.TrimSpace(bulletPrefix.ReplaceAllString(strings.TrimSpace(line), "")); line != "" {
+			doc.BulletPoints = append(doc.BulletPoints, line)
+		}
+	}
+
+	// Paragraphs are separated by blank lines, lines within them are wrapped
+	for _, paragraph := range regexp.MustCompile(`\n\s*\n`).Split(summary.Paragraphs, -1) {
+		if paragraph = strings.Join(strings.Fields(paragraph), " "); paragraph != "" {
+			doc.Paragraphs = append(doc.Paragraphs, paragraph)
+		}
+	}
+
+	for _, entry := range conceptEntries(summary.Concepts) {
+		doc.Concepts = append(doc.Concepts, SummaryConcept{Name: entry.Name, Explanation: entry.Explanation})
+	}
+
+	return doc
+}
+
+// Metadata is the line of material details under the title
+func (doc SummaryDocument) Metadata() string {
+	var parts []string
+	if doc.Subject != "" {
+		parts = append(parts, doc.Labels.Subject+": "+doc.Subject)
+	}
+	if doc.Version > 0 {
+		parts = append(parts, fmt.Sprintf("%s: %d", doc.Labels.Version, doc.Version))
+	}
+	if !doc.CreatedAt.IsZero() {
+		parts = append(parts, doc.Labels.Created+": "+doc.CreatedAt.Format("2006-01-02"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// RenderSummaryMarkdown renders a summary document as Markdown
+func RenderSummaryMarkdown(doc SummaryDocument) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", doc.Title)
+	if metadata := doc.Metadata(); metadata != "" {
+		fmt.Fprintf(&buf, "_%s_\n\n", metadata)
+	}
+
+	if len(doc.BulletPoints) > 0 {
+		fmt.Fprintf(&buf, "## %s\n\n", doc.Labels.BulletPoints)
+		for _, point := range doc.BulletPoints {
+			fmt.Fprintf(&buf, "- %s\n", point)
+		}
+		buf.WriteString("\n")
+	}
+
+	if len(doc.Paragraphs) > 0 {
+		fmt.Fprintf(&buf, "## %s\n\n", doc.Labels.Paragraphs)
+		for _, paragraph := range doc.Paragraphs {
+			fmt.Fprintf(&buf, "%s\n\n", paragraph)
+		}
+	}
+
+	if len(doc.Concepts) > 0 {
+		fmt.Fprintf(&buf, "## %s\n\n", doc.Labels.Concepts)
+		for _, concept := range doc.Concepts {
+			if concept.Explanation == "" {
+				fmt.Fprintf(&buf, "- **%s**\n", concept.Name)
+			} else {
+				fmt.Fprintf(&buf, "- **%s**: %s\n", concept.Name, concept.Explanation)
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	fmt.Fprintf(&buf, "---\n\n%s\n", doc.Labels.Footer)
+	return buf.Bytes()
+}
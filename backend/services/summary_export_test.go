@@ -0,0 +1,143 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"quicacademy-backend/models"
+)
+
+func testSummaryDocument() SummaryDocument {
+	return NewSummaryDocument("Biologi Dasar", "Biologi", models.Summary{
+		Version:      2,
+		Language:     LanguageIndonesian,
+		CreatedAt:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		BulletPoints: "• Fotosintesis terjadi di kloroplas\n\n- Membutuhkan cahaya (matahari) & air",
+		Paragraphs:   "Tumbuhan membuat makanan\nsendiri.\n\nKlorofil menyerap cahaya.",
+		Concepts:     `[{"title":"Klorofil","description":"Pigmen hijau <daun>"},{"title":"Stomata","description":""}]`,
+	})
+}
+
+func TestNewSummaryDocument(t *testing.T) {
+	doc := testSummaryDocument()
+
+	if want := []string{"Fotosintesis terjadi di kloroplas", "Membutuhkan cahaya (matahari) & air"}; !reflect.DeepEqual(doc.BulletPoints, want) {
+		t.Errorf("bullet points are %q", doc.BulletPoints)
+	}
+	if want := []string{"Tumbuhan membuat makanan sendiri.", "Klorofil menyerap cahaya."}; !reflect.DeepEqual(doc.Paragraphs, want) {
+		t.Errorf("paragraphs are %q", doc.Paragraphs)
+	}
+	if len(doc.Concepts) != 2 || doc.Concepts[0].Explanation != "Pigmen hijau <daun>" || doc.Concepts[1].Name != "Stomata" {
+		t.Errorf("concepts are %+v", doc.Concepts)
+	}
+	if got := doc.Metadata(); got != "Mata pelajaran: Biologi · Versi: 2 · Dibuat: 2024-03-01" {
+		t.Errorf("metadata is %q", got)
+	}
+
+	markdown := string(RenderSummaryMarkdown(doc))
+	for _, want := range []string{"# Biologi Dasar\n", "## Poin Utama\n\n- Fotosintesis", "## Ringkasan\n\nTumbuhan", "- **Klorofil**: Pigmen hijau", "- **Stomata**\n"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, markdown)
+		}
+	}
+}
+
+func TestRenderSummaryDOCX(t *testing.T) {
+	data, err := RenderSummaryDOCX(testSummaryDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/_rels/document.xml.rels", "word/styles.xml", "word/numbering.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("package is missing %s", name)
+		}
+	}
+
+	// The document must be well-formed XML with the text intact
+	var text strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(files["word/document.xml"]))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := token.(xml.CharData); ok {
+			text.Write(data)
+		}
+	}
+	for _, want := range []string{"Biologi Dasar", "cahaya (matahari) & air", "Pigmen hijau <daun>"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("document text is missing %q", want)
+		}
+	}
+}
+
+func TestRenderSummaryPDF(t *testing.T) {
+	doc := testSummaryDocument()
+	for i := 0; i < 80; i++ {
+		doc.Paragraphs = append(doc.Paragraphs, strings.Repeat("Respirasi sel menghasilkan energi dalam bentuk ATP. ", 8))
+	}
+
+	data := RenderSummaryPDF(doc, time.Now())
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF file")
+	}
+
+	// Every object must be where the cross-reference table says it is
+	start := bytes.LastIndex(data, []byte("startxref\n"))
+	var xref int
+	fmt.Sscanf(string(data[start+len("startxref\n"):]), "%d", &xref)
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref points at %q", data[xref:xref+10])
+	}
+	var count int
+	fmt.Sscanf(string(data[xref+len("xref\n"):]), "0 %d", &count)
+	entries := data[bytes.Index(data[xref:], []byte("65535 f \n"))+xref+len("65535 f \n"):]
+	for i := 1; i < count; i++ {
+		var offset int
+		fmt.Sscanf(string(entries[(i-1)*20:]), "%d", &offset)
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("object %d is not at offset %d", i, offset)
+		}
+	}
+
+	if pages := bytes.Count(data, []byte("/Type /Page ")); pages < 2 {
+		t.Errorf("a long summary fills %d pages", pages)
+	}
+	if !bytes.Contains(data, []byte(`(Membutuhkan cahaya \(matahari\) & air)`)) {
+		t.Error("text is not escaped")
+	}
+	for _, length := range regexp.MustCompile(`/Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(data, -1) {
+		n, _ := strconv.Atoi(string(data[length[2]:length[3]]))
+		if !bytes.HasPrefix(data[length[1]+n:], []byte("endstream")) {
+			t.Error("stream length does not match its content")
+		}
+	}
+}
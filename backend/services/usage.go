@@ -0,0 +1,116 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AI features tracked in the usage ledger
+const (
+	FeatureSummary = "summary"
+	FeatureQuiz    = "quiz"
+	FeatureChat    = "chat"
+
+	FeatureEssayGrading = "essay_grading"
+	FeatureFlashcards   = "flashcards"
+)
+
+// CallContext says who an AI call is made for, so its cost can be attributed
+type CallContext struct {
+	UserID     uuid.UUID
+	MaterialID uuid.NullUUID
+	Feature    string
+	Refresh    bool // skip cached responses, e.g. when regenerating
+}
+
+// TokenUsage is the usage block returned by the provider
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// DefaultPriceTable is used when AI_PRICE_TABLE is not set
+var DefaultPriceTable = map[string]ModelPrice{
+	"anthropic/claude-3-haiku": {Prompt: 0.25, Completion: 1.25},
+}
+
+// LoadPriceTable reads the price table from AI_PRICE_TABLE, a JSON object
+// mapping model names to prices, e.g.
+// {"anthropic/claude-3-haiku": {"prompt": 0.25, "completion": 1.25}}
+func LoadPriceTable() map[string]ModelPrice {
+	raw := os.Getenv("AI_PRICE_TABLE")
+	if raw == "" {
+		return DefaultPriceTable
+	}
+
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal([]byte(raw), &prices); err != nil {
+		log.Printf("Invalid AI_PRICE_TABLE, using default prices: %v", err)
+		return DefaultPriceTable
+	}
+
+	return prices
+}
+
+// UsageLedger records the tokens and cost of every AI call in ai_usage
+type UsageLedger struct {
+	DB     *sql.DB
+	Prices map[string]ModelPrice
+}
+
+func NewUsageLedger(db *sql.DB) *UsageLedger {
+	return &UsageLedger{
+		DB:     db,
+		Prices: LoadPriceTable(),
+	}
+}
+
+// Cost computes the USD cost of usage on model, which served a request for
+// requested. The provider may answer with a more specific version than the
+// one requested, which is priced as the requested model unless the table
+// lists it. Unknown models cost 0.
+func (l *UsageLedger) Cost(model, requested string, usage TokenUsage) float64 {
+	price, ok := l.Prices[model]
+	if !ok {
+		price = l.Prices[requested]
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+// Record adds a ledger entry for a request for requested that model served.
+// A cached call costs nothing, what it would have cost is recorded as
+// saved_cost instead. Failures are logged rather than returned, a metering
+// problem should never fail the user's request.
+func (l *UsageLedger) Record(call CallContext, model, requested string, usage TokenUsage, cached bool) {
+	if l == nil || l.DB == nil {
+		return
+	}
+
+	cost, savedCost := l.Cost(model, requested, usage), 0.0
+	if cached {
+		cost, savedCost = 0, cost
+	}
+
+	query := `INSERT INTO ai_usage (id, user_id, material_id, feature, model, prompt_tokens, completion_tokens, cost, cached, saved_cost, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err := l.DB.Exec(query,
+		uuid.New(), call.UserID, call.MaterialID, call.Feature, model,
+		usage.PromptTokens, usage.CompletionTokens, cost, cached, savedCost, time.Now(),
+	)
+	if err != nil {
+		log.Printf("Failed to record AI usage: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsageLedgerCost(t *testing.T) {
+	ledger := &UsageLedger{Prices: map[string]ModelPrice{
+		"anthropic/claude-3-haiku":          {Prompt: 0.25, Completion: 1.25},
+		"anthropic/claude-3-haiku-20240307": {Prompt: 0.5, Completion: 2.5},
+	}}
+	usage := TokenUsage{PromptTokens: 1000000, CompletionTokens: 200000}
+
+	tests := []struct {
+		name      string
+		model     string
+		requested string
+		expected  float64
+	}{
+		{name: "requested model", model: "anthropic/claude-3-haiku", requested: "anthropic/claude-3-haiku", expected: 0.5},
+		{name: "listed version", model: "anthropic/claude-3-haiku-20240307", requested: "anthropic/claude-3-haiku", expected: 1},
+		{name: "unlisted version", model: "anthropic/claude-3-haiku-20250101", requested: "anthropic/claude-3-haiku", expected: 0.5},
+		{name: "unknown model", model: "openai/gpt-4o", requested: "openai/gpt-4o", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ledger.Cost(tt.model, tt.requested, usage); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("Cost(%q, %q) = %g, want %g", tt.model, tt.requested, got, tt.expected)
+			}
+		})
+	}
+}
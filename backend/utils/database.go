@@ -25,7 +25,7 @@ func InitDB(databaseURL string) (*sql.DB, error) {
 func CreateTables(db *sql.DB) error {
 	queries := []string{
 		`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`,
-		
+
 		`CREATE TABLE IF NOT EXISTS users (
 			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
 			name VARCHAR(100) NOT NULL,
@@ -97,6 +97,254 @@ func CreateTables(db *sql.DB) error {
 			UNIQUE(user_id, material_id)
 		);`,
 
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			type VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			dedup_key VARCHAR(255) NOT NULL,
+			result_id UUID,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_language VARCHAR(10) NOT NULL DEFAULT 'id';`,
+		`ALTER TABLE materials ADD COLUMN IF NOT EXISTS language VARCHAR(10) NOT NULL DEFAULT '';`,
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS language VARCHAR(10) NOT NULL DEFAULT 'id';`,
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS language VARCHAR(10) NOT NULL DEFAULT 'id';`,
+
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;`,
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS length VARCHAR(20) NOT NULL DEFAULT 'standard';`,
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS audience VARCHAR(20) NOT NULL DEFAULT 'sma';`,
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS style VARCHAR(20) NOT NULL DEFAULT 'default';`,
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE;`,
+
+		// Older databases may hold several unversioned summaries per material,
+		// number them by age and keep only the newest one active
+		`UPDATE summaries s SET version = r.rn, is_active = (r.rn = r.total)
+		 FROM (SELECT id,
+					  ROW_NUMBER() OVER (PARTITION BY material_id ORDER BY created_at, id) AS rn,
+					  COUNT(*) OVER (PARTITION BY material_id) AS total
+			   FROM summaries) r
+		 WHERE s.id = r.id
+		   AND EXISTS (SELECT 1 FROM summaries d
+					   WHERE d.material_id = s.material_id AND d.id <> s.id AND d.version = s.version);`,
+
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS prompt_template VARCHAR(100) NOT NULL DEFAULT '';`,
+		`ALTER TABLE summaries ADD COLUMN IF NOT EXISTS prompt_version INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS prompt_template VARCHAR(100) NOT NULL DEFAULT '';`,
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS prompt_version INTEGER NOT NULL DEFAULT 0;`,
+
+		`CREATE TABLE IF NOT EXISTS prompt_templates (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			name VARCHAR(50) NOT NULL,
+			language VARCHAR(10) NOT NULL,
+			version INTEGER NOT NULL,
+			body TEXT NOT NULL,
+			weight INTEGER NOT NULL DEFAULT 1,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE(name, language, version)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS chat_messages (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID REFERENCES materials(id) ON DELETE SET NULL,
+			message TEXT NOT NULL,
+			response TEXT NOT NULL,
+			language VARCHAR(10) NOT NULL,
+			prompt_template VARCHAR(100) NOT NULL DEFAULT '',
+			prompt_version INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'student';`,
+
+		`CREATE TABLE IF NOT EXISTS ai_usage (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID REFERENCES materials(id) ON DELETE SET NULL,
+			feature VARCHAR(20) NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			cost NUMERIC(12, 6) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`ALTER TABLE ai_usage ADD COLUMN IF NOT EXISTS cached BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE ai_usage ADD COLUMN IF NOT EXISTS saved_cost NUMERIC(12, 6) NOT NULL DEFAULT 0;`,
+
+		`CREATE TABLE IF NOT EXISTS ai_cache (
+			key VARCHAR(64) PRIMARY KEY,
+			model VARCHAR(100) NOT NULL,
+			prompt_template VARCHAR(100) NOT NULL,
+			prompt_version INTEGER NOT NULL,
+			material_id UUID REFERENCES materials(id) ON DELETE SET NULL,
+			response TEXT NOT NULL,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL
+		);`,
+
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS results TEXT NOT NULL DEFAULT '[]';`,
+
+		// Attempts are sessions now; attempts recorded before that were
+		// submitted in one go
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'submitted';`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS question_order TEXT NOT NULL DEFAULT '[]';`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS started_at TIMESTAMP;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMP;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS grading_status VARCHAR(20) NOT NULL DEFAULT 'graded';`,
+		`UPDATE quiz_attempts SET started_at = created_at, submitted_at = created_at WHERE started_at IS NULL;`,
+
+		`CREATE TABLE IF NOT EXISTS question_bank (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			quiz_id UUID REFERENCES quizzes(id) ON DELETE SET NULL,
+			type VARCHAR(20) NOT NULL,
+			concept VARCHAR(200) NOT NULL DEFAULT '',
+			difficulty VARCHAR(20) NOT NULL DEFAULT '',
+			question TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Attempts are assembled from a seed; older attempts have none and
+		// use the quiz's questions in question_order
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS questions_per_attempt INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS seed BIGINT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS questions TEXT NOT NULL DEFAULT '';`,
+
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS adaptive BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE quizzes ADD COLUMN IF NOT EXISTS target_standard_error DOUBLE PRECISION NOT NULL DEFAULT 0.5;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS ability DOUBLE PRECISION;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS ability_se DOUBLE PRECISION;`,
+		`ALTER TABLE quiz_attempts ADD COLUMN IF NOT EXISTS question_times TEXT NOT NULL DEFAULT '{}';`,
+
+		// IRT parameters of question bank items, calibrated from attempts
+		`CREATE TABLE IF NOT EXISTS item_parameters (
+			bank_id UUID PRIMARY KEY REFERENCES question_bank(id) ON DELETE CASCADE,
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			difficulty DOUBLE PRECISION NOT NULL,
+			discrimination DOUBLE PRECISION NOT NULL DEFAULT 1,
+			responses INTEGER NOT NULL DEFAULT 0,
+			calibrated_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Learning activities other than quiz attempts, for analytics
+		`CREATE TABLE IF NOT EXISTS activity_log (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID REFERENCES materials(id) ON DELETE CASCADE,
+			type VARCHAR(30) NOT NULL,
+			duration_seconds INTEGER NOT NULL DEFAULT 0,
+			occurred_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Graded answers per concept a question tests, in the order they were
+		// given, and the mastery of each concept traced from them
+		`CREATE TABLE IF NOT EXISTS question_outcomes (
+			attempt_id UUID NOT NULL REFERENCES quiz_attempts(id) ON DELETE CASCADE,
+			question_id INTEGER NOT NULL,
+			concept VARCHAR(200) NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			credit DOUBLE PRECISION NOT NULL,
+			answered_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (attempt_id, question_id, concept)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS concept_mastery (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			concept VARCHAR(200) NOT NULL,
+			mastery DOUBLE PRECISION NOT NULL,
+			responses INTEGER NOT NULL DEFAULT 0,
+			last_practiced_at TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (user_id, material_id, concept)
+		);`,
+
+		// Flashcard decks per material and their cards, each scheduled for
+		// review with SM-2, and the log of reviews
+		`CREATE TABLE IF NOT EXISTS flashcard_decks (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title VARCHAR(200) NOT NULL,
+			language VARCHAR(10) NOT NULL DEFAULT 'id',
+			prompt_template VARCHAR(100) NOT NULL DEFAULT '',
+			prompt_version INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS flashcards (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			deck_id UUID NOT NULL REFERENCES flashcard_decks(id) ON DELETE CASCADE,
+			front TEXT NOT NULL,
+			back TEXT NOT NULL,
+			concept VARCHAR(200) NOT NULL DEFAULT '',
+			position INTEGER NOT NULL DEFAULT 0,
+			ease_factor DOUBLE PRECISION NOT NULL DEFAULT 2.5,
+			interval_days INTEGER NOT NULL DEFAULT 0,
+			repetitions INTEGER NOT NULL DEFAULT 0,
+			lapses INTEGER NOT NULL DEFAULT 0,
+			due_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_reviewed_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS flashcard_reviews (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			flashcard_id UUID NOT NULL REFERENCES flashcards(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			grade INTEGER NOT NULL,
+			ease_factor DOUBLE PRECISION NOT NULL,
+			interval_days INTEGER NOT NULL,
+			reviewed_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS share_links (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			material_id UUID NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+			quiz_id UUID REFERENCES quizzes(id) ON DELETE CASCADE,
+			type VARCHAR(20) NOT NULL,
+			token VARCHAR(64) UNIQUE NOT NULL,
+			password_hash VARCHAR(255) NOT NULL DEFAULT '',
+			expires_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			view_count INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS guest_attempts (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			share_link_id UUID NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+			quiz_id UUID NOT NULL REFERENCES quizzes(id) ON DELETE CASCADE,
+			guest_name VARCHAR(100) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'in_progress',
+			questions TEXT NOT NULL,
+			answers TEXT NOT NULL DEFAULT '{}',
+			question_times TEXT NOT NULL DEFAULT '{}',
+			results TEXT NOT NULL DEFAULT '[]',
+			score INTEGER NOT NULL DEFAULT 0,
+			correct INTEGER NOT NULL DEFAULT 0,
+			total INTEGER NOT NULL DEFAULT 0,
+			passed BOOLEAN NOT NULL DEFAULT FALSE,
+			time_spent INTEGER NOT NULL DEFAULT 0,
+			started_at TIMESTAMP DEFAULT NOW(),
+			submitted_at TIMESTAMP
+		);`,
+
 		`CREATE INDEX IF NOT EXISTS idx_materials_user_id ON materials(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_materials_status ON materials(status);`,
 		`CREATE INDEX IF NOT EXISTS idx_summaries_material_id ON summaries(material_id);`,
@@ -104,6 +352,39 @@ func CreateTables(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_quiz_attempts_user_id ON quiz_attempts(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_quiz_attempts_quiz_id ON quiz_attempts(quiz_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_progress_user_id ON progress(user_id);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_summaries_material_version ON summaries(material_id, version);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_summaries_material_active ON summaries(material_id) WHERE is_active;`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_user_id ON chat_messages(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_usage_user_id_created_at ON ai_usage(user_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_usage_created_at ON ai_usage(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_cache_material_id ON ai_cache(material_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_cache_prompt_template ON ai_cache(prompt_template);`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_cache_expires_at ON ai_cache(expires_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_question_bank_material_id ON question_bank(material_id, concept, difficulty);`,
+		`CREATE INDEX IF NOT EXISTS idx_item_parameters_material_id ON item_parameters(material_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_activity_log_user_id_occurred_at ON activity_log(user_id, occurred_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_activity_log_material_id ON activity_log(material_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_question_outcomes_user_concept ON question_outcomes(user_id, material_id, concept);`,
+		`CREATE INDEX IF NOT EXISTS idx_flashcard_decks_user_id ON flashcard_decks(user_id, material_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_flashcards_deck_id_due_at ON flashcards(deck_id, due_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_flashcard_reviews_flashcard_id ON flashcard_reviews(flashcard_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_user_id ON share_links(user_id, material_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_guest_attempts_share_link_id ON guest_attempts(share_link_id);`,
+		// Only one pending/running job may exist per dedup key, so concurrent
+		// generate requests for the same material collapse into a single job.
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_active_dedup_key ON jobs(dedup_key) WHERE status IN ('pending', 'running');`,
+		// A student has at most one open session per quiz
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_quiz_attempts_open ON quiz_attempts(user_id, quiz_id) WHERE status = 'in_progress';`,
+		// Progress was not recorded for attempts finished before it was
+		// maintained, derive it from them once
+		`INSERT INTO progress (user_id, material_id, has_taken_quiz, best_score, total_attempts, last_accessed_at)
+		 SELECT a.user_id, q.material_id, TRUE, MAX(a.score), COUNT(*), MAX(COALESCE(a.submitted_at, a.created_at))
+		 FROM quiz_attempts a
+		 JOIN quizzes q ON a.quiz_id = q.id
+		 WHERE a.status <> 'in_progress'
+		 GROUP BY a.user_id, q.material_id
+		 ON CONFLICT (user_id, material_id) DO NOTHING;`,
 	}
 
 	for _, query := range queries {